@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// applyActionsInputs sets the flags which are not given on the command line
+// from the GitHub Actions inputs, e.g. the input dest-registry (passed as
+// INPUT_DEST-REGISTRY or INPUT_DEST_REGISTRY) sets --dest-registry.
+func applyActionsInputs(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		name := strings.ToUpper(f.Name)
+		for _, key := range []string{"INPUT_" + name, "INPUT_" + strings.Replace(name, "-", "_", -1)} {
+			// actions pass empty values for inputs which are not set
+			value := os.Getenv(key)
+			if value == "" {
+				continue
+			}
+			if err := cmd.Flags().Set(f.Name, value); err != nil {
+				logrus.Fatalf("invalid action input %s: %s", key, err)
+			}
+			return
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var auditPublicKey string
+
+var auditCmd = &cobra.Command{
+	Use:   "audit AUDIT_LOG",
+	Short: "Verify audit log",
+	Long: `
+Verify the hash chain and signatures of the audit log.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		n, err := core.VerifyAuditLog(args[0], auditPublicKey)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("audit log verified, entries count: %d", n)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.PersistentFlags().StringVar(&auditPublicKey, "public-key", "", "verify entry signatures with the ed25519 public key file(PKIX PEM)")
+}
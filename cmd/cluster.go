@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+// newClusterCmd returns the cluster images command running run.
+func newClusterCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Images of a kubernetes cluster",
+		Long: `
+The images referenced by the pods and workloads of a kubernetes cluster.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("cluster", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().StringVar(&opt.Kubeconfig, "kubeconfig", "", "kubeconfig file of the cluster")
+	cmd.PersistentFlags().StringVar(&opt.KubeContext, "context", "", "kubeconfig context of the cluster")
+	cmd.PersistentFlags().StringSliceVar(&opt.KubeNamespaces, "namespace", nil, "cluster namespaces(comma separated or repeated), all namespaces if empty")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Sync config tools",
+	Long: `
+Tools of the sync config.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the sync config",
+	Long: `
+Validate the flags and files of an image source, the external tools,
+the source registries connectivity and the destination registry
+credentials without syncing anything, e.g.
+
+  imgsync config validate static -f images.yaml --user foo --password bar`,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	addSourceCmds(configValidateCmd, validateConfig)
+}
+
+func validateConfig(name string, opt *core.SyncOption) {
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := core.ValidateConfig(ctx, name, opt); err != nil {
+		logrus.Fatal(err)
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var copyOption core.SyncOption
+
+var copyCmd = &cobra.Command{
+	Use:   "copy SRC DST",
+	Short: "Copy single image",
+	Long: `
+Copy the image reference SRC to DST with all platforms, or the platforms of
+--platform, e.g.
+
+  imgsync copy registry.k8s.io/pause:3.9 harbor.internal/mirror/pause
+  imgsync copy quay.io/coreos/flannel:v0.24.2 mycorp/flannel:v0.24.2 --platform linux/amd64,linux/arm64
+
+DST without tag keeps the source tag, the copy is skipped when DST already
+has the source digest.`,
+	Args:   cobra.ExactArgs(2),
+	PreRun: prerun,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := signalContext()
+		defer cancel()
+		imgs, err := core.CopyImage(ctx, args[0], args[1], &copyOption)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err = core.CheckFailures(imgs, &copyOption); err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+	copyCmd.PersistentFlags().StringVar(&copyOption.User, "user", "", "destination registry user")
+	copyCmd.PersistentFlags().StringVar(&copyOption.Password, "password", "", "destination registry user password")
+	copyCmd.PersistentFlags().DurationVar(&copyOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	copyCmd.PersistentFlags().BoolVar(&copyOption.Report, "report", false, "report sync detail")
+	copyCmd.PersistentFlags().IntVar(&copyOption.ReportLevel, "report-level", 1, "report sync detail level")
+	copyCmd.PersistentFlags().StringVar(&copyOption.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	copyCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir or object storage url(s3://, gs:// or oss://bucket/prefix)")
+	copyCmd.PersistentFlags().StringVar(&core.ManifestCompression, "manifests-compression", "", "compression of stored manifests, gzip or zstd")
+	copyCmd.PersistentFlags().BoolVar(&core.ManifestArchive, "manifests-archive", false, "store the manifests of each repository in a single tar archive")
+	copyCmd.PersistentFlags().BoolVar(&core.ManifestContentAddressed, "manifests-content-addressed", false, "store each distinct manifest once by digest, the tag files only reference the digest")
+	addCopyFlags(copyCmd.PersistentFlags(), &copyOption)
+}
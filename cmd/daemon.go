@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const defaultDaemonInterval = 6 * time.Hour
+
+var daemonInterval time.Duration
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Sync images periodically",
+	Long: `
+Sync the images of an image source every interval until a termination
+signal is received, failed runs are logged and retried by the next run.`,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.PersistentFlags().DurationVar(&daemonInterval, "interval", defaultDaemonInterval, "interval between the starts of two syncs")
+	addSourceCmds(daemonCmd, daemon)
+}
+
+func daemon(name string, opt *core.SyncOption) {
+	if daemonInterval <= 0 {
+		logrus.Fatalf("invalid daemon interval: %s", daemonInterval)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	for {
+		start := time.Now()
+		core.StartRun()
+		if err := core.NewSynchronizer(name).Sync(ctx, opt); err != nil {
+			logrus.Error(err)
+		}
+		next := time.Until(start.Add(daemonInterval))
+		logrus.Infof("next sync in %s", next.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next):
+		}
+	}
+}
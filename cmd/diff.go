@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Diff images with the manifests storage",
+	Long: `
+Print the images of an image source whose upstream manifests differ from the
+manifests storage, i.e. the images the next sync copies:
+
+  + new images
+  ~ changed images`,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	addOutputFlag(diffCmd)
+	addSourceCmds(diffCmd, modeRunner(core.ModeDiff))
+}
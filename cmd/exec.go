@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+// newExecCmd returns the plugin images command running run.
+func newExecCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "exec PLUGIN [-- ARGS...]",
+		Short: "Images emitted by a plugin",
+		Long: `
+The images emitted by an external plugin binary, the plugin writes
+one JSON object per line to stdout for each image, e.g.
+
+  {"image": "registry.example.com/team/app:v1.0.0"}`,
+		Args:   cobra.MinimumNArgs(1),
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			opt.PluginArgs = args[1:]
+			run("exec:"+args[0], &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().IntVar(&opt.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var exportFile string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export images to other tools",
+	Long: `
+Export the images of an image source to the config formats of other tools.`,
+}
+
+var exportSkopeoCmd = &cobra.Command{
+	Use:   "skopeo",
+	Short: "Export skopeo sync YAML",
+	Long: `
+Export the images of an image source as skopeo sync YAML, e.g.
+
+  imgsync export skopeo gcr --file skopeo.yaml
+  skopeo sync --src yaml --dest docker skopeo.yaml docker.io/foo
+
+skopeo sync keeps the source repository paths under the destination, the
+destination name options of imgsync do not apply.`,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportSkopeoCmd)
+	exportSkopeoCmd.PersistentFlags().StringVar(&exportFile, "file", "", "skopeo sync YAML file, default stdout")
+	addSourceCmds(exportSkopeoCmd, func(name string, opt *core.SyncOption) {
+		opt.ExportFile = exportFile
+		modeRunner(core.ModeSkopeo)(name, opt)
+	})
+}
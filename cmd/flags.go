@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/pflag"
+)
+
+// addCopyFlags adds the image copy flags shared by all sync commands.
+func addCopyFlags(flags *pflag.FlagSet, opt *core.SyncOption) {
+	flags.StringSliceVar(&opt.Priority, "priority", nil, "image names or repositories(glob patterns) synced first in the order, e.g. pause,coredns,etcd")
+	flags.StringVar(&opt.Order, "order", core.OrderNone, "order of the images to sync(newest syncs the highest semver tags first)")
+	flags.StringVar(&opt.DestRegistry, "dest-registry", "", "destination registry host(e.g. harbor.internal:5000), default docker hub")
+	flags.StringVar(&opt.DestNamespace, "dest-namespace", "", "destination namespace(e.g. harbor project), default the user")
+	flags.StringVar(&opt.MinThroughput, "min-throughput", "", "minimum copy throughput per second(e.g. 1Mi), the image timeout is 1m plus the layers size at the throughput instead of --timeout")
+	flags.IntVar(&opt.ParallelLayers, "parallel-layers", 0, "parallel layer copies per image(0: default, 1: sequential, max 6)")
+	flags.IntVar(&opt.ParallelPlatforms, "parallel-platforms", 0, "parallel platform copies of manifest lists(0: sequential), lists are pushed as is and keep their digests")
+	flags.StringVar(&opt.Recompress, "recompress", "", "recompress zstd(and zstd:chunked) layers to the compression(gzip) for destinations and clients which can not consume zstd")
+	flags.StringVar(&opt.CopyEngine, "copy-engine", core.EngineContainersImage, "image copy engine(containers-image/crane), crane runs the go-containerregistry crane tool")
+	flags.StringVar(&opt.ContainerdNamespace, "containerd-namespace", "", "import the images into the local containerd namespace(e.g. k8s.io) with ctr instead of pushing them, source names are kept")
+	flags.StringVar(&opt.ContainerdAddress, "containerd-address", core.DefaultContainerdAddress, "containerd socket address of --containerd-namespace")
+	flags.DurationVar(&opt.RateLimitPause, "rate-limit-pause", core.DefaultRateLimitPause, "pause all workers when the registry rate limit is reached")
+	flags.IntVar(&opt.RateLimitStorm, "rate-limit-storm", core.DefaultRateLimitStorm, "rate limited requests within 10s which pause all workers for the advertised retry-after window(1: pause on every rate limited request)")
+	flags.Var((*percentValue)(&opt.FailureRate), "failure-rate", "allowed failed images rate(e.g. 5%), exit with non-zero code when exceeded")
+	flags.BoolVar(&opt.FailFast, "fail-fast", false, "stop syncing the remaining images on the first failure")
+	flags.IntVar(&opt.MaxFailures, "max-failures", 0, "stop syncing the remaining images when the failed images count reached")
+	flags.Var((*percentValue)(&opt.MaxFailureRate), "max-failure-rate", "stop syncing the remaining images when the failed images rate(e.g. 20%) reached")
+	flags.BoolVar(&opt.Verify, "verify", false, "verify the destination manifest digest after sync")
+	flags.BoolVar(&opt.VerifyRetry, "verify-retry", false, "retry the sync when the destination digest mismatch")
+	flags.StringVar(&opt.Schema1, "schema1", core.Schema1Copy, "docker schema1 manifests handling(copy/convert/convert-oci/skip)")
+	flags.BoolVar(&opt.PreserveDigests, "preserve-digests", false, "copy manifests bit-for-bit, fail the image when the digest would change")
+	flags.StringSliceVar(&opt.Platforms, "platform", nil, "only copy the platforms of manifest lists(e.g. linux/amd64,linux/arm64/v8), digests of filtered manifest lists change")
+	flags.BoolVar(&opt.SkipWindows, "skip-windows", false, "drop windows platforms from manifest lists(ignored with --preserve-digests)")
+	flags.BoolVar(&opt.CopyReferrers, "copy-referrers", false, "copy OCI referrers(SBOMs, attestations, signatures) of synced images")
+	flags.BoolVar(&opt.CopySignatures, "copy-signatures", false, "copy cosign signature and attestation tags of synced images")
+	flags.StringVar(&opt.CosignKey, "cosign-key", "", "sign pushed images with the cosign key(\"keyless\" signs via OIDC)")
+	flags.StringVar(&opt.NotationKey, "notation-key", "", "sign pushed images with the notation key name")
+	flags.StringVar(&opt.ScanSeverity, "scan-severity", "", "scan source images with trivy, skip images with vulnerabilities at or above the severity(e.g. CRITICAL)")
+	flags.BoolVar(&opt.ScanFlagOnly, "scan-flag-only", false, "only report vulnerable images instead of skipping them")
+	flags.StringVar(&opt.PolicyFile, "policy", "", "signature policy file(policy.json) which source images must meet")
+	flags.StringVar(&opt.SBOMFormat, "sbom", "", "generate SBOMs of synced images with syft in the format(spdx-json/cyclonedx-json)")
+	flags.StringVar(&opt.VerifyKey, "verify-key", "", "verify source image signatures with the cosign public key, unsigned images are skipped")
+	flags.StringVar(&opt.VerifyIdentity, "verify-identity", "", "verify keyless source image signatures with the certificate identity regexp")
+	flags.StringVar(&opt.VerifyIssuer, "verify-issuer", "", "verify keyless source image signatures with the OIDC issuer regexp, required by --verify-identity")
+	flags.StringVar(&opt.AllowlistFile, "allowlist", "", "only sync images whose digest is listed in the file(one digest per line)")
+	flags.BoolVar(&opt.Force, "force", false, "overwrite destination tags which have a different digest")
+	flags.BoolVarP(&opt.Yes, "yes", "y", false, "confirm overwriting destination tags(--force) and pruning stored manifests without prompting, required when stdin is not a terminal")
+	flags.StringVar(&opt.AuditLog, "audit-log", "", "append pushed images to the hash chained audit log file")
+	flags.StringVar(&opt.AuditKey, "audit-key", "", "sign audit log entries with the ed25519 private key file(PKCS8 PEM)")
+	flags.StringVar(&opt.NameTemplate, "name-template", "", "go template of the destination repository name(e.g. '{{.User}}_{{.Name}}'), default joins repo, user and name with '_'")
+	flags.StringVar(&opt.NameSeparator, "name-separator", "_", "separator of the flattened destination name components")
+	flags.StringVar(&opt.NameReplaceDots, "name-replace-dots", "", "replace dots of the flattened destination names(e.g. '-')")
+	flags.IntVar(&opt.NameMaxLength, "name-max-length", 0, "truncate destination names longer than the length, a name hash keeps them unique")
+	flags.StringVar(&opt.NameHierarchy, "hierarchy", core.HierarchyAuto, "flatten or preserve nested image paths in destination names(auto/flatten/preserve), auto only flattens for docker hub")
+	flags.StringArrayVar(&opt.TagRewrites, "tag-rewrite", nil, "rewrite destination tags with REGEXP=REPLACEMENT rules(e.g. '^v(.+)$=$1', '^latest$=latest-{date}'), the first matching rule applies, rewrites of different tags to the same tag abort")
+	flags.BoolVar(&opt.Disambiguate, "disambiguate", false, "suffix destination names mapped from different source repositories with a source hash instead of aborting")
+	flags.StringVar(&opt.MappingFile, "mapping-file", "", "write the source to destination mapping of synced images to the file(.json or .yaml)")
+	flags.StringVar(&opt.LatestPolicy, "latest", core.LatestKeep, "latest tags handling(keep/skip/semver), semver tags the highest semver tag as latest instead of syncing it")
+	flags.StringVar(&opt.LockFile, "locked", "", "only sync the images pinned by the lock file, from their pinned digests")
+	flags.StringVar(&opt.WriteLockFile, "write-lock", "", "write the source digests of synced images to the lock file(e.g. images.lock)")
+	flags.StringVar(&opt.OverridesFile, "overrides", "", "YAML file of per image destination references, taking precedence over the name mapping")
+	flags.BoolVar(&opt.Dedup, "dedup", false, "copy tags of the same digest once and tag the others with manifest puts on the destination")
+	flags.StringVar(&opt.QueueFile, "queue", "", "work queue file, a restarted sync continues the pending images of the queue without listing them again")
+	flags.StringVar(&opt.TagsCacheFile, "tags-cache", "", "tags list cache file(e.g. imgsync_tags.json), unchanged repositories cost a 304 with conditional requests")
+	flags.BoolVar(&opt.IncrementalTags, "incremental-tags", false, "only list the tags added after the last cached tag with the tags list pagination(needs --tags-cache)")
+	flags.DurationVar(&opt.TagsRefresh, "tags-refresh", core.DefaultTagsRefresh, "list the full tags of incremental listings again after the interval to notice removed tags")
+	flags.DurationVar(&opt.StallTimeout, "stall-timeout", 0, "cancel and retry the image copies which have made no progress for the duration(e.g. 3m), slow copies which are still moving are not cancelled, 0 disables it")
+	flags.StringVar(&opt.PanicDir, "panic-dir", core.DefaultPanicDir, "directory of the diagnostic files(image, stack trace, recent logs) of the images panicked while syncing, empty disables them")
+	flags.StringVar(&opt.BlobCacheDir, "blob-cache-dir", "", "directory of the blob info cache reused between runs, known layers are reused or mounted on the destination instead of uploaded again")
+	flags.BoolVar(&opt.BlobCacheContents, "blob-cache-contents", false, "also keep the layers downloaded from the sources in the blob cache directory, cached layers are not downloaded again(needs --blob-cache-dir)")
+	flags.BoolVar(&opt.Pipeline, "pipeline", false, "copy the images while the tags are still being listed, only gcr and knative list images incrementally")
+	flags.DurationVar(&opt.ProgressInterval, "progress-interval", core.DefaultProgressInterval, "interval of the run progress logs(done images, copied bytes, throughput and ETA), 0 disables them")
+	flags.DurationVar(&opt.MaxDuration, "max-duration", 0, "run time budget(e.g. 50m), no new images are started in the last 10% of the budget and the remaining images are left to the next run")
+	flags.StringSliceVar(&opt.Webhooks, "webhook", nil, "webhook urls receiving a JSON POST(image, digest and destination) as soon as each image is synced(comma separated or repeated)")
+	flags.StringVar(&opt.WebhookSecret, "webhook-secret", "", "sign the webhook bodies with HMAC-SHA256 in the X-Imgsync-Signature header")
+	flags.BoolVar(&opt.HubRateCheck, "hub-rate-check", false, "check the docker hub pull rate limit before and during the run, docker hub images exceeding the remaining quota are left to the next run")
+	flags.DurationVar(&opt.HubRateInterval, "hub-rate-interval", core.DefaultHubRateInterval, "interval of the docker hub pull rate limit queries during the run, 0 only checks before the run")
+	flags.IntVar(&opt.HubRateReserve, "hub-rate-reserve", core.DefaultHubRateReserve, "docker hub pulls kept in reserve of the remaining quota")
+	flags.BoolVar(&opt.CreateRepos, "create-repos", false, "create the missing docker hub repositories or harbor projects of the destination before pushing")
+	flags.StringVar(&opt.RepoVisibility, "repo-visibility", core.VisibilityPublic, "visibility of the created destination repositories(public/private)")
+	flags.BoolVar(&opt.HubDescription, "hub-description", false, "set the short and full descriptions of the docker hub destination repositories(mirror source and last synced date) after syncing")
+	flags.StringVar(&opt.FailedFile, "failed-file", core.DefaultFailedFile, "file of the failed images written after each run, empty disables it")
+	flags.BoolVar(&opt.RetryFailed, "retry-failed", false, "only sync the failed images of the last run from the failed file, the images are not listed again")
+	flags.StringVar(&opt.DeadLetterFile, "dead-letter", "", "file of the images failed after all retries(error class, last error and attempts), kept across runs until the images are synced")
+	flags.StringVar(&opt.ImagesFrom, "images-from", "", "only sync the images of the dead-letter or failed images file, the images are not listed again")
+	flags.StringVar(&opt.HistoryFile, "history", "", "failure history file, images which failed in previous runs are synced last")
+	flags.IntVar(&opt.QuarantineAfter, "quarantine-after", 0, "quarantine images after the consecutive failures count of the history reached, quarantined images are skipped until the retry interval passed")
+	flags.DurationVar(&opt.QuarantineRetry, "quarantine-retry", core.DefaultQuarantineRetry, "retry interval of quarantined images")
+	flags.BoolVar(&opt.PlatformManifests, "platform-manifests", false, "also store the platform manifests of manifest lists in the tag directory")
+	flags.BoolVar(&opt.StoreConfig, "store-config", false, "also store the image config blobs(labels, created time, entrypoint) next to the manifests")
+	flags.IntVar(&opt.RetainTags, "retain-tags", 0, "keep the most recently synced tags count per image in the manifests storage, older tags are pruned after each run")
+	flags.BoolVar(&opt.DryRun, "dry-run", false, "only print the images a sync would copy with the estimated transfer size and run time, nothing is synced")
+	flags.Float64Var(&opt.TransferRate, "transfer-rate", core.DefaultTransferRate, "estimated transfer rate per worker in MB/s of dry runs")
+	flags.StringVar(&opt.ResultsFile, "results", "", "write the sync results of the images to the JSON file, reports of results files are rendered by the report command")
+	flags.IntVar(&opt.RetainDays, "retain-days", 0, "prune stored manifests last synced more than the days ago after each run")
+}
+
+// addBatchFlags adds the batch and shard flags of the listing sync commands.
+func addBatchFlags(flags *pflag.FlagSet, opt *core.SyncOption) {
+	flags.IntVar(&opt.BatchSize, "batch-size", 0, "batch size")
+	_ = flags.MarkDeprecated("batch-size", "use --batch-total, batches derived from the batch size move with the images count")
+	flags.IntVar(&opt.BatchNumber, "batch-number", 0, "batch number")
+	flags.IntVar(&opt.BatchTotal, "batch-total", 0, "total batches count, images are assigned to batches by name hash(required by --batch-number and --next-batch)")
+	flags.BoolVar(&opt.BatchBySize, "batch-by-size", false, "spread images over batches by the transfer size estimated from cached manifests")
+	flags.Var((*shardValue)(opt), "shard", "sync the stable shard INDEX/TOTAL of the images(e.g. 3/10), sets batch number and total")
+	flags.BoolVar(&opt.NextBatch, "next-batch", false, "sync the first batch not completed by previous runs according to the checkpoint file")
+	flags.StringVar(&opt.CheckpointFile, "checkpoint", core.DefaultCheckpointFile, "checkpoint file of the completed batches")
+}
+
+// addManifestFlags adds the manifests storage flags.
+func addManifestFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir or object storage url(s3://, gs:// or oss://bucket/prefix)")
+	flags.StringVar(&core.ManifestCompression, "manifests-compression", "", "compression of stored manifests, gzip or zstd")
+	flags.BoolVar(&core.ManifestArchive, "manifests-archive", false, "store the manifests of each repository in a single tar archive")
+	flags.BoolVar(&core.ManifestContentAddressed, "manifests-content-addressed", false, "store each distinct manifest once by digest, the tag files only reference the digest")
+	flags.BoolVar(&core.ManifestGit, "manifests-git", false, "commit the manifests dir to its git working tree after each run, and push it when the branch has an upstream")
+}
+
+// percentValue is a rate flag, accepts both "20%" and "0.2".
+type percentValue float64
+
+func (p *percentValue) Set(s string) error {
+	var v float64
+	var err error
+	if strings.HasSuffix(s, "%") {
+		v, err = strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		v /= 100
+	} else {
+		v, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil {
+		return err
+	}
+	if v < 0 || v > 1 {
+		return fmt.Errorf("rate %s out of range [0%%, 100%%]", s)
+	}
+	*p = percentValue(v)
+	return nil
+}
+
+func (p *percentValue) String() string {
+	return strconv.FormatFloat(float64(*p)*100, 'f', -1, 64) + "%"
+}
+
+func (p *percentValue) Type() string {
+	return "rate"
+}
+
+// shardValue is a "INDEX/TOTAL" shard flag (e.g. 3/10), it sets the batch
+// number and batches count of the option.
+type shardValue core.SyncOption
+
+func (s *shardValue) Set(v string) error {
+	ss := strings.Split(v, "/")
+	if len(ss) != 2 {
+		return fmt.Errorf("invalid shard %s, expected INDEX/TOTAL", v)
+	}
+	index, err := strconv.Atoi(ss[0])
+	if err != nil {
+		return fmt.Errorf("invalid shard %s: %s", v, err)
+	}
+	total, err := strconv.Atoi(ss[1])
+	if err != nil {
+		return fmt.Errorf("invalid shard %s: %s", v, err)
+	}
+	if total <= 0 || index <= 0 || index > total {
+		return fmt.Errorf("invalid shard %s, index out of range [1, %d]", v, total)
+	}
+	s.BatchNumber, s.BatchTotal = index, total
+	return nil
+}
+
+func (s *shardValue) String() string {
+	if s.BatchTotal == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.BatchNumber, s.BatchTotal)
+}
+
+func (s *shardValue) Type() string {
+	return "shard"
+}
@@ -5,28 +5,30 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var flSyncOption core.SyncOption
-
-var flannelCmd = &cobra.Command{
-	Use:   "flannel",
-	Short: "Sync flannel images",
-	Long: `
-Sync flannel images.`,
-	PreRun: prerun,
-	Run: func(cmd *cobra.Command, args []string) {
-		boot("flannel", &flSyncOption)
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(flannelCmd)
-	flannelCmd.PersistentFlags().StringVar(&flSyncOption.User, "user", "", "docker hub user")
-	flannelCmd.PersistentFlags().StringVar(&flSyncOption.Password, "password", "", "docker hub user password")
-	flannelCmd.PersistentFlags().DurationVar(&flSyncOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
-	flannelCmd.PersistentFlags().IntVar(&flSyncOption.Limit, "process-limit", core.DefaultLimit, "sync image limit")
-	flannelCmd.PersistentFlags().BoolVar(&flSyncOption.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
-	flannelCmd.PersistentFlags().BoolVar(&flSyncOption.Report, "report", false, "report sync detail")
-	flannelCmd.PersistentFlags().IntVar(&flSyncOption.ReportLevel, "report-level", 1, "report sync detail level")
-	flannelCmd.PersistentFlags().StringVar(&flSyncOption.ReportFile, "report-file", "imgsync_report", "report sync detail file")
-	flannelCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir")
+// newFlannelCmd returns the flannel images command running run.
+func newFlannelCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "flannel",
+		Short: "Flannel images",
+		Long: `
+Flannel images of quay.io.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("flannel", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	cmd.PersistentFlags().StringVar(&opt.FlannelReleases, "releases", "", "flannel github releases to sync(latest, the latest N releases or all), empty syncs all tags")
+	cmd.PersistentFlags().BoolVar(&opt.FlannelArchTags, "arch-tags", false, "also sync architecture suffixed tags of the releases")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
 }
@@ -5,33 +5,34 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var gcrSyncOption core.SyncOption
-
-var gcrCmd = &cobra.Command{
-	Use:   "gcr",
-	Short: "Sync gcr images",
-	Long: `
-Sync gcr images.`,
-	PreRun: prerun,
-	Run: func(cmd *cobra.Command, args []string) {
-		boot("gcr", &gcrSyncOption)
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(gcrCmd)
-	gcrCmd.PersistentFlags().StringVar(&gcrSyncOption.User, "user", "", "docker hub user")
-	gcrCmd.PersistentFlags().StringVar(&gcrSyncOption.Password, "password", "", "docker hub user password")
-	gcrCmd.PersistentFlags().StringVar(&gcrSyncOption.NameSpace, "namespace", "google-containers", "google container registry namespace")
-	gcrCmd.PersistentFlags().IntVar(&gcrSyncOption.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
-	gcrCmd.PersistentFlags().IntVar(&gcrSyncOption.Limit, "process-limit", core.DefaultLimit, "sync image limit")
-	gcrCmd.PersistentFlags().DurationVar(&gcrSyncOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
-	gcrCmd.PersistentFlags().BoolVar(&gcrSyncOption.Kubeadm, "kubeadm", false, "sync kubeadm images(ignore namespace, use k8s.gcr.io)")
-	gcrCmd.PersistentFlags().IntVar(&gcrSyncOption.BatchSize, "batch-size", 0, "batch size")
-	gcrCmd.PersistentFlags().IntVar(&gcrSyncOption.BatchNumber, "batch-number", 0, "batch number")
-	gcrCmd.PersistentFlags().BoolVar(&gcrSyncOption.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
-	gcrCmd.PersistentFlags().BoolVar(&gcrSyncOption.Report, "report", false, "report sync detail")
-	gcrCmd.PersistentFlags().IntVar(&gcrSyncOption.ReportLevel, "report-level", 1, "report sync detail level")
-	gcrCmd.PersistentFlags().StringVar(&gcrSyncOption.ReportFile, "report-file", "imgsync_report", "report sync detail file")
-	gcrCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir")
+// newGcrCmd returns the gcr images command running run.
+func newGcrCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "gcr",
+		Short: "Gcr images",
+		Long: `
+Images of gcr.io, the kubeadm images of k8s.gcr.io with --kubeadm.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("gcr", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().StringSliceVar(&opt.NameSpaces, "namespace", []string{"google-containers"}, "google container registry namespaces(comma separated or repeated)")
+	cmd.PersistentFlags().BoolVar(&opt.Recursive, "recursive", false, "walk nested sub namespaces of the namespaces")
+	cmd.PersistentFlags().IntVar(&opt.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	cmd.PersistentFlags().BoolVar(&opt.Kubeadm, "kubeadm", false, "sync kubeadm images(ignore namespace, use k8s.gcr.io)")
+	cmd.PersistentFlags().StringVar(&opt.KubernetesVersion, "kubernetes-version", "", "only sync the kubeadm images of the kubernetes versions(e.g. v1.29.2 or v1.28.0..v1.29.2, comma separated)")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
 }
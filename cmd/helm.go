@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+// newHelmCmd returns the helm images command running run.
+func newHelmCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "helm",
+		Short: "Images of helm charts",
+		Long: `
+The images referenced by the rendered manifests of helm charts.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("helm", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().StringSliceVar(&opt.HelmCharts, "chart", nil, "helm chart references(e.g. ingress-nginx/ingress-nginx@4.9.0, comma separated or repeated)")
+	cmd.PersistentFlags().StringSliceVarP(&opt.HelmValues, "values", "f", nil, "helm values files of the charts")
+	cmd.PersistentFlags().StringArrayVar(&opt.HelmSet, "set", nil, "helm values of the charts(key=value)")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
+}
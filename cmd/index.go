@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var indexOutput string
+var indexHTML bool
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Export manifests index",
+	Long: `
+Render the manifests storage into an index.json and an optional searchable
+index.html of the mirrored images, e.g. to publish them with GitHub Pages.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := core.ExportIndex(indexOutput, indexHTML); err != nil {
+			logrus.Fatalf("failed to export manifests index: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.PersistentFlags().StringVarP(&indexOutput, "output", "o", "public", "index output dir")
+	indexCmd.PersistentFlags().BoolVar(&indexHTML, "html", false, "also render a searchable index.html")
+	indexCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir or object storage url(s3://, gs:// or oss://bucket/prefix)")
+	indexCmd.PersistentFlags().BoolVar(&core.ManifestArchive, "manifests-archive", false, "store the manifests of each repository in a single tar archive")
+	indexCmd.PersistentFlags().BoolVar(&core.ManifestContentAddressed, "manifests-content-addressed", false, "store each distinct manifest once by digest, the tag files only reference the digest")
+}
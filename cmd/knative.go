@@ -5,31 +5,30 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var kNativeSyncOption core.SyncOption
-
-var kNativeCmd = &cobra.Command{
-	Use:   "knative",
-	Short: "Sync kNative images",
-	Long: `
-Sync kNative images.`,
-	PreRun: prerun,
-	Run: func(cmd *cobra.Command, args []string) {
-		boot("kNative", &kNativeSyncOption)
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(kNativeCmd)
-	kNativeCmd.PersistentFlags().StringVar(&kNativeSyncOption.User, "user", "", "docker hub user")
-	kNativeCmd.PersistentFlags().StringVar(&kNativeSyncOption.Password, "password", "", "docker hub user password")
-	kNativeCmd.PersistentFlags().IntVar(&kNativeSyncOption.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
-	kNativeCmd.PersistentFlags().IntVar(&kNativeSyncOption.Limit, "process-limit", core.DefaultLimit, "sync image limit")
-	kNativeCmd.PersistentFlags().DurationVar(&kNativeSyncOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
-	kNativeCmd.PersistentFlags().IntVar(&kNativeSyncOption.BatchSize, "batch-size", 0, "batch size")
-	kNativeCmd.PersistentFlags().IntVar(&kNativeSyncOption.BatchNumber, "batch-number", 0, "batch number")
-	kNativeCmd.PersistentFlags().BoolVar(&kNativeSyncOption.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
-	kNativeCmd.PersistentFlags().BoolVar(&kNativeSyncOption.Report, "report", false, "report sync detail")
-	kNativeCmd.PersistentFlags().IntVar(&kNativeSyncOption.ReportLevel, "report-level", 1, "report sync detail level")
-	kNativeCmd.PersistentFlags().StringVar(&kNativeSyncOption.ReportFile, "report-file", "imgsync_report", "report sync detail file")
-	kNativeCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir")
+// newKNativeCmd returns the kNative images command running run.
+func newKNativeCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "knative",
+		Short: "KNative images",
+		Long: `
+KNative release images of gcr.io.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("kNative", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().IntVar(&opt.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
 }
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List images",
+	Long: `
+Print the images of an image source which would be synced, one per line.`,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	addOutputFlag(listCmd)
+	addSourceCmds(listCmd, modeRunner(core.ModeList))
+}
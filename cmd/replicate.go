@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var replicationCron, replicationRulesFile string
+
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "Create Harbor replication policies",
+	Long: `
+Create or update the pull based replication policies of the images of an
+image source on the Harbor destination registry instead of copying them, so
+the Harbor instance replicates the images itself. Every source repository
+gets a policy filtering its listed tags, the source registry endpoints are
+created as needed, e.g.
+
+  imgsync replicate gcr --dest-registry harbor.internal --dest-namespace mirror --user admin --password xxx
+
+Harbor names the destination repositories mirror/<name>, the destination
+name options of imgsync do not apply.`,
+}
+
+func init() {
+	rootCmd.AddCommand(replicateCmd)
+	replicateCmd.PersistentFlags().StringVar(&replicationCron, "replication-cron", "", "cron schedule of the replication policies(harbor six fields cron, e.g. '0 0 2 * * *'), manual triggers by default")
+	replicateCmd.PersistentFlags().StringVar(&replicationRulesFile, "rules-file", "", "write the replication policies to the JSON file instead of creating them")
+	addSourceCmds(replicateCmd, func(name string, opt *core.SyncOption) {
+		opt.ReplicationCron = replicationCron
+		opt.ReplicationRulesFile = replicationRulesFile
+		modeRunner(core.ModeReplicate)(name, opt)
+	})
+}
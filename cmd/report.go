@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var reportOption core.SyncOption
+
+var reportCmd = &cobra.Command{
+	Use:   "report RESULTS_FILE...",
+	Short: "Render sync reports",
+	Long: `
+Render the report of the results files written by syncs with --results, the
+results of sharded sync jobs are merged into one report.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imgs, err := core.ReportResults(args, &reportOption)
+		if err != nil {
+			logrus.Fatalf("failed to render report: %s", err)
+		}
+		if err = core.CheckFailures(imgs, &reportOption); err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.PersistentFlags().IntVar(&reportOption.ReportLevel, "report-level", 1, "report sync detail level")
+	reportCmd.PersistentFlags().StringVar(&reportOption.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	reportCmd.PersistentFlags().Var((*percentValue)(&reportOption.FailureRate), "failure-rate", "allowed failed images rate(e.g. 5%), exit with non-zero code when exceeded")
+}
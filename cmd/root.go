@@ -18,7 +18,9 @@ import (
 
 var version, buildTime, commit string
 
-var debug bool
+var debug, quiet bool
+
+var verbose int
 
 var rootCmd = &cobra.Command{
 	Use:     "imgsync",
@@ -39,18 +41,31 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initLog)
-	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "debug mode")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "debug mode(same as -v)")
+	rootCmd.PersistentFlags().CountVarP(&verbose, "verbose", "v", "verbose logs, -v logs the layer progress and debug details, -vv also logs the registry requests")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only log warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&core.MemoryLimit, "memory-limit", "", "memory budget(e.g. 512Mi), sets the go runtime soft memory limit, keeps a compact manifests cache and caps the process limit")
 	rootCmd.SetVersionTemplate(versionTpl())
 }
 
 func initLog() {
-	logrus.SetFormatter(&logrus.TextFormatter{
+	logrus.SetFormatter(&core.RedactFormatter{Formatter: &core.LibraryFormatter{Formatter: &logrus.TextFormatter{
 		FullTimestamp:   true,
 		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	}}})
 
-	if debug {
+	if debug && verbose == 0 {
+		verbose = 1
+	}
+	switch {
+	case quiet:
+		logrus.SetLevel(logrus.WarnLevel)
+	case verbose == 1:
+		// callers tell the registry requests of containers/image apart
+		logrus.SetReportCaller(true)
 		logrus.SetLevel(logrus.DebugLevel)
+	case verbose > 1:
+		logrus.SetLevel(logrus.TraceLevel)
 	}
 }
 
@@ -65,17 +80,31 @@ CommitID: %s
 	return fmt.Sprintf(tpl, core.Banner, version, runtime.GOOS+"/"+runtime.GOARCH, buildTime, commit)
 }
 
-func prerun(_ *cobra.Command, _ []string) {
+func prerun(cmd *cobra.Command, _ []string) {
+	if core.InGitHubActions() {
+		applyActionsInputs(cmd)
+	}
+	if err := core.ApplyMemoryLimit(); err != nil {
+		logrus.Fatal(err)
+	}
 	if err := core.LoadManifests(); err != nil {
 		logrus.Fatalf("failed to load manifests: %s", err)
 	}
 }
 
 func boot(name string, opt *core.SyncOption) {
-	sigs := make(chan os.Signal)
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := core.NewSynchronizer(name).Sync(ctx, opt); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// signalContext returns a context which is cancelled on the first termination signal.
+func signalContext() (context.Context, context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
 	ctx, cancel := context.WithCancel(context.Background())
 	var cancelOnce sync.Once
-	defer cancel()
 	go func() {
 		for range sigs {
 			cancelOnce.Do(func() {
@@ -86,5 +115,5 @@ func boot(name string, opt *core.SyncOption) {
 		}
 	}()
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	core.NewSynchronizer(name).Sync(ctx, opt)
+	return ctx, cancel
 }
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+// newSkopeoCmd returns the skopeo sync YAML images command running run.
+func newSkopeoCmd(run sourceRunner) *cobra.Command {
+	var opt core.SyncOption
+	cmd := &cobra.Command{
+		Use:   "skopeo",
+		Short: "Images of a skopeo sync YAML file",
+		Long: `
+The images of a skopeo sync YAML source file(skopeo sync --src yaml),
+credentials, tls settings, digest references and images-by-semver are not
+supported.`,
+		PreRun: prerun,
+		Run: func(_ *cobra.Command, args []string) {
+			run("skopeo", &opt)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opt.User, "user", "", "docker hub user")
+	cmd.PersistentFlags().StringVar(&opt.Password, "password", "", "docker hub user password")
+	cmd.PersistentFlags().StringVarP(&opt.ImagesFile, "images", "f", "skopeo.yaml", "skopeo sync YAML file")
+	cmd.PersistentFlags().IntVar(&opt.QueryLimit, "query-limit", core.DefaultLimit, "http query limit")
+	cmd.PersistentFlags().IntVar(&opt.Limit, "process-limit", core.DefaultLimit, "sync image limit")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	addBatchFlags(cmd.PersistentFlags(), &opt)
+	cmd.PersistentFlags().BoolVar(&opt.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	cmd.PersistentFlags().BoolVar(&opt.Report, "report", false, "report sync detail")
+	cmd.PersistentFlags().IntVar(&opt.ReportLevel, "report-level", 1, "report sync detail level")
+	cmd.PersistentFlags().StringVar(&opt.ReportFile, "report-file", "imgsync_report", "report sync detail file")
+	addManifestFlags(cmd.PersistentFlags())
+	addCopyFlags(cmd.PersistentFlags(), &opt)
+	return cmd
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+// sourceRunner runs the image source command with its synchronizer name and options.
+type sourceRunner func(name string, opt *core.SyncOption)
+
+// sourceCmds are the image source commands of sync, list, diff, verify, replicate,
+// export skopeo, daemon and config validate.
+var sourceCmds = []func(run sourceRunner) *cobra.Command{
+	newGcrCmd,
+	newFlannelCmd,
+	newKNativeCmd,
+	newStaticCmd,
+	newSkopeoCmd,
+	newHelmCmd,
+	newClusterCmd,
+	newExecCmd,
+}
+
+// addSourceCmds adds the image source commands running run to the parent command.
+func addSourceCmds(parent *cobra.Command, run sourceRunner) {
+	for _, newCmd := range sourceCmds {
+		parent.AddCommand(newCmd(run))
+	}
+}
+
+// outputFormat is the output format of the list, diff and verify commands
+var outputFormat string
+
+// modeRunner returns the runner inspecting the images with the mode instead of syncing them.
+func modeRunner(mode string) sourceRunner {
+	return func(name string, opt *core.SyncOption) {
+		opt.Mode = mode
+		opt.Output = outputFormat
+		boot(name, opt)
+	}
+}
+
+// addOutputFlag adds the output format flag to the inspecting command.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", core.OutputText, "output format(text/table/json/yaml)")
+}
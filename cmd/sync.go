@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -13,10 +12,13 @@ import (
 var syncOption core.SyncOption
 
 var syncCmd = &cobra.Command{
-	Use:   "sync",
-	Short: "Sync single image",
+	Use:   "sync [IMAGE]",
+	Short: "Sync images",
 	Long: `
-Sync single image.`,
+Sync the images of an image source, or the single image, e.g.
+
+  imgsync sync gcr --namespace google-containers
+  imgsync sync gcr.io/google-containers/pause:3.2`,
 	PreRun: prerun,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
@@ -44,21 +46,29 @@ Sync single image.`,
 		default:
 			logrus.Fatalf("image name format error: %s", args[0])
 		}
-		core.SyncImages(context.Background(), core.Images{&core.Image{
+		ctx, cancel := signalContext()
+		defer cancel()
+		imgs := core.SyncImages(ctx, core.Images{&core.Image{
 			Repo: repo,
 			User: user,
 			Name: name,
 			Tag:  tag,
 		}}, &syncOption)
+		if err := core.CheckFailures(imgs, &syncOption); err != nil {
+			logrus.Fatal(err)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(syncCmd)
-	syncCmd.PersistentFlags().StringVar(&syncOption.User, "user", "", "docker hub user")
-	syncCmd.PersistentFlags().StringVar(&syncOption.Password, "password", "", "docker hub user password")
-	syncCmd.PersistentFlags().StringVar(&syncOption.NameSpace, "namespace", "google-containers", "google container registry namespace")
-	syncCmd.PersistentFlags().DurationVar(&syncOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
-	syncCmd.PersistentFlags().BoolVar(&syncOption.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
-	syncCmd.PersistentFlags().StringVar(&core.ManifestDir, "manifests", "manifests", "manifests storage dir")
+	addSourceCmds(syncCmd, boot)
+	// the single image flags are not inherited by the image source commands
+	syncCmd.Flags().StringVar(&syncOption.User, "user", "", "docker hub user")
+	syncCmd.Flags().StringVar(&syncOption.Password, "password", "", "docker hub user password")
+	syncCmd.Flags().StringSliceVar(&syncOption.NameSpaces, "namespace", []string{"google-containers"}, "google container registry namespaces")
+	syncCmd.Flags().DurationVar(&syncOption.Timeout, "timeout", core.DefaultSyncTimeout, "sync single image timeout")
+	syncCmd.Flags().BoolVar(&syncOption.OnlyDownloadManifests, "download-manifests", false, "only download manifests")
+	addManifestFlags(syncCmd.Flags())
+	addCopyFlags(syncCmd.Flags(), &syncOption)
 }
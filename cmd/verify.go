@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify destination digests",
+	Long: `
+Verify the destination images of an image source have the upstream manifest
+digests, missing and mismatched images fail the verification.`,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	addOutputFlag(verifyCmd)
+	addSourceCmds(verifyCmd, modeRunner(core.ModeVerify))
+}
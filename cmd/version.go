@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/mritd/imgsync/core"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version",
+	Long: `
+Print the build info, with -v/--verbose also the synchronizers,
+destinations, manifest stores and notifiers compiled in and the external
+tools found, e.g. to include the feature matrix in bug reports.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		fmt.Print(versionTpl())
+		if verbose == 0 && !debug {
+			return
+		}
+		fmt.Printf("GoVersion: %s\n", runtime.Version())
+		for _, c := range core.Capabilities() {
+			if len(c.Items) == 0 {
+				fmt.Printf("%s: none\n", c.Name)
+				continue
+			}
+			fmt.Printf("%s:\n  %s\n", c.Name, strings.Join(c.Items, "\n  "))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
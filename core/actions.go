@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxSummaryFailures limits the failed images listed in the step summary.
+const maxSummaryFailures = 50
+
+// InGitHubActions reports whether imgsync runs in a GitHub Actions workflow.
+func InGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+var actionsSummaryTpl = template.Must(template.New("summary").Parse(`### imgsync {{.Mode}}
+
+| Total | Success | Failed | Skipped | Cache hit | Digest mismatch |
+|------:|--------:|-------:|--------:|----------:|----------------:|
+| {{.Counts.Total}} | {{.Counts.Success}} | {{.Counts.Failed}} | {{.Counts.Skipped}} | {{.Counts.CacheHit}} | {{.Counts.Mismatch}} |
+{{if .Failed}}
+<details><summary>Failed images</summary>
+
+{{range .Failed}}- ` + "`{{.}}`" + `{{if .Err}}: {{.Err}}{{end}}
+{{end}}{{if .More}}- ... and {{.More}} more
+{{end}}
+</details>
+{{end}}`))
+
+// writeActionsOutputs writes the result counts and files of the run to the
+// step outputs ($GITHUB_OUTPUT) and the job summary ($GITHUB_STEP_SUMMARY).
+func writeActionsOutputs(images Images, opt *SyncOption) {
+	if !InGitHubActions() {
+		return
+	}
+	c := countImages(images)
+	mode := opt.Mode
+	if mode == ModeSync {
+		mode = "sync"
+	}
+
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		var buf bytes.Buffer
+		outputs := []struct {
+			name  string
+			value interface{}
+		}{
+			{"mode", mode},
+			{"total", c.Total},
+			{"success", c.Success},
+			{"failed", c.Failed},
+			{"skipped", c.Skipped},
+			{"cache_hit", c.CacheHit},
+			{"digest_mismatch", c.Mismatch},
+		}
+		for _, o := range outputs {
+			fmt.Fprintf(&buf, "%s=%v\n", o.name, o.value)
+		}
+		if opt.Report && opt.ReportFile != "" {
+			fmt.Fprintf(&buf, "report_file=%s\n", opt.ReportFile)
+		}
+		if opt.ResultsFile != "" {
+			fmt.Fprintf(&buf, "results_file=%s\n", opt.ResultsFile)
+		}
+		if opt.Mode == ModeSync && opt.FailedFile != "" {
+			fmt.Fprintf(&buf, "failed_file=%s\n", opt.FailedFile)
+		}
+		if err := appendFile(path, buf.Bytes()); err != nil {
+			logrus.Errorf("failed to write github actions outputs: %s", err)
+		}
+	}
+
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		data := struct {
+			Mode   string
+			Counts imageCounts
+			Failed Images
+			More   int
+		}{Mode: mode, Counts: c}
+		for _, img := range images {
+			if img.Failed() {
+				data.Failed = append(data.Failed, img)
+			}
+		}
+		if len(data.Failed) > maxSummaryFailures {
+			data.More = len(data.Failed) - maxSummaryFailures
+			data.Failed = data.Failed[:maxSummaryFailures]
+		}
+		var buf bytes.Buffer
+		if err := actionsSummaryTpl.Execute(&buf, data); err != nil {
+			logrus.Errorf("failed to render github actions summary: %s", err)
+			return
+		}
+		if err := appendFile(path, buf.Bytes()); err != nil {
+			logrus.Errorf("failed to write github actions summary: %s", err)
+		}
+	}
+}
+
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
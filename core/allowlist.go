@@ -0,0 +1,34 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// loadDigestList loads the digests file, one digest per line,
+// blank lines and lines starting with # are ignored.
+func loadDigestList(path string) (map[digest.Digest]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	digests := make(map[digest.Digest]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dgst, perr := digest.Parse(strings.Fields(line)[0])
+		if perr != nil {
+			return nil, perr
+		}
+		digests[dgst] = true
+	}
+	return digests, scanner.Err()
+}
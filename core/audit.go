@@ -0,0 +1,190 @@
+package core
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// AuditEntry is a single pushed image record of the audit log. Every entry
+// contains the hash of the previous entry, so removing or altering an entry
+// breaks the hash chain of all following entries.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Digest      string    `json:"digest"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+	Signature   string    `json:"signature,omitempty"`
+}
+
+// chainHash returns the hash of the entry content and the previous hash.
+func (e *AuditEntry) chainHash() string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s", e.PrevHash, e.Time.UTC().Format(time.RFC3339Nano), e.Source, e.Destination, e.Digest)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type auditLog struct {
+	mu   sync.Mutex
+	f    *os.File
+	prev string
+	key  ed25519.PrivateKey
+}
+
+// openAuditLog opens the audit log for appending, entries are signed
+// when an ed25519 private key (PKCS8 PEM) file is specified.
+func openAuditLog(path, keyFile string) (*auditLog, error) {
+	al := &auditLog{}
+	if keyFile != "" {
+		key, err := loadEd25519Key(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		al.key = key
+	}
+
+	entries, err := readAuditLog(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		al.prev = entries[len(entries)-1].Hash
+	}
+
+	al.f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return al, nil
+}
+
+func (al *auditLog) record(image, destImage *Image) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	e := AuditEntry{
+		Time:        time.Now(),
+		Source:      image.String(),
+		Destination: destImage.String(),
+		Digest:      image.DestDigest.String(),
+		PrevHash:    al.prev,
+	}
+	if e.Digest == "" {
+		e.Digest = image.Digest.String()
+	}
+	e.Hash = e.chainHash()
+	if al.key != nil {
+		e.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(al.key, []byte(e.Hash)))
+	}
+	bs, err := jsoniter.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	if _, err = al.f.Write(append(bs, '\n')); err != nil {
+		return err
+	}
+	al.prev = e.Hash
+	return nil
+}
+
+func (al *auditLog) close() error {
+	return al.f.Close()
+}
+
+func readAuditLog(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err = jsoniter.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry %d: %s", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// VerifyAuditLog checks the hash chain of the audit log, and the entry
+// signatures when an ed25519 public key (PKIX PEM) file is specified.
+func VerifyAuditLog(path, pubKeyFile string) (int, error) {
+	var pub ed25519.PublicKey
+	if pubKeyFile != "" {
+		bs, err := ioutil.ReadFile(pubKeyFile)
+		if err != nil {
+			return 0, err
+		}
+		block, _ := pem.Decode(bs)
+		if block == nil {
+			return 0, fmt.Errorf("invalid public key file: %s", pubKeyFile)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return 0, err
+		}
+		var ok bool
+		if pub, ok = key.(ed25519.PublicKey); !ok {
+			return 0, fmt.Errorf("public key %s is not an ed25519 key", pubKeyFile)
+		}
+	}
+
+	entries, err := readAuditLog(path)
+	if err != nil {
+		return 0, err
+	}
+	var prev string
+	for i, e := range entries {
+		if e.PrevHash != prev || e.Hash != e.chainHash() {
+			return i, fmt.Errorf("audit log hash chain broken at entry %d (%s)", i+1, e.Source)
+		}
+		if pub != nil {
+			sig, derr := base64.StdEncoding.DecodeString(e.Signature)
+			if derr != nil || !ed25519.Verify(pub, []byte(e.Hash), sig) {
+				return i, fmt.Errorf("audit log signature invalid at entry %d (%s)", i+1, e.Source)
+			}
+		}
+		prev = e.Hash
+	}
+	return len(entries), nil
+}
+
+func loadEd25519Key(path string) (ed25519.PrivateKey, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key file: %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ed25519 key", path)
+	}
+	return edKey, nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/sirupsen/logrus"
+)
+
+// estimateSize returns the transfer size of the image estimated from its
+// cached manifest, manifest lists count the average image size per platform.
+func estimateSize(image *Image, average int64) (int64, bool) {
+	switch m := manifestsMap[image.String()].(type) {
+	case *compactManifest:
+		if m.platforms != nil {
+			return int64(len(m.platforms)) * average, false
+		}
+		return m.size, true
+	case manifest.List:
+		return int64(len(m.Instances())) * average, false
+	case manifest.Manifest:
+		size := m.ConfigInfo().Size
+		for _, layer := range m.LayerInfos() {
+			if layer.Size > 0 {
+				size += layer.Size
+			}
+		}
+		return size, true
+	default:
+		return average, false
+	}
+}
+
+// sizeBatch returns the images of the batch when the images are spread over
+// the batches by their estimated transfer size, so batches take comparable
+// time. Unlike hash batches, the batch of an image may change between runs.
+func sizeBatch(images Images, total, number int) Images {
+	var known, sum int64
+	for _, img := range images {
+		if size, ok := estimateSize(img, 0); ok {
+			known++
+			sum += size
+		}
+	}
+	average := int64(1)
+	if known > 0 && sum > 0 {
+		average = sum / known
+	}
+
+	sorted := make(Images, len(images))
+	copy(sorted, images)
+	sizes := make(map[*Image]int64, len(images))
+	for _, img := range sorted {
+		sizes[img], _ = estimateSize(img, average)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sizes[sorted[i]] != sizes[sorted[j]] {
+			return sizes[sorted[i]] > sizes[sorted[j]]
+		}
+		return sorted[i].String() < sorted[j].String()
+	})
+
+	// assign the largest remaining image to the smallest batch
+	batchSizes := make([]int64, total)
+	assigned := make(map[*Image]int, len(images))
+	for _, img := range sorted {
+		smallest := 0
+		for i := 1; i < total; i++ {
+			if batchSizes[i] < batchSizes[smallest] {
+				smallest = i
+			}
+		}
+		batchSizes[smallest] += sizes[img]
+		assigned[img] = smallest
+	}
+
+	var batch Images
+	for _, img := range images {
+		if assigned[img] == number-1 {
+			batch = append(batch, img)
+		}
+	}
+	logrus.Infof("batch %d/%d estimated size: %d bytes, %d images sizes unknown", number, total, batchSizes[number-1], int64(len(images))-known)
+	return batch
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// blobCacheReference wraps an image reference, the blobs of the image source
+// it creates are read from the blob contents cache directory and the blobs
+// downloaded from the source are stored in it, e.g.
+//
+//	<dir>/blobs/sha256/<hex>
+type blobCacheReference struct {
+	types.ImageReference
+	dir string
+}
+
+// newBlobCacheReference returns the reference caching the blob contents in
+// opt.BlobCacheDir, the reference itself if the contents are not cached.
+func newBlobCacheReference(ref types.ImageReference, opt *SyncOption) types.ImageReference {
+	if opt.BlobCacheDir == "" || !opt.BlobCacheContents {
+		return ref
+	}
+	return &blobCacheReference{ImageReference: ref, dir: filepath.Join(opt.BlobCacheDir, "blobs")}
+}
+
+func (r *blobCacheReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &blobCacheSource{ImageSource: src, dir: r.dir}, nil
+}
+
+type blobCacheSource struct {
+	types.ImageSource
+	dir string
+}
+
+func (s *blobCacheSource) path(dgst digest.Digest) string {
+	return filepath.Join(s.dir, dgst.Algorithm().String(), dgst.Hex())
+}
+
+func (s *blobCacheSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if info.Digest == "" || info.Digest.Validate() != nil {
+		return s.ImageSource.GetBlob(ctx, info, cache)
+	}
+	path := s.path(info.Digest)
+	if f, err := os.Open(path); err == nil {
+		if fi, serr := f.Stat(); serr == nil {
+			logrus.Debugf("blob %s read from the blob cache", info.Digest)
+			return f, fi.Size(), nil
+		}
+		_ = f.Close()
+	}
+
+	rc, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logrus.Warnf("failed to create blob cache directory: %s", err)
+		return rc, size, nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+info.Digest.Hex())
+	if err != nil {
+		logrus.Warnf("failed to create blob cache file: %s", err)
+		return rc, size, nil
+	}
+	return &blobCacheReadCloser{
+		ReadCloser: rc,
+		tmp:        tmp,
+		path:       path,
+		verifier:   info.Digest.Verifier(),
+		digest:     info.Digest,
+	}, size, nil
+}
+
+// blobCacheReadCloser writes the blob to a temporary file while it is read,
+// the file is moved into the cache when the blob has been read completely
+// and matches its digest.
+type blobCacheReadCloser struct {
+	io.ReadCloser
+	tmp      *os.File
+	path     string
+	verifier digest.Verifier
+	digest   digest.Digest
+	eof      bool
+	werr     error
+}
+
+func (rc *blobCacheReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if n > 0 && rc.werr == nil {
+		if _, rc.werr = rc.tmp.Write(p[:n]); rc.werr == nil {
+			_, _ = rc.verifier.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		rc.eof = true
+	}
+	return n, err
+}
+
+func (rc *blobCacheReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if rc.tmp == nil {
+		return err
+	}
+	tmp := rc.tmp.Name()
+	cerr := rc.tmp.Close()
+	rc.tmp = nil
+	switch {
+	case !rc.eof:
+	case rc.werr != nil || cerr != nil:
+		werr := rc.werr
+		if werr == nil {
+			werr = cerr
+		}
+		logrus.Warnf("failed to write blob %s to the blob cache: %s", rc.digest, werr)
+	case !rc.verifier.Verified():
+		logrus.Warnf("blob %s does not match its digest, not cached", rc.digest)
+	default:
+		rerr := os.Rename(tmp, rc.path)
+		if rerr == nil {
+			return err
+		}
+		logrus.Warnf("failed to move blob %s into the blob cache: %s", rc.digest, rerr)
+	}
+	_ = os.Remove(tmp)
+	return err
+}
+
+// checkBlobCacheDir creates the blob cache directory.
+func checkBlobCacheDir(opt *SyncOption) error {
+	if opt.BlobCacheDir == "" {
+		if opt.BlobCacheContents {
+			return fmt.Errorf("blob contents caching needs the --blob-cache-dir directory")
+		}
+		return nil
+	}
+	return os.MkdirAll(opt.BlobCacheDir, 0755)
+}
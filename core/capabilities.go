@@ -0,0 +1,62 @@
+package core
+
+import (
+	"os/exec"
+	"sort"
+)
+
+// Capability is a feature group of the build, e.g. the compiled in synchronizers.
+type Capability struct {
+	Name  string
+	Items []string
+}
+
+// externalTools are the external tools run by the features.
+var externalTools = []struct{ name, feature string }{
+	{"helm", "helm synchronizer"},
+	{"kubectl", "cluster synchronizer"},
+	{"trivy", "vulnerability scan"},
+	{"syft", "sbom generation"},
+	{"cosign", "cosign signing and verification"},
+	{"notation", "notation signing"},
+	{"git", "git manifests store"},
+	{"crane", "crane copy engine"},
+	{"ctr", "containerd destination"},
+}
+
+// Capabilities returns the synchronizers, copy engines, destinations, manifest stores and
+// notifiers compiled in, and the external tools found in PATH.
+func Capabilities() []Capability {
+	synchronizers := append(List(), execSynchronizerPrefix+"<plugin>")
+
+	stores := []string{"local"}
+	for scheme := range objectStoreSchemes {
+		stores = append(stores, scheme+"://")
+	}
+	sort.Strings(stores[1:])
+	stores = append(stores, "archive", "content-addressed", "git")
+	compressions := make([]string, 0, len(compressionSuffixes))
+	for compression := range compressionSuffixes {
+		compressions = append(compressions, compression)
+	}
+	sort.Strings(compressions)
+
+	tools := make([]string, 0, len(externalTools))
+	for _, tool := range externalTools {
+		state := "not found"
+		if path, err := exec.LookPath(tool.name); err == nil {
+			state = path
+		}
+		tools = append(tools, tool.name+" ("+tool.feature+"): "+state)
+	}
+
+	return []Capability{
+		{Name: "Synchronizers", Items: synchronizers},
+		{Name: "Copy engines", Items: []string{EngineContainersImage, EngineCrane}},
+		{Name: "Destinations", Items: []string{"docker registry (docker hub by default)", "containerd image store"}},
+		{Name: "Manifest stores", Items: stores},
+		{Name: "Manifest compressions", Items: compressions},
+		{Name: "Notifiers", Items: []string{"webhook"}},
+		{Name: "External tools", Items: tools},
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// casBlobsDir is the directory of the content addressed store blobs
+	casBlobsDir = "blobs"
+	// casRefSuffix is the suffix of the files pointing to a blob digest
+	casRefSuffix = ".ref"
+)
+
+// ManifestContentAddressed stores each distinct file content once by its
+// digest in blobs/sha256/<hex>, the tag files only contain the digest.
+var ManifestContentAddressed = false
+
+// casStore is a content addressed manifest store, e.g. the tags 3.2 and
+// latest of the same manifest are stored as
+//
+//	blobs/sha256/927d98197ec1141a368550822d18fa1c60bdae27b78b0c004f705f548c07814f
+//	gcr.io/google-containers/pause/3.2.json.ref
+//	gcr.io/google-containers/pause/latest.json.ref
+type casStore struct {
+	manifestStore
+
+	mu    sync.Mutex
+	blobs map[digest.Digest]bool // blobs which have been stored
+}
+
+func newCASStore(s manifestStore) *casStore {
+	return &casStore{manifestStore: s, blobs: make(map[digest.Digest]bool)}
+}
+
+func casBlobName(d digest.Digest) string {
+	return path.Join(casBlobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+// Walk calls fn with the blob content of every ref file, blobs which are
+// not referenced are skipped.
+func (cs *casStore) Walk(fn func(name string, data []byte, modTime time.Time) error) error {
+	type ref struct {
+		digest  digest.Digest
+		modTime time.Time
+	}
+	blobs := make(map[digest.Digest][]byte)
+	refs := make(map[string]ref)
+	err := cs.manifestStore.Walk(func(name string, data []byte, modTime time.Time) error {
+		switch {
+		case strings.HasPrefix(name, casBlobsDir+"/"):
+			d := digest.Digest(strings.Replace(strings.TrimPrefix(name, casBlobsDir+"/"), "/", ":", 1))
+			if d.Validate() == nil {
+				blobs[d] = data
+			}
+			return nil
+		case strings.HasSuffix(name, casRefSuffix):
+			refs[strings.TrimSuffix(name, casRefSuffix)] = ref{digest: digest.Digest(strings.TrimSpace(string(data))), modTime: modTime}
+			return nil
+		default:
+			return fn(name, data, modTime)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	for d := range blobs {
+		cs.blobs[d] = true
+	}
+	cs.mu.Unlock()
+	for name, r := range refs {
+		data, ok := blobs[r.digest]
+		if !ok {
+			logrus.Warnf("manifest file %s references the missing blob %s", name, r.digest)
+			continue
+		}
+		if err = fn(name, data, r.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the ref file, the blob is kept as other files may reference it.
+func (cs *casStore) Delete(name string) error {
+	return cs.manifestStore.Delete(name + casRefSuffix)
+}
+
+func (cs *casStore) Put(name string, data []byte) error {
+	d := digest.FromBytes(data)
+	cs.mu.Lock()
+	stored := cs.blobs[d]
+	cs.mu.Unlock()
+	if !stored {
+		if err := cs.manifestStore.Put(casBlobName(d), data); err != nil {
+			return err
+		}
+		cs.mu.Lock()
+		cs.blobs[d] = true
+		cs.mu.Unlock()
+	}
+	return cs.manifestStore.Put(name+casRefSuffix, []byte(d.String()+"\n"))
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultCheckpointFile stores the completed batches of multi batch syncs.
+const DefaultCheckpointFile = "imgsync_checkpoint.json"
+
+// checkpoint records the completed batches of a batches count.
+type checkpoint struct {
+	Total     int   `json:"total"`
+	Completed []int `json:"completed"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &checkpoint{}, nil
+		}
+		return nil, err
+	}
+	var cp checkpoint
+	if err = jsoniter.Unmarshal(bs, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (cp *checkpoint) save(path string) error {
+	bs, err := jsoniter.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+func (cp *checkpoint) completed(batch int) bool {
+	for _, n := range cp.Completed {
+		if n == batch {
+			return true
+		}
+	}
+	return false
+}
+
+// nextBatch sets the batch number of the option to the first batch not
+// completed yet, a new round starts when all batches have been completed.
+func nextBatch(opt *SyncOption) {
+	total := opt.BatchTotal
+	if total <= 1 {
+		logrus.Warn("next batch requires multiple batches, sync all images")
+		return
+	}
+	cp, err := loadCheckpoint(opt.CheckpointFile)
+	if err != nil {
+		logrus.Fatalf("failed to load checkpoint: %s", err)
+	}
+	if cp.Total != total {
+		if cp.Total != 0 {
+			logrus.Warnf("batches count changed from %d to %d, restart from the first batch", cp.Total, total)
+		}
+		cp.Completed = nil
+	}
+	if len(cp.Completed) >= total {
+		logrus.Infof("all %d batches completed, start a new round", total)
+		cp.Completed = nil
+	}
+	for n := 1; n <= total; n++ {
+		if !cp.completed(n) {
+			opt.BatchNumber = n
+			break
+		}
+	}
+	opt.BatchTotal = total
+	logrus.Infof("next batch: %d/%d", opt.BatchNumber, total)
+
+	cp.Total = total
+	if err = cp.save(opt.CheckpointFile); err != nil {
+		logrus.Fatalf("failed to save checkpoint: %s", err)
+	}
+}
+
+// completeBatch records the batch of the option as completed.
+func completeBatch(opt *SyncOption) {
+	cp, err := loadCheckpoint(opt.CheckpointFile)
+	if err == nil && !cp.completed(opt.BatchNumber) {
+		cp.Total = opt.BatchTotal
+		cp.Completed = append(cp.Completed, opt.BatchNumber)
+		sort.Ints(cp.Completed)
+		err = cp.save(opt.CheckpointFile)
+	}
+	if err != nil {
+		logrus.Errorf("failed to save checkpoint: %s", err)
+		return
+	}
+	logrus.Infof("batch %d/%d completed", opt.BatchNumber, opt.BatchTotal)
+}
@@ -1,17 +1,43 @@
 package core
 
 import (
+	"context"
 	"encoding/base64"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
+// runStart is the process start time, the run time budget includes listing images
+var runStart = time.Now()
+
+// StartRun resets the state of the previous run, e.g. the time budget, the
+// rate limit pauses and the recorded invalid references, for the repeated
+// runs of a daemon. The manifests cache is kept, it is updated by the syncs.
+func StartRun() {
+	runStart = time.Now()
+	prunedManifests.Lock()
+	prunedManifests.images = nil
+	prunedManifests.Unlock()
+	hubRate.Lock()
+	hubRate.start, hubRate.last, hubRate.deferred = nil, nil, 0
+	hubRate.Unlock()
+	invalidRefs.Lock()
+	invalidRefs.refs = nil
+	invalidRefs.Unlock()
+	limiter.reset()
+	repoCreation.mu.Lock()
+	repoCreation.created, repoCreation.hub = make(map[string]bool), nil
+	repoCreation.mu.Unlock()
+}
+
 const (
-	DefaultLimit              = 20
-	DefaultSyncTimeout        = 10 * time.Minute
-	DefaultCtxTimeout         = 5 * time.Minute
-	DefaultHTTPTimeout        = 30 * time.Second
-	DefaultGoRequestRetry     = 3
-	DefaultGoRequestRetryTime = 5 * time.Second
+	DefaultLimit         = 20
+	DefaultSyncTimeout   = 10 * time.Minute
+	DefaultCtxTimeout    = 5 * time.Minute
+	DefaultHTTPTimeout   = 30 * time.Second
+	DefaultHTTPRetry     = 3
+	DefaultHTTPRetryTime = 5 * time.Second
 
 	// DockerHubTags  = "https://hub.docker.com/v2/repositories/%s/%s/tags/?page_size=100"
 	// DockerHubImage = "https://hub.docker.com/v2/repositories/%s/?page_size=100"
@@ -23,6 +49,21 @@ const (
 	defaultSyncRetry     = 3
 	defaultSyncRetryTime = 10 * time.Second
 
+	// minimum processed images before checking the failed images rate
+	defaultFailureRateSamples = 20
+
+	// the last 1/budgetReserve of the run time budget is reserved for in-flight copies
+	budgetReserve = 10
+
+	Schema1Copy       = "copy"        // Copy schema1 manifests as is
+	Schema1Convert    = "convert"     // Convert schema1 manifests to docker schema2
+	Schema1ConvertOCI = "convert-oci" // Convert schema1 manifests to OCI
+	Schema1Skip       = "skip"        // Skip schema1 manifests
+
+	HierarchyAuto     = "auto"     // Preserve image paths unless the destination is docker hub
+	HierarchyFlatten  = "flatten"  // Flatten image paths into a single destination repository name
+	HierarchyPreserve = "preserve" // Keep the nested image paths in destination names
+
 	defaultDockerRepo   = "docker.io"
 	defaultK8sRepo      = "k8s.gcr.io"
 	defaultGcrRepo      = "gcr.io"
@@ -38,14 +79,46 @@ const (
 >> Sync Total: %d
 >> Sync Failed: %d
 >> Sync Success: %d
+>> Sync Skipped: %d
 >> Manifests CacheHit: %d
+>> Digest Mismatch: %d
 `
 	reportErrorTpl = `========================================
 Sync failed images:
-{{range .}}{{if not .Success}}{{. | print}}: {{.Err | println}}{{end}}{{end}}`
+{{range .}}{{if .Failed}}{{. | print}}: {{.Err | println}}{{end}}{{end}}{{range .}}{{if .DigestMismatch}}{{. | print}}: {{printf "digest mismatch, source: %s, destination: %s" .Digest .DestDigest | println}}{{end}}{{end}}`
+	reportFindingsTpl = `========================================
+Vulnerable images:
+{{range .}}{{if .Findings}}{{. | print}}: {{.Findings | println}}{{end}}{{end}}`
+	reportUnverifiedTpl = `========================================
+Signature verification failed images:
+{{range .}}{{if .Unverified}}{{. | println}}{{end}}{{end}}`
+	reportOverwrittenTpl = `========================================
+Overwritten destination tags:
+{{range .}}{{if and .Success .Overwritten}}{{. | print}}: {{printf "%s => %s" .Overwritten .Digest | println}}{{end}}{{end}}`
+	reportRewrittenTpl = `========================================
+Rewritten destination tags:
+{{range .}}{{if .DestTag}}{{. | print}}: {{printf "%s => %s" .Tag .DestTag | println}}{{end}}{{end}}`
+	reportRecompressedTpl = `========================================
+Recompressed layers:
+{{range .}}{{if and .Success .Recompressed}}{{. | print}}: {{.Recompressed | println}}{{end}}{{end}}`
+	reportChangedTpl = `========================================
+Changed upstream images:
+{{range .}}{{if and .Success .Changes}}{{. | print}}: {{.Changes | println}}{{end}}{{end}}`
+	reportPrunedTpl = `========================================
+Pruned stored manifests:
+{{range .}}{{. | println}}{{end}}`
+	reportHubRateTpl = `========================================
+Docker Hub pull rate:
+>> Start: %s
+>> End: %s
+>> Deferred Images: %d
+`
+	reportSkippedTpl = `========================================
+Sync skipped images:
+{{range .}}{{if and .Skipped (not .Unverified)}}{{. | print}}: {{.SkipReason | println}}{{end}}{{end}}`
 	reportSuccessTpl = `========================================
 Sync success images:
-{{range .}}{{if .Success}}{{. | print}}: {{if .CacheHit}}{{"hit cache" | println}}{{else}}{{"not hit cache" | println}}{{end}}{{end}}{{end}}`
+{{range .}}{{if .Success}}{{. | print}}: {{if .CacheHit}}{{"hit cache" | println}}{{else if .DestPresent}}{{"destination up to date" | println}}{{else}}{{"not hit cache" | println}}{{end}}{{end}}{{end}}`
 )
 
 var (
@@ -58,7 +131,7 @@ func retry(count int, interval time.Duration, f func() error) error {
 redo:
 	count--
 	if err = f(); err != nil {
-		if count > 0 {
+		if count > 0 && !isPermanentError(err) {
 			if interval > 0 {
 				<-time.After(interval)
 			}
@@ -67,3 +140,26 @@ redo:
 	}
 	return err
 }
+
+// retryWithContext is like retry, but it stops retrying once ctx is done.
+// Permanent errors are returned without retrying.
+func retryWithContext(ctx context.Context, count int, interval time.Duration, f func() error) error {
+	var err error
+	for ; count > 0; count-- {
+		if err = f(); err == nil || ctx.Err() != nil {
+			return err
+		}
+		if isPermanentError(err) {
+			logrus.Debugf("permanent error, give up retrying: %s", err)
+			return err
+		}
+		if count > 1 && interval > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(interval):
+			}
+		}
+	}
+	return err
+}
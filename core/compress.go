@@ -0,0 +1,378 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CompressionNone = ""     // Store manifest files uncompressed
+	CompressionGzip = "gzip" // Store manifest files gzip compressed
+	CompressionZstd = "zstd" // Store manifest files zstd compressed
+
+	// manifestArchiveSuffix is the suffix of per repository manifest archives
+	manifestArchiveSuffix = ".tar"
+)
+
+var (
+	// ManifestCompression is the compression of newly stored manifest files,
+	// files of all compressions are loaded.
+	ManifestCompression = CompressionNone
+	// ManifestArchive stores the manifest files of each repository in a single
+	// tar archive instead of one file per tag.
+	ManifestArchive = false
+)
+
+var compressionSuffixes = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// storeFlusher is implemented by manifest stores which buffer written files.
+type storeFlusher interface {
+	Flush() error
+}
+
+// flushManifests writes the buffered files of the manifest store.
+func flushManifests() {
+	if f, ok := storage.(storeFlusher); ok {
+		if err := f.Flush(); err != nil {
+			logrus.Errorf("failed to storage manifests: %s", err)
+		}
+	}
+}
+
+// manifestFlushInterval is the interval the buffered manifests are written at
+// while syncing, so an interrupted run keeps the manifests of synced images.
+const manifestFlushInterval = time.Minute
+
+// watchManifestFlush writes the buffered manifests every manifestFlushInterval
+// and once ctx is done until the returned stop func is called.
+func watchManifestFlush(ctx context.Context) func() {
+	if _, ok := storage.(storeFlusher); !ok {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(manifestFlushInterval)
+		defer ticker.Stop()
+		ctxDone := ctx.Done()
+		for {
+			select {
+			case <-ticker.C:
+				flushManifests()
+			case <-ctxDone:
+				// the sync stopped, keep the manifests of the synced images
+				ctxDone = nil
+				flushManifests()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// compressedStore compresses the stored files, the compression suffix
+// (.gz or .zst) is appended to the file names.
+type compressedStore struct {
+	manifestStore
+	compression string
+}
+
+func newCompressedStore(s manifestStore, compression string) (*compressedStore, error) {
+	if _, ok := compressionSuffixes[compression]; !ok && compression != CompressionNone {
+		return nil, fmt.Errorf("invalid manifest compression: %s", compression)
+	}
+	return &compressedStore{manifestStore: s, compression: compression}, nil
+}
+
+func (cs *compressedStore) Walk(fn func(name string, data []byte, modTime time.Time) error) error {
+	return cs.manifestStore.Walk(func(name string, data []byte, modTime time.Time) error {
+		for compression, suffix := range compressionSuffixes {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			bs, err := decompress(data, compression)
+			if err != nil {
+				return fmt.Errorf("failed to decompress %s: %s", name, err)
+			}
+			return fn(strings.TrimSuffix(name, suffix), bs, modTime)
+		}
+		return fn(name, data, modTime)
+	})
+}
+
+// Get reads the file of the current compression, then of the other
+// compressions and uncompressed.
+func (cs *compressedStore) Get(name string) ([]byte, error) {
+	r, ok := cs.manifestStore.(storeReader)
+	if !ok {
+		return nil, fmt.Errorf("manifest store does not read single files")
+	}
+	compressions := []string{cs.compression}
+	for compression := range compressionSuffixes {
+		if compression != cs.compression {
+			compressions = append(compressions, compression)
+		}
+	}
+	if cs.compression != CompressionNone {
+		compressions = append(compressions, CompressionNone)
+	}
+	for _, compression := range compressions {
+		data, err := r.Get(name + compressionSuffixes[compression])
+		if errors.Is(err, errStoreNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return decompress(data, compression)
+	}
+	return nil, errStoreNotFound
+}
+
+func (cs *compressedStore) Put(name string, data []byte) error {
+	if cs.compression == CompressionNone {
+		return cs.manifestStore.Put(name, data)
+	}
+	bs, err := compress(data, cs.compression)
+	if err != nil {
+		return err
+	}
+	return cs.manifestStore.Put(name+compressionSuffixes[cs.compression], bs)
+}
+
+// Delete removes the file of every compression.
+func (cs *compressedStore) Delete(name string) error {
+	if err := cs.manifestStore.Delete(name); err != nil {
+		return err
+	}
+	for _, suffix := range compressionSuffixes {
+		if err := cs.manifestStore.Delete(name + suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compress(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = enc.Close() }()
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
+
+func decompress(data []byte, compression string) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = r.Close() }()
+		return ioutil.ReadAll(r)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(data, nil)
+	default:
+		return data, nil
+	}
+}
+
+// archiveStore stores the files of each repository directory in a tar
+// archive named after the directory, e.g. gcr.io/google-containers/pause.tar.
+// Written files are buffered until Flush, only the archives of the
+// repositories written in this run are loaded, so updated archives keep
+// their other files, and they are dropped from memory once written.
+type archiveStore struct {
+	manifestStore
+
+	mu       sync.Mutex
+	archives map[string]map[string]archiveEntry // directory => file name => entry
+	dirty    map[string]bool
+}
+
+type archiveEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newArchiveStore(s manifestStore) *archiveStore {
+	return &archiveStore{
+		manifestStore: s,
+		archives:      make(map[string]map[string]archiveEntry),
+		dirty:         make(map[string]bool),
+	}
+}
+
+func (as *archiveStore) Walk(fn func(name string, data []byte, modTime time.Time) error) error {
+	return as.manifestStore.Walk(func(name string, data []byte, modTime time.Time) error {
+		if !strings.HasSuffix(name, manifestArchiveSuffix) {
+			return fn(name, data, modTime)
+		}
+		dir := strings.TrimSuffix(name, manifestArchiveSuffix)
+		return readArchive(name, data, func(file string, e archiveEntry) error {
+			return fn(path.Join(dir, file), e.data, e.modTime)
+		})
+	})
+}
+
+// readArchive calls fn with the name and entry of every file of the archive.
+func readArchive(name string, data []byte, fn func(file string, e archiveEntry) error) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid manifest archive %s: %s", name, err)
+		}
+		bs, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("invalid manifest archive %s: %s", name, err)
+		}
+		if err = fn(hdr.Name, archiveEntry{data: bs, modTime: hdr.ModTime}); err != nil {
+			return err
+		}
+	}
+}
+
+// load reads the stored archive of the directory unless it is loaded,
+// as.mu must be held.
+func (as *archiveStore) load(dir string) error {
+	if as.archives[dir] != nil {
+		return nil
+	}
+	r, ok := as.manifestStore.(storeReader)
+	if !ok {
+		return fmt.Errorf("manifest store does not read single files")
+	}
+	files := make(map[string]archiveEntry)
+	name := dir + manifestArchiveSuffix
+	data, err := r.Get(name)
+	if err != nil && !errors.Is(err, errStoreNotFound) {
+		return fmt.Errorf("failed to read manifest archive %s: %s", name, err)
+	}
+	if err == nil {
+		err = readArchive(name, data, func(file string, e archiveEntry) error {
+			files[file] = e
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	as.archives[dir] = files
+	return nil
+}
+
+func (as *archiveStore) Put(name string, data []byte) error {
+	dir := path.Dir(name)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err := as.load(dir); err != nil {
+		return err
+	}
+	as.archives[dir][path.Base(name)] = archiveEntry{data: data, modTime: time.Now().Truncate(time.Second)}
+	as.dirty[dir] = true
+	return nil
+}
+
+func (as *archiveStore) Delete(name string) error {
+	dir := path.Dir(name)
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err := as.load(dir); err != nil {
+		return err
+	}
+	if _, ok := as.archives[dir][path.Base(name)]; ok {
+		delete(as.archives[dir], path.Base(name))
+		as.dirty[dir] = true
+	}
+	return nil
+}
+
+// Flush writes the archives of the repositories with written files, the
+// written archives are dropped from memory and loaded again when written.
+func (as *archiveStore) Flush() error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	for dir := range as.dirty {
+		if len(as.archives[dir]) == 0 {
+			if err := as.manifestStore.Delete(dir + manifestArchiveSuffix); err != nil {
+				return err
+			}
+			delete(as.dirty, dir)
+			continue
+		}
+		files := make([]string, 0, len(as.archives[dir]))
+		for file := range as.archives[dir] {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, file := range files {
+			e := as.archives[dir][file]
+			hdr := &tar.Header{Name: file, Mode: 0644, Size: int64(len(e.data)), ModTime: e.modTime}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(e.data); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if err := as.manifestStore.Put(dir+manifestArchiveSuffix, buf.Bytes()); err != nil {
+			return err
+		}
+		delete(as.dirty, dir)
+	}
+	as.archives = make(map[string]map[string]archiveEntry)
+	return nil
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	confirmMu     sync.Mutex
+	confirmReader = bufio.NewReader(os.Stdin)
+)
+
+// confirm asks the yes/no question on the terminal before a destructive
+// operation, it is confirmed by opt.Yes and declined if stdin is not a terminal.
+func confirm(opt *SyncOption, format string, args ...interface{}) bool {
+	if opt.Yes {
+		return true
+	}
+	question := fmt.Sprintf(format, args...)
+	if !stdinTerminal() {
+		logrus.Warnf("%s: declined, stdin is not a terminal, use --yes to confirm", question)
+		return false
+	}
+
+	// concurrent workers ask one by one
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := confirmReader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// stdinTerminal reports whether stdin is a terminal the questions can be answered on.
+func stdinTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// checkConfirmOption fails the options which need a confirmation when it can
+// not be asked, instead of declining every destructive operation of the run.
+func checkConfirmOption(opt *SyncOption) error {
+	if opt.Yes || opt.Mode != ModeSync || opt.OnlyDownloadManifests || stdinTerminal() {
+		return nil
+	}
+	if opt.Force {
+		return fmt.Errorf("--force needs --yes when stdin is not a terminal")
+	}
+	if opt.RetainTags > 0 || opt.RetainDays > 0 {
+		return fmt.Errorf("--retain-tags and --retain-days need --yes when stdin is not a terminal")
+	}
+	return nil
+}
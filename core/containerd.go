@@ -0,0 +1,130 @@
+package core
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultContainerdAddress = "/run/containerd/containerd.sock"
+
+// checkContainerdOption returns the options which need a destination
+// registry and can not be used with the containerd destination. Images are
+// imported with the ctr CLI instead of the containerd client, which would
+// pull in the containerd module and its newer go and containers/image
+// versions, so ctr must be installed.
+func checkContainerdOption(opt *SyncOption) []error {
+	var errs []error
+	if _, err := exec.LookPath("ctr"); err != nil {
+		errs = append(errs, fmt.Errorf("the containerd destination needs ctr in PATH: %s", err))
+	}
+	registryOnly := []struct {
+		flag string
+		set  bool
+	}{
+		{"--copy-engine " + EngineCrane, opt.CopyEngine == EngineCrane},
+		{"--preserve-digests", opt.PreserveDigests},
+		{"--verify", opt.Verify},
+		{"--copy-referrers", opt.CopyReferrers},
+		{"--copy-signatures", opt.CopySignatures},
+		{"--cosign-key", opt.CosignKey != ""},
+		{"--notation-key", opt.NotationKey != ""},
+		{"--create-repos", opt.CreateRepos},
+		{"--hub-description", opt.HubDescription},
+		{"--dedup", opt.Dedup},
+	}
+	for _, o := range registryOnly {
+		if o.set {
+			errs = append(errs, fmt.Errorf("%s can not be used with the containerd destination", o.flag))
+		}
+	}
+	return errs
+}
+
+// containerdName returns the name of the image in the containerd image
+// store, the source name is kept so the pre-seeded images are found by the
+// workloads referencing them.
+func containerdName(image *Image) string {
+	return image.Repo + "/" + image.Repository()
+}
+
+// containerdLayout returns the temporary OCI layout reference which the
+// image is copied to before the import, the returned func removes it.
+func containerdLayout(image *Image) (types.ImageReference, string, func(), error) {
+	dir, err := ioutil.TempDir("", "imgsync-containerd")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	ref, err := ocilayout.NewReference(filepath.Join(dir, "layout"), image.Tag)
+	if err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	return ref, dir, cleanup, nil
+}
+
+// containerdImport archives the OCI layout of the image and imports it into
+// the containerd namespace with ctr.
+func containerdImport(ctx context.Context, image *Image, dir string, opt *SyncOption) error {
+	archive := filepath.Join(dir, "image.tar")
+	if err := tarDirectory(filepath.Join(dir, "layout"), archive); err != nil {
+		return fmt.Errorf("failed to archive image [%s] OCI layout: %s", image.String(), err)
+	}
+	env := []string{"CONTAINERD_ADDRESS=" + opt.ContainerdAddress, "CONTAINERD_NAMESPACE=" + opt.ContainerdNamespace}
+	_, err := runCommand(ctx, env, "ctr", "images", "import", "--all-platforms", "--base-name", containerdName(image), archive)
+	if err != nil {
+		return fmt.Errorf("failed to import image [%s] into containerd: %s", image.String(), err)
+	}
+	logrus.Debugf("imported %s:%s into containerd namespace %s", containerdName(image), image.Tag, opt.ContainerdNamespace)
+	return nil
+}
+
+// tarDirectory writes the files of the directory to the tar file.
+func tarDirectory(dir, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if err = tw.WriteHeader(hdr); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = src.Close() }()
+		_, err = copyBuffer(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
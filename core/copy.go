@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CopyImage copies the image reference src to dst with the sync machinery,
+// dst without tag keeps the source tag. The copy is skipped when the
+// destination already has the source digest.
+func CopyImage(ctx context.Context, src, dst string, opt *SyncOption) (Images, error) {
+	image, err := parseImage(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source image %s: %s", src, err)
+	}
+	named, err := reference.ParseNormalizedNamed(dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination image %s: %s", dst, err)
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return nil, fmt.Errorf("invalid destination image %s: digest references are not supported", dst)
+	}
+	opt.Destination = named.String()
+
+	// the manifests cache only knows the source, not the destination
+	delete(manifestsMap, image.String())
+	if !filtersPlatforms(opt) && upToDate(ctx, image, opt) {
+		image.Success = true
+		image.CacheHit = true
+		logrus.Infof("image [%s] is up to date: %s", copyDestination(image, opt).String(), image.Digest)
+		imgs := Images{image}
+		report(imgs, opt)
+		return imgs, nil
+	}
+	imgs := SyncImages(ctx, Images{image}, opt)
+	report(imgs, opt)
+	return imgs, nil
+}
+
+// copyDestination returns the destination image of opt.Destination.
+func copyDestination(image *Image, opt *SyncOption) *Image {
+	named, err := reference.ParseNormalizedNamed(opt.Destination)
+	if err != nil {
+		logrus.Fatalf("invalid destination image %s: %s", opt.Destination, err)
+	}
+	dest, err := parseImage(named.String())
+	if err != nil {
+		logrus.Fatalf("invalid destination image %s: %s", opt.Destination, err)
+	}
+	if _, tagged := named.(reference.Tagged); !tagged {
+		dest.Tag = destinationTag(image, opt)
+	}
+	return dest
+}
+
+// upToDate reports whether the destination has the source digest of the image,
+// lookup failures are not up to date.
+func upToDate(ctx context.Context, image *Image, opt *SyncOption) bool {
+	err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+		return limiter.do(ctx, func() error {
+			var gerr error
+			image.Digest, gerr = getManifestDigest(ctx, image.String(), &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}})
+			return gerr
+		})
+	})
+	if err != nil {
+		logrus.Debugf("failed to get image [%s] digest: %s", image.String(), err)
+		return false
+	}
+	dest := copyDestination(image, opt)
+	dgst, exists, err := newRegistryClient(dest.Repo, opt.User, opt.Password).headManifest(ctx, dest.Repository(), dest.Tag)
+	if err != nil {
+		logrus.Debugf("failed to get image [%s] digest: %s", dest.String(), err)
+		return false
+	}
+	return exists && dgst == image.Digest
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// cosign stores signatures, attestations and SBOMs of an image digest
+// in companion tags of the same repository, e.g. sha256-<hex>.sig
+var cosignTagSuffixes = []string{".sig", ".att", ".sbom"}
+
+func cosignTag(dgst digest.Digest, suffix string) string {
+	return strings.Replace(dgst.String(), ":", "-", 1) + suffix
+}
+
+// isCosignTag reports whether the tag is a cosign companion tag.
+func isCosignTag(tag string) bool {
+	for _, suffix := range cosignTagSuffixes {
+		if strings.HasPrefix(tag, "sha256-") && strings.HasSuffix(tag, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyCosignTags copies the cosign companion tags of the synced image digest.
+func copyCosignTags(ctx context.Context, image *Image, opt *SyncOption) error {
+	if image.Digest == "" || isCosignTag(image.Tag) {
+		return nil
+	}
+	client := newRegistryClient(image.Repo, "", "")
+	destImage := destinationImage(image, opt)
+	for _, suffix := range cosignTagSuffixes {
+		tag := cosignTag(image.Digest, suffix)
+		_, exists, err := client.headManifest(ctx, image.Repository(), tag)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		src := fmt.Sprintf("%s/%s:%s", image.Repo, image.Repository(), tag)
+		dest := fmt.Sprintf("%s/%s:%s", destImage.Repo, destImage.Repository(), tag)
+		logrus.Debugf("copy image [%s] cosign tag %s", image.String(), tag)
+		if err = copyReference(ctx, src, dest, opt); err != nil {
+			return fmt.Errorf("failed to copy image [%s] cosign tag %s: %s", image.String(), tag, err)
+		}
+	}
+	return nil
+}
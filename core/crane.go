@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EngineContainersImage = "containers-image" // Copy images with containers/image
+	EngineCrane           = "crane"            // Copy images with the go-containerregistry crane tool
+
+	// dockerHubAuthKey is the docker config auths key of docker hub
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+)
+
+// checkCraneOption returns the options which the crane engine does not
+// support. The engine runs the crane CLI instead of linking
+// go-containerregistry, its current releases need a newer go than this
+// module, so crane must be installed.
+func checkCraneOption(opt *SyncOption) []error {
+	var errs []error
+	if _, err := exec.LookPath("crane"); err != nil {
+		errs = append(errs, fmt.Errorf("the %s copy engine needs crane in PATH: %s", EngineCrane, err))
+	}
+	if opt.PolicyFile != "" {
+		errs = append(errs, fmt.Errorf("--policy is not supported by the %s copy engine", EngineCrane))
+	}
+	if opt.SkipWindows && !opt.PreserveDigests {
+		errs = append(errs, fmt.Errorf("--skip-windows is not supported by the %s copy engine", EngineCrane))
+	}
+	if opt.Recompress != "" {
+		errs = append(errs, fmt.Errorf("zstd layers recompression is not supported by the %s copy engine", EngineCrane))
+	}
+	if opt.BlobCacheContents {
+		errs = append(errs, fmt.Errorf("blob contents caching is not supported by the %s copy engine", EngineCrane))
+	}
+	if len(opt.Platforms) > 1 && !opt.PreserveDigests {
+		errs = append(errs, fmt.Errorf("the %s copy engine copies all platforms or a single platform", EngineCrane))
+	}
+	return errs
+}
+
+// craneCopy copies the image to the destination with crane, which streams
+// the layers from the source registry to the destination registry.
+func craneCopy(ctx context.Context, image, destImage *Image, opt *SyncOption) error {
+	if image.Schema1 && opt.Schema1 != Schema1Copy && !opt.PreserveDigests {
+		return fmt.Errorf("image [%s] schema1 manifest conversion is not supported by the %s copy engine", image.String(), EngineCrane)
+	}
+
+	configDir, err := tempDockerConfig(destImage.Repo, opt)
+	if err != nil {
+		return fmt.Errorf("failed to write crane docker config: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(configDir) }()
+
+	args := []string{"copy", sourceReference(image), destImage.String()}
+	if len(opt.Platforms) == 1 && !opt.PreserveDigests {
+		args = append(args, "--platform", opt.Platforms[0])
+	}
+	if opt.ParallelLayers > 0 {
+		args = append(args, "--jobs", strconv.Itoa(opt.ParallelLayers))
+	}
+	logrus.Debugf("copy %s with crane...", image.String())
+	_, err = runCommand(ctx, []string{"DOCKER_CONFIG=" + configDir}, "crane", args...)
+	return err
+}
+
+// tempDockerConfig writes the destination credentials to a temporary docker
+// config directory for the external tools (crane, cosign), so they are neither
+// passed as arguments nor stored in the docker config of the user.
+func tempDockerConfig(registry string, opt *SyncOption) (string, error) {
+	dir, err := ioutil.TempDir("", "imgsync-docker")
+	if err != nil {
+		return "", err
+	}
+	config := "{}"
+	if opt.User != "" {
+		key := registry
+		if key == defaultDockerRepo {
+			key = dockerHubAuthKey
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(opt.User + ":" + opt.Password))
+		config = fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, key, auth)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
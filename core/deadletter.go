@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// deadLetter is an image of the dead-letter file, the failed images stay in
+// the file across runs until they are synced.
+type deadLetter struct {
+	queueImage
+	Class    string    `json:"class"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Runs     int       `json:"runs"` // failed runs count
+	First    time.Time `json:"first_failed"`
+	Last     time.Time `json:"last_failed"`
+}
+
+// updateDeadLetters adds the images which failed after their retries to the
+// dead-letter file and removes the synced images from it. Images interrupted
+// by the end of the run are not dead letters.
+func updateDeadLetters(path string, images Images) error {
+	letters, err := loadDeadLetters(path)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*deadLetter, len(letters))
+	for i := range letters {
+		byName[letters[i].image().String()] = &letters[i]
+	}
+	now := time.Now().UTC()
+	var added, removed int
+	for _, img := range images {
+		name := img.String()
+		if img.Success {
+			if _, ok := byName[name]; ok {
+				delete(byName, name)
+				removed++
+			}
+			continue
+		}
+		if !img.Failed() || img.Err == nil || errors.Is(img.Err, context.Canceled) {
+			continue
+		}
+		l, ok := byName[name]
+		if !ok {
+			l = &deadLetter{queueImage: queueImage{Repo: img.Repo, User: img.User, Name: img.Name, Tag: img.Tag}, First: now}
+			byName[name] = l
+			added++
+		}
+		l.Class, l.Error, l.Attempts, l.Last = errorClassName(img.Err), img.Err.Error(), img.Attempts, now
+		l.Runs++
+	}
+
+	out := make([]deadLetter, 0, len(byName))
+	for _, l := range byName {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].image().String() < out[j].image().String() })
+	bs, err := jsoniter.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, bs, 0644); err != nil {
+		return err
+	}
+	logrus.Infof("dead letters: %d added, %d removed, %d total", added, removed, len(out))
+	return nil
+}
+
+// loadDeadLetters loads the dead-letter file, a missing file has no images.
+func loadDeadLetters(path string) ([]deadLetter, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil || len(bs) == 0 {
+		return nil, err
+	}
+	var letters []deadLetter
+	if err = jsoniter.Unmarshal(bs, &letters); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+func (l *deadLetter) image() *Image {
+	return &Image{Repo: l.Repo, User: l.User, Name: l.Name, Tag: l.Tag}
+}
+
+// imagesFrom returns the images of the dead-letter or failed images file
+// instead of listing the images.
+func imagesFrom(path string) Images {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.Fatalf("failed to read images file: %s", err)
+	}
+	var entries []queueImage
+	if err = jsoniter.Unmarshal(bs, &entries); err != nil {
+		logrus.Fatalf("invalid images file %s: %s", path, err)
+	}
+	images := make(Images, 0, len(entries))
+	for _, e := range entries {
+		images = append(images, &Image{Repo: e.Repo, User: e.User, Name: e.Name, Tag: e.Tag})
+	}
+	logrus.Infof("sync the images of %s: %d", path, len(images))
+	return images
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// digestDedup tracks the images being synced by destination repository and
+// source digest, tags of the same digest wait for the first one and are
+// then tagged on the destination instead of being copied again.
+type digestDedup struct {
+	mu      sync.Mutex
+	leaders map[string]*dedupLeader
+}
+
+type dedupLeader struct {
+	image *Image
+	done  chan struct{}
+}
+
+func newDigestDedup() *digestDedup {
+	return &digestDedup{leaders: make(map[string]*dedupLeader)}
+}
+
+// claim returns the leader image of the digest and whether the image is the
+// leader itself, the leader must call the returned release when it's done.
+func (d *digestDedup) claim(image *Image, opt *SyncOption) (*dedupLeader, func()) {
+	dest := destinationImage(image, opt)
+	key := dest.Repo + "/" + dest.Repository() + "@" + image.Digest.String()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if leader, ok := d.leaders[key]; ok {
+		return leader, nil
+	}
+	leader := &dedupLeader{image: image, done: make(chan struct{})}
+	d.leaders[key] = leader
+	return nil, func() { close(leader.done) }
+}
+
+// wait waits for the leader sync, it returns false if the leader failed.
+func (l *dedupLeader) wait(ctx context.Context) bool {
+	select {
+	case <-l.done:
+		return l.image.Success
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// tagDestination puts the destination manifest of the leader image to the
+// destination tag of the image.
+func tagDestination(ctx context.Context, leader, image *Image, opt *SyncOption) error {
+	src := destinationImage(leader, opt)
+	dest := destinationImage(image, opt)
+	logrus.Infof("tag %s => %s (same digest %s)", src.String(), dest.String(), image.Digest)
+
+	client := newRegistryClient(dest.Repo, opt.User, opt.Password)
+	ref := src.Tag
+	if leader.DestDigest != "" {
+		ref = leader.DestDigest.String()
+	}
+	mbs, mType, err := client.getManifest(ctx, src.Repository(), ref)
+	if err != nil {
+		return err
+	}
+	return client.putManifest(ctx, dest.Repository(), dest.Tag, mbs, mType)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
+)
+
+// manifestDiff describes the changes between the cached and the current
+// manifest of an image, e.g.
+//
+//	layers +2 -1, size +12.3MB, config changed
+//	platforms +linux-riscv64 -windows-amd64, changed linux-amd64
+func manifestDiff(old, cur interface{}) string {
+	switch o := old.(type) {
+	case manifest.Manifest:
+		c, ok := cur.(manifest.Manifest)
+		if !ok {
+			return "image manifest => manifest list"
+		}
+		return imageManifestDiff(o, c)
+	case manifest.List:
+		c, ok := cur.(manifest.List)
+		if !ok {
+			return "manifest list => image manifest"
+		}
+		return manifestListDiff(o, c)
+	case *compactManifest:
+		// compact manifests only tell the manifest type changes
+		if _, isList := cur.(manifest.List); isList != (o.platforms != nil) {
+			if isList {
+				return "image manifest => manifest list"
+			}
+			return "manifest list => image manifest"
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+func imageManifestDiff(old, cur manifest.Manifest) string {
+	oldLayers := make(map[digest.Digest]bool)
+	var oldSize, curSize int64
+	for _, layer := range old.LayerInfos() {
+		oldLayers[layer.Digest] = true
+		oldSize += layer.Size
+	}
+	var added, removed int
+	curLayers := make(map[digest.Digest]bool)
+	for _, layer := range cur.LayerInfos() {
+		curLayers[layer.Digest] = true
+		curSize += layer.Size
+		if !oldLayers[layer.Digest] {
+			added++
+		}
+	}
+	for d := range oldLayers {
+		if !curLayers[d] {
+			removed++
+		}
+	}
+
+	changes := []string{fmt.Sprintf("layers +%d -%d", added, removed)}
+	if delta := curSize - oldSize; delta >= 0 {
+		changes = append(changes, "size +"+humanSize(delta))
+	} else {
+		changes = append(changes, "size -"+humanSize(-delta))
+	}
+	if old.ConfigInfo().Digest != cur.ConfigInfo().Digest {
+		changes = append(changes, "config changed")
+	}
+	return strings.Join(changes, ", ")
+}
+
+func manifestListDiff(old, cur manifest.List) string {
+	oldPlatforms := make(map[string]digest.Digest)
+	for _, p := range listPlatforms(old) {
+		oldPlatforms[p.name] = p.digest
+	}
+	var added, removed, changed []string
+	curPlatforms := make(map[string]bool)
+	for _, p := range listPlatforms(cur) {
+		curPlatforms[p.name] = true
+		d, ok := oldPlatforms[p.name]
+		switch {
+		case !ok:
+			added = append(added, "+"+p.name)
+		case d != p.digest:
+			changed = append(changed, p.name)
+		}
+	}
+	for _, p := range listPlatforms(old) {
+		if !curPlatforms[p.name] {
+			removed = append(removed, "-"+p.name)
+		}
+	}
+
+	var changes []string
+	if len(added)+len(removed) > 0 {
+		changes = append(changes, "platforms "+strings.Join(append(added, removed...), " "))
+	}
+	if len(changed) > 0 {
+		changes = append(changes, "changed "+strings.Join(changed, " "))
+	}
+	if len(changes) == 0 {
+		return "manifest list changed"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// humanSize formats the byte size with decimal units, e.g. 12.3MB
+func humanSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	f := float64(size)
+	i := 0
+	for f >= 1000 && i < len(units)-1 {
+		f /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.1f%s", f, units[i])
+}
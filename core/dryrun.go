@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTransferRate is the estimated transfer rate per worker in MB/s
+	DefaultTransferRate = 10
+	// defaultImageOverhead is the estimated time of the registry requests of an image copy
+	defaultImageOverhead = 3 * time.Second
+)
+
+// runEstimate collects the blobs which a sync of the changed images transfers.
+type runEstimate struct {
+	mu    sync.Mutex
+	blobs map[*Image][]types.BlobInfo
+}
+
+func newRunEstimate() *runEstimate {
+	return &runEstimate{blobs: make(map[*Image][]types.BlobInfo)}
+}
+
+// add records the blobs of the image, the platform manifests of manifest
+// lists are fetched for their blobs.
+func (re *runEstimate) add(ctx context.Context, image *Image, m manifest.Manifest, l manifest.List, opt *SyncOption) error {
+	var blobs []types.BlobInfo
+	if m != nil {
+		blobs = manifestBlobs(m)
+	}
+	if l != nil {
+		sys := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
+		filter := newPlatformFilter(opt)
+		for _, p := range listPlatforms(l) {
+			if filter != nil && !filter.keep(p.platform) {
+				continue
+			}
+			var mbs []byte
+			err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+				return limiter.do(ctx, func() error {
+					var gerr error
+					mbs, gerr = getManifestBlob(ctx, fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), p.digest), sys)
+					return gerr
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get image [%s] platform %s manifest: %s", image.String(), p.name, err)
+			}
+			pm, err := manifest.FromBlob(mbs, manifest.GuessMIMEType(mbs))
+			if err != nil {
+				return fmt.Errorf("invalid image [%s] platform %s manifest: %s", image.String(), p.name, err)
+			}
+			blobs = append(blobs, manifestBlobs(pm)...)
+		}
+	}
+	re.mu.Lock()
+	re.blobs[image] = blobs
+	re.mu.Unlock()
+	return nil
+}
+
+func manifestBlobs(m manifest.Manifest) []types.BlobInfo {
+	blobs := []types.BlobInfo{m.ConfigInfo()}
+	for _, layer := range m.LayerInfos() {
+		blobs = append(blobs, layer.BlobInfo)
+	}
+	return blobs
+}
+
+// log logs the transfer size and the run time of syncing the images in
+// order with opt.Limit workers, blobs shared by images are transferred once.
+func (re *runEstimate) log(images Images, opt *SyncOption) {
+	rate := opt.TransferRate
+	if rate <= 0 {
+		rate = DefaultTransferRate
+	}
+	seen := make(map[digest.Digest]bool)
+	workers := make([]time.Duration, opt.Limit)
+	var count int
+	var total int64
+	for _, img := range images {
+		blobs, ok := re.blobs[img]
+		if !ok {
+			continue
+		}
+		count++
+		var size int64
+		for _, b := range blobs {
+			if b.Digest == "" || seen[b.Digest] || b.Size <= 0 {
+				continue
+			}
+			seen[b.Digest] = true
+			size += b.Size
+		}
+		total += size
+		// the next image starts on the first free worker
+		free := 0
+		for i := range workers {
+			if workers[i] < workers[free] {
+				free = i
+			}
+		}
+		workers[free] += defaultImageOverhead + time.Duration(float64(size)/(rate*1000*1000)*float64(time.Second))
+	}
+	var runTime time.Duration
+	for _, d := range workers {
+		if d > runTime {
+			runTime = d
+		}
+	}
+	logrus.Infof("dry run: %d images to sync, estimated transfer size %s of %d blobs, estimated run time %s with %d workers at %.1fMB/s",
+		count, humanSize(total), len(seen), runTime.Round(time.Second), opt.Limit, rate)
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+	v2 "github.com/docker/distribution/registry/api/v2"
+)
+
+// The error classes of the sync errors, errors are matched with errors.Is,
+// e.g. errors.Is(image.Err, ErrRateLimited).
+var (
+	ErrAuth            = errors.New("authentication failed")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrNotFound        = errors.New("not found")
+	ErrManifestInvalid = errors.New("invalid manifest or reference")
+	ErrTimeout         = errors.New("timeout")
+	ErrQuota           = errors.New("quota exceeded")
+)
+
+// errorClasses are the error classes in report order.
+var errorClasses = []error{ErrAuth, ErrRateLimited, ErrNotFound, ErrManifestInvalid, ErrTimeout, ErrQuota}
+
+// classError is an error of a known class, its message is the message of
+// the wrapped error.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+
+func (e *classError) Unwrap() error { return e.err }
+
+func (e *classError) Is(target error) bool { return target == e.class }
+
+// withClass returns err of the class, nil if err is nil.
+func withClass(class, err error) error {
+	if err == nil || class == nil {
+		return err
+	}
+	return &classError{class: class, err: err}
+}
+
+// classify returns err with its class, errors of unknown classes are
+// returned as is.
+func classify(err error) error {
+	if err == nil || errorClass(err) != nil {
+		return err
+	}
+	return withClass(detectClass(err), err)
+}
+
+// errorClass returns the class of the classified error, nil if err has no class.
+func errorClass(err error) error {
+	for _, class := range errorClasses {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	return nil
+}
+
+// errorClassNames are the names of the error classes in the reports and files.
+var errorClassNames = map[error]string{
+	ErrAuth:            "auth",
+	ErrRateLimited:     "rate-limited",
+	ErrNotFound:        "not found",
+	ErrManifestInvalid: "invalid manifest",
+	ErrTimeout:         "timeout",
+	ErrQuota:           "quota",
+}
+
+// errorOtherClass is the class name of errors of unknown classes.
+const errorOtherClass = "other"
+
+// errorClassName returns the class name of err, empty if err is nil.
+func errorClassName(err error) string {
+	if err == nil {
+		return ""
+	}
+	if name, ok := errorClassNames[errorClass(classify(err))]; ok {
+		return name
+	}
+	return errorOtherClass
+}
+
+// errorClassByName returns the error class of the class name, nil for
+// unknown names.
+func errorClassByName(name string) error {
+	for class, n := range errorClassNames {
+		if n == name {
+			return class
+		}
+	}
+	return nil
+}
+
+// The phases of the image sync errors.
+const (
+	PhaseList  = "list"
+	PhaseCheck = "check"
+	PhaseCopy  = "copy"
+	PhaseStore = "store"
+)
+
+// syncError is an error of an image sync phase with the source and the
+// destination references and the attempt number, e.g.
+//
+//	copy gcr.io/google-containers/pause:3.2 => docker.io/gcrxio/pause:3.2 (attempt 3): ...
+type syncError struct {
+	Phase   string
+	Source  string
+	Dest    string // empty before the destination is known, e.g. listing
+	Attempt int    // 0 if the phase is not retried
+	Err     error
+}
+
+func (e *syncError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Phase + " " + e.Source)
+	if e.Dest != "" {
+		b.WriteString(" => " + e.Dest)
+	}
+	if e.Attempt > 0 {
+		fmt.Fprintf(&b, " (attempt %d)", e.Attempt)
+	}
+	b.WriteString(": " + e.Err.Error())
+	return b.String()
+}
+
+func (e *syncError) Unwrap() error { return e.Err }
+
+// newSyncError returns err of the image sync phase, the destination is
+// derived from opt if set. The class of err is kept, errors which already
+// are sync errors are returned as is.
+func newSyncError(phase string, image *Image, opt *SyncOption, attempt int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var serr *syncError
+	if errors.As(err, &serr) {
+		return err
+	}
+	e := &syncError{Phase: phase, Source: image.String(), Attempt: attempt, Err: err}
+	if opt != nil {
+		e.Dest = destinationImage(image, opt).String()
+	}
+	return e
+}
+
+// listError returns the listing error of the image name.
+func listError(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &syncError{Phase: PhaseList, Source: name, Err: err}
+}
+
+// statusClass returns the error class of the registry response status.
+func statusClass(code int) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	default:
+		return nil
+	}
+}
+
+// statusError returns the error of the unexpected registry response status.
+func statusError(resp *http.Response, format string, args ...interface{}) error {
+	err := fmt.Errorf(format+", status: %s", append(args, resp.Status)...)
+	return withClass(statusClass(resp.StatusCode), err)
+}
+
+// detectClass returns the class of the containers/image, registry and
+// network errors.
+func detectClass(err error) error {
+	var uerr docker.ErrUnauthorizedForCredentials
+	if errors.As(err, &uerr) {
+		return ErrAuth
+	}
+	if errors.Is(err, docker.ErrTooManyRequests) {
+		return ErrRateLimited
+	}
+	var errs errcode.Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if class := errcodeClass(e); class != nil {
+				return class
+			}
+		}
+	}
+	if class := errcodeClass(err); class != nil {
+		return class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return ErrTimeout
+	}
+
+	// errors of the registries and tools which are not typed, the image
+	// references of sync errors are not matched
+	var serr *syncError
+	if errors.As(err, &serr) {
+		err = serr.Err
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "quota"):
+		return ErrQuota
+	case strings.Contains(msg, "toomanyrequests") || strings.Contains(msg, "too many requests"):
+		return ErrRateLimited
+	case strings.Contains(msg, "unauthorized") || strings.Contains(msg, "authentication required") || strings.Contains(msg, "denied"):
+		return ErrAuth
+	case strings.Contains(msg, "manifest unknown") || strings.Contains(msg, "name unknown") || strings.Contains(msg, "not found"):
+		return ErrNotFound
+	case strings.Contains(msg, "manifest invalid") || strings.Contains(msg, "name invalid"):
+		return ErrManifestInvalid
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out"):
+		return ErrTimeout
+	}
+	return nil
+}
+
+// errcodeClass returns the class of the registry error code.
+func errcodeClass(err error) error {
+	var coder errcode.ErrorCoder
+	if !errors.As(err, &coder) {
+		return nil
+	}
+	switch coder.ErrorCode() {
+	case errcode.ErrorCodeUnauthorized:
+		return ErrAuth
+	case errcode.ErrorCodeDenied:
+		if strings.Contains(strings.ToLower(err.Error()), "quota") {
+			return ErrQuota
+		}
+		return ErrAuth
+	case errcode.ErrorCodeTooManyRequests:
+		return ErrRateLimited
+	case v2.ErrorCodeManifestUnknown, v2.ErrorCodeNameUnknown, v2.ErrorCodeBlobUnknown, v2.ErrorCodeManifestBlobUnknown:
+		return ErrNotFound
+	case v2.ErrorCodeManifestInvalid, v2.ErrorCodeManifestUnverified, v2.ErrorCodeNameInvalid, v2.ErrorCodeTagInvalid, v2.ErrorCodeDigestInvalid:
+		return ErrManifestInvalid
+	}
+	return nil
+}
+
+// isPermanentError reports whether err will not recover by retrying, e.g.
+// invalid credentials or missing manifests. Rate limits, timeouts, server
+// errors and errors of unknown classes are retried.
+func isPermanentError(err error) bool {
+	switch errorClass(classify(err)) {
+	case ErrAuth, ErrNotFound, ErrManifestInvalid, ErrQuota:
+		return true
+	default:
+		return false
+	}
+}
+
+// isAuthError reports whether err is caused by invalid or missing credentials.
+func isAuthError(err error) bool {
+	return errors.Is(classify(err), ErrAuth)
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runCommand runs an external tool and returns its stdout, the stderr output
+// is included in the returned error.
+func runCommand(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// arguments may contain credentials, only log the sub command
+	if len(args) > 0 {
+		logrus.Debugf("exec: %s %s", name, args[0])
+	}
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"io/ioutil"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultFailedFile stores the failed images of the last run.
+const DefaultFailedFile = "imgsync_failed.json"
+
+type failedImage struct {
+	queueImage
+	Error string `json:"error,omitempty"`
+	Class string `json:"class,omitempty"`
+}
+
+// writeFailed writes the failed images of the run, a run without failures
+// writes an empty list.
+func writeFailed(path string, images Images) error {
+	failed := make([]failedImage, 0)
+	for _, img := range images {
+		if !img.Failed() {
+			continue
+		}
+		f := failedImage{queueImage: queueImage{Repo: img.Repo, User: img.User, Name: img.Name, Tag: img.Tag}}
+		if img.Err != nil {
+			f.Error, f.Class = img.Err.Error(), errorClassName(img.Err)
+		}
+		failed = append(failed, f)
+	}
+	bs, err := jsoniter.MarshalIndent(failed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// failedImages returns the failed images of the last run instead of listing the images.
+func failedImages(opt *SyncOption) Images {
+	bs, err := ioutil.ReadFile(opt.FailedFile)
+	if err != nil {
+		logrus.Fatalf("failed to read the failed images of the last run: %s", err)
+	}
+	var failed []failedImage
+	if err = jsoniter.Unmarshal(bs, &failed); err != nil {
+		logrus.Fatalf("invalid failed images file %s: %s", opt.FailedFile, err)
+	}
+	images := make(Images, 0, len(failed))
+	for _, f := range failed {
+		images = append(images, &Image{Repo: f.Repo, User: f.User, Name: f.Name, Tag: f.Tag})
+	}
+	logrus.Infof("retry the failed images of the last run: %d", len(images))
+	return images
+}
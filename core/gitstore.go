@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultGitCommitImages is the max count of changed images listed in the commit message.
+const defaultGitCommitImages = 100
+
+// ManifestGit commits the manifests dir to its git working tree after each
+// run, the commit is pushed when the branch tracks an upstream branch.
+var ManifestGit = false
+
+// commitManifests commits the changes of the manifests dir with a summary of
+// the synced images. It still runs after the sync is interrupted so the
+// progress is kept, failures are logged and do not fail the sync.
+func commitManifests(images Images) {
+	if !ManifestGit {
+		return
+	}
+	if isObjectStoreURL(ManifestDir) {
+		logrus.Warn("object storage manifests can not be committed to git")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCtxTimeout)
+	defer cancel()
+	git := func(args ...string) ([]byte, error) {
+		return runCommand(ctx, nil, "git", append([]string{"-C", ManifestDir}, args...)...)
+	}
+
+	status, err := git("status", "--porcelain", "--", ".")
+	if err != nil {
+		logrus.Errorf("failed to commit manifests: %s", err)
+		return
+	}
+	if len(strings.TrimSpace(string(status))) == 0 {
+		logrus.Info("manifests not changed, skip git commit")
+		return
+	}
+	if _, err = git("add", "--all", "--", "."); err != nil {
+		logrus.Errorf("failed to commit manifests: %s", err)
+		return
+	}
+	if _, err = git("commit", "--quiet", "-m", gitCommitMessage(images), "--", "."); err != nil {
+		logrus.Errorf("failed to commit manifests: %s", err)
+		return
+	}
+	logrus.Info("committed manifests changes")
+
+	if _, err = git("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"); err != nil {
+		logrus.Debug("manifests branch has no upstream, skip git push")
+		return
+	}
+	if _, err = git("push", "--quiet"); err != nil {
+		logrus.Errorf("failed to push manifests: %s", err)
+		return
+	}
+	logrus.Info("pushed manifests changes")
+}
+
+// gitCommitMessage returns the summary commit message of the synced images.
+func gitCommitMessage(images Images) string {
+	var synced, unchanged, failed, skipped int
+	var changed []string
+	for _, img := range images {
+		switch {
+		case img.Success && img.CacheHit:
+			unchanged++
+		case img.Success:
+			synced++
+			changed = append(changed, img.String())
+		case img.Skipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sync %d images: %d synced, %d unchanged, %d failed, %d skipped\n", len(images), synced, unchanged, failed, skipped)
+	if len(changed) > 0 {
+		b.WriteString("\n")
+	}
+	for i, name := range changed {
+		if i == defaultGitCommitImages {
+			fmt.Fprintf(&b, "... and %d more\n", len(changed)-i)
+			break
+		}
+		b.WriteString(name + "\n")
+	}
+	return b.String()
+}
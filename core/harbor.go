@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// harborClient is a minimal harbor v2 api client authorized with basic auth.
+type harborClient struct {
+	host     string
+	user     string
+	password string
+}
+
+func newHarborClient(host, user, password string) *harborClient {
+	return &harborClient{host: host, user: user, password: password}
+}
+
+// do sends a request with the JSON body to /api/v2.0/<path>.
+func (c *harborClient) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = jsoniter.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	addr := "https://" + c.host + "/api/v2.0" + path
+	req, err := http.NewRequest(method, addr, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	logrus.Tracef("%s %s", method, addr)
+	return registryHTTPClient.Do(req.WithContext(ctx))
+}
+
+// get decodes the JSON response of the path into v.
+func (c *harborClient) get(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("harbor api GET %s failed, status: %s", path, resp.Status)
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(bs, v)
+}
+
+// send sends the body to the path and checks the response status.
+func (c *harborClient) send(ctx context.Context, method, path string, body interface{}, statuses ...int) (*http.Response, error) {
+	resp, err := c.do(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp)
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	msg, _ := ioutil.ReadAll(resp.Body)
+	return nil, fmt.Errorf("harbor api %s %s failed, status: %s, %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// isHarbor reports whether the registry serves the harbor api.
+func (c *harborClient) isHarbor(ctx context.Context) (bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/ping", nil)
+	if err != nil {
+		return false, err
+	}
+	defer drainBody(resp)
+	pong, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode == http.StatusOK && strings.Contains(string(pong), "Pong"), nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultQuarantineRetry is the interval quarantined images are retried at.
+const DefaultQuarantineRetry = 24 * time.Hour
+
+// historyFile records the consecutive sync failures of images, e.g.
+//
+//	images:
+//	  gcr.io/google-containers/broken:v1.0.0:
+//	    failures: 3
+//	    last_attempt: 2020-05-01T08:00:00Z
+//	    error: manifest unknown
+//
+// Images are removed from the history once they sync successfully.
+type historyFile struct {
+	Images map[string]*failureRecord `yaml:"images"`
+}
+
+type failureRecord struct {
+	Failures    int       `yaml:"failures"`
+	LastAttempt time.Time `yaml:"last_attempt"`
+	Error       string    `yaml:"error,omitempty"`
+}
+
+// loadHistory loads the failure history, a missing file is an empty history.
+func loadHistory(path string) (map[string]*failureRecord, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return make(map[string]*failureRecord), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hf historyFile
+	if err = yaml.UnmarshalStrict(bs, &hf); err != nil {
+		return nil, fmt.Errorf("invalid history file %s: %s", path, err)
+	}
+	if hf.Images == nil {
+		hf.Images = make(map[string]*failureRecord)
+	}
+	return hf.Images, nil
+}
+
+// failureHistory loads the failure history of the option, it is nil without
+// history file.
+func failureHistory(opt *SyncOption) map[string]*failureRecord {
+	if opt.HistoryFile == "" {
+		return nil
+	}
+	history, err := loadHistory(opt.HistoryFile)
+	if err != nil {
+		logrus.Fatalf("failed to load failure history: %s", err)
+	}
+	return history
+}
+
+// writeHistory updates the failure history with the results of the synced
+// images, images which have not been attempted keep their records.
+func writeHistory(path string, history map[string]*failureRecord, images Images) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, img := range images {
+		switch {
+		case img.Success:
+			delete(history, img.String())
+		case img.Failed():
+			r := history[img.String()]
+			if r == nil {
+				r = &failureRecord{}
+				history[img.String()] = r
+			}
+			r.Failures++
+			r.LastAttempt = now
+			r.Error = ""
+			if img.Err != nil {
+				r.Error = img.Err.Error()
+			}
+		}
+	}
+	bs, err := yaml.Marshal(&historyFile{Images: history})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// deprioritizeFailures moves the images which failed in the previous runs to
+// the back of the list, the fewer failures the earlier.
+func deprioritizeFailures(images Images, history map[string]*failureRecord) {
+	failures := func(img *Image) int {
+		if r := history[img.String()]; r != nil {
+			return r.Failures
+		}
+		return 0
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return failures(images[i]) < failures(images[j])
+	})
+}
+
+// quarantined reports whether the image failed opt.QuarantineAfter times in a
+// row and is not due to be retried yet.
+func quarantined(img *Image, history map[string]*failureRecord, opt *SyncOption) (*failureRecord, bool) {
+	r := history[img.String()]
+	if opt.QuarantineAfter <= 0 || r == nil || r.Failures < opt.QuarantineAfter {
+		return r, false
+	}
+	retry := opt.QuarantineRetry
+	if retry == 0 {
+		retry = DefaultQuarantineRetry
+	}
+	return r, time.Since(r.LastAttempt) < retry
+}
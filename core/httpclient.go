@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPHook is called after every request of the shared http client with the
+// response or the error and the duration of the request.
+type HTTPHook func(req *http.Request, resp *http.Response, err error, d time.Duration)
+
+var (
+	httpHooksMu sync.RWMutex
+	httpHooks   []HTTPHook
+)
+
+// OnHTTPRequest registers the hook of the shared http client requests, e.g.
+// to export request metrics.
+func OnHTTPRequest(hook HTTPHook) {
+	httpHooksMu.Lock()
+	httpHooks = append(httpHooks, hook)
+	httpHooksMu.Unlock()
+}
+
+// registryHTTPClient is the http client shared by all registry, docker hub,
+// harbor and api requests.
+var registryHTTPClient = &http.Client{
+	Timeout:   DefaultHTTPTimeout,
+	Transport: &instrumentedTransport{next: sharedTransport},
+}
+
+// uploadHTTPClient is the http client of the blob uploads, the uploads are
+// only bounded by the image timeout instead of the request timeout.
+var uploadHTTPClient = &http.Client{Transport: registryHTTPClient.Transport}
+
+// instrumentedTransport observes the registry rate limits of the responses
+// and runs the hooks of the requests.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	d := time.Since(start)
+	if err == nil {
+		limiter.observe(resp)
+	}
+	httpHooksMu.RLock()
+	for _, hook := range httpHooks {
+		hook(req, resp, err, d)
+	}
+	httpHooksMu.RUnlock()
+	return resp, err
+}
+
+// httpGet gets the body of the address, network errors and server errors
+// are retried.
+func httpGet(ctx context.Context, addr string, header http.Header) (*http.Response, []byte, error) {
+	var resp *http.Response
+	var body []byte
+	err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+		req, err := http.NewRequest(http.MethodGet, addr, nil)
+		if err != nil {
+			return err
+		}
+		for k, vs := range header {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+		logrus.Tracef("GET %s", addr)
+		resp, err = registryHTTPClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("GET %s: %s", addr, resp.Status)
+		}
+		return nil
+	})
+	return resp, body, err
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHTTPMaxConnsPerHost limits the connections to a single host, so
+	// the workers of a run do not flood one registry.
+	DefaultHTTPMaxConnsPerHost = 32
+
+	// dnsCacheTTL is the time the resolved registry addresses are reused
+	dnsCacheTTL = 5 * time.Minute
+)
+
+// sharedTransport is the http transport of the shared http client,
+// connections are kept alive and reused between the requests.
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&dnsCache{dialer: &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          256,
+	MaxIdleConnsPerHost:   DefaultHTTPMaxConnsPerHost,
+	MaxConnsPerHost:       DefaultHTTPMaxConnsPerHost,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// dnsCache caches the resolved addresses of the hosts, listing tens of
+// thousands of tags resolves the same registry hosts for every connection.
+type dnsCache struct {
+	dialer *net.Dialer
+	mu     sync.Mutex
+	hosts  map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// DialContext dials the cached addresses of the host, in order until one
+// connects. Addresses are resolved again when the cache expired or none of
+// them connects.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range addrs {
+		var conn net.Conn
+		if conn, err = c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	c.mu.Lock()
+	delete(c.hosts, host)
+	c.mu.Unlock()
+	return nil, err
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	e, ok := c.hosts[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, nil
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]dnsEntry)
+	}
+	c.hosts[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(dnsCacheTTL)}
+	c.mu.Unlock()
+	return addrs, nil
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dockerHubAPI = "https://hub.docker.com/v2"
+
+	// hubShortDescriptionMax is the max length of docker hub short descriptions
+	hubShortDescriptionMax = 100
+	// hubDescriptionTagsMax limits the synced tags listed in full descriptions
+	hubDescriptionTagsMax = 50
+)
+
+// hubClient is a docker hub api client, it logs in once with the user credentials.
+type hubClient struct {
+	user     string
+	password string
+
+	once     sync.Once
+	token    string
+	loginErr error
+}
+
+func newHubClient(user, password string) *hubClient {
+	return &hubClient{user: user, password: password}
+}
+
+func (c *hubClient) login(ctx context.Context) error {
+	c.once.Do(func() {
+		body, _ := jsoniter.Marshal(struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}{c.user, c.password})
+		req, err := http.NewRequest(http.MethodPost, dockerHubAPI+"/users/login/", bytes.NewReader(body))
+		if err != nil {
+			c.loginErr = err
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := registryHTTPClient.Do(req.WithContext(ctx))
+		if err != nil {
+			c.loginErr = err
+			return
+		}
+		defer drainBody(resp)
+		if resp.StatusCode != http.StatusOK {
+			c.loginErr = fmt.Errorf("failed to log in to docker hub, status: %s", resp.Status)
+			return
+		}
+		var buf bytes.Buffer
+		if _, err = buf.ReadFrom(resp.Body); err != nil {
+			c.loginErr = err
+			return
+		}
+		c.token = jsoniter.Get(buf.Bytes(), "token").ToString()
+		RegisterToken(dockerHubAPI, c.token)
+	})
+	return c.loginErr
+}
+
+// do sends an authorized request to the docker hub api path.
+func (c *hubClient) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	if err := c.login(ctx); err != nil {
+		return nil, err
+	}
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = jsoniter.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, dockerHubAPI+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "JWT "+c.token)
+	logrus.Tracef("%s %s", method, req.URL)
+	return registryHTTPClient.Do(req.WithContext(ctx))
+}
+
+// setDescription sets the short and full description of the repository.
+func (c *hubClient) setDescription(ctx context.Context, repo, short, full string) error {
+	resp, err := c.do(ctx, http.MethodPatch, "/repositories/"+repo+"/", struct {
+		Description     string `json:"description"`
+		FullDescription string `json:"full_description"`
+	}{short, full})
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to set docker hub repository %s description, status: %s", repo, resp.Status)
+	}
+	return nil
+}
+
+// repositoryExists reports whether the repository exists.
+func (c *hubClient) repositoryExists(ctx context.Context, repo string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/repositories/"+repo+"/", nil)
+	if err != nil {
+		return false, err
+	}
+	defer drainBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to get docker hub repository %s, status: %s", repo, resp.Status)
+}
+
+// createRepository creates the repository of the namespace with the visibility.
+func (c *hubClient) createRepository(ctx context.Context, namespace, name string, private bool) error {
+	resp, err := c.do(ctx, http.MethodPost, "/repositories/", struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		IsPrivate bool   `json:"is_private"`
+	}{namespace, name, private})
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to create docker hub repository %s/%s, status: %s", namespace, name, resp.Status)
+	}
+	return nil
+}
+
+// hubDescriptions returns the short and full description of the mirror repository.
+func hubDescriptions(source string, tags []string, synced time.Time) (string, string) {
+	date := synced.UTC().Format("2006-01-02")
+	short := fmt.Sprintf("Mirror of %s, last synced %s", source, date)
+	if len(short) > hubShortDescriptionMax {
+		short = fmt.Sprintf("Mirror of %s", source)
+	}
+	if len(short) > hubShortDescriptionMax {
+		short = short[:hubShortDescriptionMax]
+	}
+
+	var full bytes.Buffer
+	fmt.Fprintf(&full, "# %s\n\n", source)
+	fmt.Fprintf(&full, "This repository is a mirror of [%s](https://%s), synced by [imgsync](https://github.com/mritd/imgsync).\n\n", source, source)
+	fmt.Fprintf(&full, "Last synced: %s UTC\n\n", synced.UTC().Format("2006-01-02 15:04:05"))
+	if len(tags) > 0 {
+		full.WriteString("Tags synced by the last run:\n\n")
+		for i, tag := range tags {
+			if i == hubDescriptionTagsMax {
+				fmt.Fprintf(&full, "- ... and %d more\n", len(tags)-i)
+				break
+			}
+			fmt.Fprintf(&full, "- `%s`\n", tag)
+		}
+	}
+	return short, full.String()
+}
+
+// describeRepositories sets the docker hub descriptions of the destination
+// repositories which images have been synced to by the run.
+func describeRepositories(ctx context.Context, images Images, opt *SyncOption) {
+	type repository struct {
+		repo, source string
+		tags         []string
+	}
+	var repos []*repository
+	seen := make(map[string]*repository)
+	for _, img := range images {
+		if !img.Success || img.Skipped {
+			continue
+		}
+		dest := destinationImage(img, opt)
+		if dest.Repo != defaultDockerRepo {
+			continue
+		}
+		r, ok := seen[dest.Repository()]
+		if !ok {
+			r = &repository{repo: dest.Repository(), source: img.Repo + "/" + img.Repository()}
+			seen[r.repo] = r
+			repos = append(repos, r)
+		}
+		r.tags = append(r.tags, dest.Tag)
+	}
+	if len(repos) == 0 {
+		return
+	}
+
+	client := newHubClient(opt.User, opt.Password)
+	now := time.Now()
+	for _, r := range repos {
+		short, full := hubDescriptions(r.source, r.tags, now)
+		err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+			return client.setDescription(ctx, r.repo, short, full)
+		})
+		if err != nil {
+			logrus.Errorf("failed to describe docker hub repository %s: %s", r.repo, err)
+			continue
+		}
+		logrus.Debugf("described docker hub repository %s", r.repo)
+	}
+}
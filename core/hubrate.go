@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultHubRateInterval = 10 * time.Minute
+	DefaultHubRateReserve  = 10
+
+	// hubRateRepo is the docker hub repository whose manifest HEAD requests
+	// return the rate limit headers without consuming a pull
+	hubRateRepo = "ratelimitpreview/test"
+)
+
+// hubRateStatus is the docker hub pull rate limit status of the account.
+type hubRateStatus struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+	Source    string
+	Checked   time.Time
+}
+
+func (s *hubRateStatus) String() string {
+	status := fmt.Sprintf("%d/%d pulls remaining per %s", s.Remaining, s.Limit, s.Window)
+	if s.Source != "" {
+		status += ", source " + s.Source
+	}
+	return status
+}
+
+// queryHubRate queries the pull rate limit status of the docker hub account,
+// anonymous status of the ip address without opt.User.
+func queryHubRate(ctx context.Context, opt *SyncOption) (*hubRateStatus, error) {
+	client := newRegistryClient(defaultDockerRepo, opt.User, opt.Password)
+	resp, err := client.do(ctx, http.MethodHead, hubRateRepo, "manifests/latest", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query docker hub rate limit, status: %s", resp.Status)
+	}
+	limit, window, ok := parseRateLimit(resp.Header.Get("RateLimit-Limit"))
+	if !ok {
+		// accounts without pull limits do not return the headers
+		return nil, nil
+	}
+	remaining, _, _ := parseRateLimit(resp.Header.Get("RateLimit-Remaining"))
+	return &hubRateStatus{
+		Limit:     limit,
+		Remaining: remaining,
+		Window:    window,
+		Source:    resp.Header.Get("Docker-RateLimit-Source"),
+		Checked:   time.Now(),
+	}, nil
+}
+
+// hubRate is the docker hub rate limit state of the run shown in the report.
+var hubRate struct {
+	sync.Mutex
+	start, last *hubRateStatus
+	deferred    int
+}
+
+// hubQuota is the pull budget of the docker hub source images, images which
+// exceed the budget are left to the next run.
+type hubQuota struct {
+	mu      sync.Mutex
+	budget  int
+	reserve int
+}
+
+// newHubQuota checks the docker hub pull rate limit before the run, it
+// returns nil if the check is disabled or the account has no pull limit.
+func newHubQuota(ctx context.Context, opt *SyncOption) *hubQuota {
+	if !opt.HubRateCheck || opt.OnlyDownloadManifests {
+		return nil
+	}
+	q := &hubQuota{reserve: opt.HubRateReserve}
+	status, err := queryHubRate(ctx, opt)
+	if err != nil {
+		logrus.Warnf("failed to check docker hub pull rate limit: %s", err)
+		return nil
+	}
+	if status == nil {
+		logrus.Info("docker hub pull rate is not limited")
+		return nil
+	}
+	hubRate.Lock()
+	hubRate.start, hubRate.last, hubRate.deferred = status, status, 0
+	hubRate.Unlock()
+	q.update(status)
+	logrus.Infof("docker hub pull rate: %s", status)
+	if q.budget <= 0 {
+		logrus.Warnf("docker hub pull quota is exhausted, the docker hub images are left to the next run")
+	}
+	return q
+}
+
+func (q *hubQuota) update(status *hubRateStatus) {
+	q.mu.Lock()
+	q.budget = status.Remaining - q.reserve
+	q.mu.Unlock()
+}
+
+// watch queries the rate limit status every opt.HubRateInterval, the budget
+// follows the remaining pulls reported by docker hub.
+func (q *hubQuota) watch(ctx context.Context, opt *SyncOption) func() {
+	if q == nil || opt.HubRateInterval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(opt.HubRateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				status, err := queryHubRate(ctx, opt)
+				if err != nil || status == nil {
+					logrus.Debugf("failed to query docker hub pull rate limit: %v", err)
+					continue
+				}
+				hubRate.Lock()
+				hubRate.last = status
+				hubRate.Unlock()
+				q.update(status)
+				logrus.Debugf("docker hub pull rate: %s", status)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// take reports whether the image can be synced within the pull budget,
+// images of other registries are not limited.
+func (q *hubQuota) take(image *Image) bool {
+	if q == nil || image.Repo != defaultDockerRepo {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.budget <= 0 {
+		hubRate.Lock()
+		hubRate.deferred++
+		hubRate.Unlock()
+		return false
+	}
+	q.budget--
+	return true
+}
+
+// hubRateReport returns the docker hub rate limit section of the report.
+func hubRateReport() string {
+	hubRate.Lock()
+	defer hubRate.Unlock()
+	if hubRate.start == nil {
+		return ""
+	}
+	return fmt.Sprintf(reportHubRateTpl, hubRate.start, hubRate.last, hubRate.deferred)
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// manifestIndex is the index of the manifest store exported by ExportIndex.
+type manifestIndex struct {
+	Generated time.Time    `json:"generated"`
+	Images    []indexImage `json:"images"`
+}
+
+type indexImage struct {
+	Name string     `json:"name"`
+	Tags []indexTag `json:"tags"`
+}
+
+type indexTag struct {
+	Tag       string        `json:"tag"`
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"media_type"`
+	Size      int64         `json:"size,omitempty"`
+	Platforms []string      `json:"platforms,omitempty"`
+	Synced    time.Time     `json:"synced"`
+}
+
+// ExportIndex renders the manifest store of ManifestDir into dir/index.json,
+// and a searchable dir/index.html page with html.
+func ExportIndex(dir string, html bool) error {
+	s, err := openManifestStore(ManifestDir)
+	if err != nil {
+		return err
+	}
+	index, err := buildIndex(s)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	bs, err := jsoniter.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "index.json"), bs, 0644); err != nil {
+		return err
+	}
+	if html {
+		var buf bytes.Buffer
+		if err = indexHTMLTpl.Execute(&buf, index); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, "index.html"), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("exported manifests index, images count: %d", len(index.Images))
+	return nil
+}
+
+func buildIndex(s manifestStore) (*manifestIndex, error) {
+	images := make(map[string][]indexTag)
+	err := s.Walk(func(name string, mbs []byte, modTime time.Time) error {
+		if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, sbomFileSuffix) ||
+			strings.HasSuffix(name, platformFileSuffix) || strings.HasSuffix(name, configFileSuffix) {
+			return nil
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return nil
+		}
+		mType := manifest.GuessMIMEType(mbs)
+		if mType == "" {
+			return nil
+		}
+		dgst, err := manifest.Digest(mbs)
+		if err != nil {
+			logrus.Debugf("failed to digest manifest file %s: %s", name, err)
+			return nil
+		}
+		tag := indexTag{
+			Tag:       strings.TrimSuffix(name[i+1:], ".json"),
+			Digest:    dgst,
+			MediaType: mType,
+			Synced:    modTime.UTC().Truncate(time.Second),
+		}
+		if manifest.MIMETypeIsMultiImage(mType) {
+			if l, lerr := manifest.ListFromBlob(mbs, mType); lerr == nil {
+				for _, p := range listPlatforms(l) {
+					tag.Platforms = append(tag.Platforms, p.name)
+				}
+			}
+		} else if m, merr := manifest.FromBlob(mbs, mType); merr == nil {
+			// schema1 manifests have no config and unknown(-1) layer sizes
+			if size := m.ConfigInfo().Size; size > 0 {
+				tag.Size = size
+			}
+			for _, layer := range m.LayerInfos() {
+				if layer.Size > 0 {
+					tag.Size += layer.Size
+				}
+			}
+		}
+		images[name[:i]] = append(images[name[:i]], tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index := &manifestIndex{Generated: time.Now().UTC().Truncate(time.Second)}
+	for name, tags := range images {
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+		index.Images = append(index.Images, indexImage{Name: name, Tags: tags})
+	}
+	sort.Slice(index.Images, func(i, j int) bool { return index.Images[i].Name < index.Images[j].Name })
+	return index, nil
+}
+
+var indexHTMLTpl = template.Must(template.New("index").Funcs(template.FuncMap{
+	"size": func(size int64) string {
+		if size == 0 {
+			return ""
+		}
+		return humanSize(size)
+	},
+	"join": strings.Join,
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>imgsync mirrored images</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+input { width: 100%; padding: .5em; margin-bottom: 1em; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { border-bottom: 1px solid #ddd; padding: .3em .6em; text-align: left; }
+td.digest { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Mirrored images</h1>
+<p>Generated {{time .Generated}} UTC</p>
+<input id="search" type="search" placeholder="Search images, tags or digests">
+<table>
+<thead><tr><th>Image</th><th>Tag</th><th>Digest</th><th>Size</th><th>Platforms</th><th>Last synced</th></tr></thead>
+<tbody id="images">
+{{range $img := .Images}}{{range .Tags}}<tr><td>{{$img.Name}}</td><td>{{.Tag}}</td><td class="digest">{{.Digest}}</td><td>{{size .Size}}</td><td>{{join .Platforms " "}}</td><td>{{time .Synced}}</td></tr>
+{{end}}{{end}}</tbody>
+</table>
+<script>
+document.getElementById("search").addEventListener("input", function (e) {
+  var q = e.target.value.toLowerCase();
+  var rows = document.getElementById("images").rows;
+  for (var i = 0; i < rows.length; i++) {
+    rows[i].style.display = rows[i].textContent.toLowerCase().indexOf(q) >= 0 ? "" : "none";
+  }
+});
+</script>
+</body>
+</html>
+`))
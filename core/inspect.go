@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/panjf2000/ants/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ModeSync   = ""       // Sync the images
+	ModeList   = "list"   // Only print the image names
+	ModeDiff   = "diff"   // Print the images whose upstream manifest differs from the stored manifest
+	ModeVerify = "verify" // Verify the destination digests of the images
+
+	ModeReplicate = "replicate" // Create harbor replication policies of the images instead of syncing them
+	ModeSkopeo    = "skopeo"    // Export the images as skopeo sync YAML
+)
+
+// listImages prints the image names to stdout.
+func listImages(images Images, opt *SyncOption) Images {
+	for _, img := range images {
+		img.Success = true
+	}
+	if err := printImages(images, opt); err != nil {
+		logrus.Errorf("failed to print images: %s", err)
+	}
+	return images
+}
+
+// inspectImages diffs or verifies the images with opt.Mode, nothing is
+// synced and the manifests storage is not changed.
+func inspectImages(ctx context.Context, images Images, opt *SyncOption) Images {
+	pool, err := ants.NewPool(opt.Limit, ants.WithPreAlloc(true), ants.WithPanicHandler(logPanic))
+	if err != nil {
+		logrus.Fatalf("failed to create goroutines pool: %s", err)
+	}
+	defer pool.Release()
+
+	var estimate *runEstimate
+	if opt.DryRun {
+		estimate = newRunEstimate()
+	}
+	wg := new(sync.WaitGroup)
+	for _, img := range images {
+		image := img
+		wg.Add(1)
+		err = pool.Submit(func() {
+			defer wg.Done()
+			select {
+			case <-ctx.Done():
+				image.Err = ctx.Err()
+			default:
+				if tag := destinationTag(image, opt); tag != image.Tag {
+					image.DestTag = tag
+				}
+				if opt.Mode == ModeDiff {
+					diffImage(ctx, image, estimate, opt)
+				} else {
+					verifyImage(ctx, image, opt)
+				}
+			}
+		})
+		if err != nil {
+			logrus.Fatalf("failed to submit task: %s", err)
+		}
+	}
+	wg.Wait()
+
+	if err = printImages(images, opt); err != nil {
+		logrus.Errorf("failed to print images: %s", err)
+	}
+	if estimate != nil {
+		estimate.log(images, opt)
+	}
+	return images
+}
+
+// diffImage compares the upstream manifest of the image with the stored
+// manifest, the blobs of changed images are added to the estimate.
+func diffImage(ctx context.Context, image *Image, estimate *runEstimate, opt *SyncOption) {
+	m, l, _, changed := checkSync(ctx, image, opt)
+	if !changed {
+		return
+	}
+	if estimate != nil {
+		if err := estimate.add(ctx, image, m, l, opt); err != nil {
+			image.Err = classify(newSyncError(PhaseCheck, image, opt, 0, err))
+			logrus.Error(image.Err)
+			return
+		}
+	}
+	image.Success = true
+}
+
+// verifyImage compares the destination digest of the image with the upstream digest.
+func verifyImage(ctx context.Context, image *Image, opt *SyncOption) {
+	var l manifest.List
+	var attempt int
+	err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+		attempt++
+		return limiter.do(ctx, func() error {
+			m, ml, mbs, merr := getImageManifest(ctx, image.String())
+			if merr != nil {
+				return merr
+			}
+			_, image.Schema1 = m.(*manifest.Schema1)
+			l = ml
+			image.Digest, merr = manifest.Digest(mbs)
+			return merr
+		})
+	})
+	if err != nil {
+		image.Err = classify(newSyncError(PhaseCheck, image, opt, attempt, fmt.Errorf("failed to get manifest: %w", err)))
+		logrus.Error(image.Err)
+		return
+	}
+	if l != nil && filtersPlatforms(opt) {
+		image.Skip("filtered manifest lists can not be verified")
+		return
+	}
+	// mismatched digests are not retried
+	if err = limiter.do(ctx, func() error { return verifyDigest(ctx, image, opt) }); err != nil {
+		image.Err = classify(newSyncError(PhaseCheck, image, opt, 0, err))
+		logrus.Error(image.Err)
+		return
+	}
+	image.Success = true
+}
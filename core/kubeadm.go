@@ -0,0 +1,227 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultK8sRegistry is the registry kubeadm pulls control plane images from since v1.25,
+// it also serves all images released to k8s.gcr.io before.
+const defaultK8sRegistry = "registry.k8s.io"
+
+// kubeadmDependencies are the pause, etcd and coredns tags kubeadm requires
+// for each kubernetes minor release (kubeadm constants of the .0 release),
+// they are used when the kubeadm binary is not installed, is of another
+// minor release or does not support the version.
+var kubeadmDependencies = map[int][3]string{
+	17: {"3.1", "3.4.3-0", "1.6.5"},
+	18: {"3.2", "3.4.3-0", "1.6.7"},
+	19: {"3.2", "3.4.13-0", "1.7.0"},
+	20: {"3.2", "3.4.13-0", "1.7.0"},
+	21: {"3.4.1", "3.4.13-0", "v1.8.0"},
+	22: {"3.5", "3.5.0-0", "v1.8.4"},
+	23: {"3.6", "3.5.1-0", "v1.8.6"},
+	24: {"3.7", "3.5.3-0", "v1.8.6"},
+	25: {"3.8", "3.5.4-0", "v1.9.3"},
+	26: {"3.9", "3.5.6-0", "v1.9.3"},
+	27: {"3.9", "3.5.7-0", "v1.10.1"},
+	28: {"3.9", "3.5.9-0", "v1.10.1"},
+	29: {"3.9", "3.5.10-0", "v1.11.1"},
+	30: {"3.9", "3.5.12-0", "v1.11.1"},
+	31: {"3.10", "3.5.15-0", "v1.11.3"},
+}
+
+// errKubeadmMinor is returned when the kubeadm binary is of another minor
+// release, kubeadm lists the dependency tags of its own release constants.
+var errKubeadmMinor = errors.New("kubeadm is of another minor release")
+
+var kubeadmControlPlaneImages = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler", "kube-proxy"}
+
+// k8sVersion is a kubernetes release version, e.g. v1.29.2
+type k8sVersion struct {
+	major, minor, patch int
+}
+
+func parseK8sVersion(s string) (k8sVersion, error) {
+	var v k8sVersion
+	ss := strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "v"), ".")
+	if len(ss) != 3 {
+		return v, fmt.Errorf("invalid kubernetes version: %s", s)
+	}
+	nums := make([]int, 3)
+	for i, n := range ss {
+		var err error
+		if nums[i], err = strconv.Atoi(n); err != nil {
+			return v, fmt.Errorf("invalid kubernetes version: %s", s)
+		}
+	}
+	return k8sVersion{major: nums[0], minor: nums[1], patch: nums[2]}, nil
+}
+
+func (v k8sVersion) less(o k8sVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	return v.patch < o.patch
+}
+
+func (v k8sVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// kubeadmVersions resolves the comma separated versions and version ranges
+// (e.g. v1.28.0..v1.29.2), the patch releases of ranges are discovered from
+// the kube-apiserver tags.
+func kubeadmVersions(ctx context.Context, spec string) ([]k8sVersion, error) {
+	var versions []k8sVersion
+	var releases []k8sVersion
+	for _, s := range strings.Split(spec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		bounds := strings.SplitN(s, "..", 2)
+		from, err := parseK8sVersion(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) == 1 {
+			versions = append(versions, from)
+			continue
+		}
+		to, err := parseK8sVersion(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if releases == nil {
+			if releases, err = kubeadmReleases(ctx); err != nil {
+				return nil, err
+			}
+		}
+		for _, v := range releases {
+			if !v.less(from) && !to.less(v) {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions, nil
+}
+
+func kubeadmReleases(ctx context.Context) ([]k8sVersion, error) {
+	var tags []string
+	err := limiter.do(ctx, func() error {
+		var lerr error
+		tags, lerr = getImageTags(ctx, defaultK8sRegistry+"/kube-apiserver", TagsOption{Timeout: DefaultCtxTimeout})
+		return lerr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetes releases: %s", err)
+	}
+	var releases []k8sVersion
+	for _, tag := range tags {
+		// pre-releases (e.g. v1.29.0-rc.1) fail to parse and are ignored
+		if v, perr := parseK8sVersion(tag); perr == nil {
+			releases = append(releases, v)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].less(releases[j]) })
+	return releases, nil
+}
+
+// kubeadmImages returns the images `kubeadm config images list` requires
+// for the kubernetes versions.
+func kubeadmImages(ctx context.Context, spec string) (Images, error) {
+	versions, err := kubeadmVersions(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var images Images
+	seen := make(map[string]bool)
+	add := func(img *Image) {
+		if !seen[img.String()] {
+			seen[img.String()] = true
+			images = append(images, img)
+		}
+	}
+	for _, v := range versions {
+		if imgs, lerr := kubeadmListImages(ctx, v); lerr == nil {
+			for _, img := range imgs {
+				add(img)
+			}
+			continue
+		} else if errors.Is(lerr, errKubeadmMinor) {
+			logrus.Debugf("%s, use the known kubernetes %s images", lerr, v)
+		} else if !errors.Is(lerr, exec.ErrNotFound) {
+			logrus.Warnf("failed to list kubernetes %s images with kubeadm, use the known images: %s", v, lerr)
+		}
+		deps, ok := kubeadmDependencies[v.minor]
+		if v.major != 1 || !ok {
+			return nil, fmt.Errorf("unsupported kubernetes version: %s", v)
+		}
+		logrus.Debugf("kubernetes %s images: pause %s, etcd %s, coredns %s", v, deps[0], deps[1], deps[2])
+		for _, name := range kubeadmControlPlaneImages {
+			add(&Image{Repo: defaultK8sRegistry, Name: name, Tag: v.String()})
+		}
+		add(&Image{Repo: defaultK8sRegistry, Name: "pause", Tag: deps[0]})
+		add(&Image{Repo: defaultK8sRegistry, Name: "etcd", Tag: deps[1]})
+		// coredns moved to its own coredns/coredns repository since v1.21
+		if v.minor >= 21 {
+			add(&Image{Repo: defaultK8sRegistry, User: "coredns", Name: "coredns", Tag: deps[2]})
+		} else {
+			add(&Image{Repo: defaultK8sRegistry, Name: "coredns", Tag: deps[2]})
+		}
+	}
+	return images, nil
+}
+
+// kubeadmListImages returns the images of `kubeadm config images list` for
+// the kubernetes version, exec.ErrNotFound if kubeadm is not installed and
+// errKubeadmMinor if kubeadm is not of the minor release of the version.
+func kubeadmListImages(ctx context.Context, v k8sVersion) (Images, error) {
+	if _, err := exec.LookPath("kubeadm"); err != nil {
+		return nil, exec.ErrNotFound
+	}
+	version, err := runCommand(ctx, nil, "kubeadm", "version", "-o", "short")
+	if err != nil {
+		return nil, err
+	}
+	kv, err := parseK8sVersion(string(version))
+	if err != nil {
+		return nil, err
+	}
+	if kv.major != v.major || kv.minor != v.minor {
+		return nil, fmt.Errorf("%w: %s", errKubeadmMinor, kv)
+	}
+	out, err := runCommand(ctx, nil, "kubeadm", "config", "images", "list",
+		"--kubernetes-version", v.String(),
+		"--image-repository", defaultK8sRegistry)
+	if err != nil {
+		return nil, err
+	}
+	var images Images
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		img, perr := parseImage(line)
+		if perr != nil {
+			return nil, fmt.Errorf("invalid kubeadm image %s: %s", line, perr)
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("kubeadm listed no images")
+	}
+	logrus.Debugf("kubernetes %s images listed by kubeadm: %d", v, len(images))
+	return images, nil
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LatestKeep   = "keep"   // Sync the upstream latest tags as is
+	LatestSkip   = "skip"   // Do not sync latest tags
+	LatestSemver = "semver" // Do not sync latest tags, tag the highest semver tag as latest
+
+	latestTag = "latest"
+)
+
+// semverTagRe matches release tags, e.g. v1.2.3 or 3.9, pre-release tags do not match.
+var semverTagRe = regexp.MustCompile(`^v?(\d+)(\.\d+)*$`)
+
+// parseSemverTag returns the numeric version components of a release tag.
+func parseSemverTag(tag string) ([]int, bool) {
+	if !semverTagRe.MatchString(tag) {
+		return nil, false
+	}
+	var nums []int
+	for _, s := range strings.Split(strings.TrimPrefix(tag, "v"), ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	return nums, true
+}
+
+func semverLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// aliasLatest tags the highest semver image of every destination repository
+// as latest. The images of all batches are compared, the latest tag is only
+// updated by the run which synced the highest image.
+func aliasLatest(ctx context.Context, images Images, opt *SyncOption) {
+	highest := make(map[string]*Image)
+	versions := make(map[string][]int)
+	for _, img := range images {
+		v, ok := parseSemverTag(img.Tag)
+		if !ok {
+			continue
+		}
+		repo := img.Repo + "/" + img.Repository()
+		if highest[repo] == nil || semverLess(versions[repo], v) {
+			highest[repo] = img
+			versions[repo] = v
+		}
+	}
+
+	for _, img := range highest {
+		if !img.Success || opt.OnlyDownloadManifests {
+			continue
+		}
+		src := destinationImage(img, opt)
+		dest := *src
+		dest.Tag = latestTag
+		logrus.Infof("tag %s as %s", src.String(), dest.String())
+		err := limiter.do(ctx, func() error {
+			return copyReferenceWithContext(ctx, src.String(), dest.String(), destinationSystemContext(opt), opt)
+		})
+		if err != nil {
+			logrus.Errorf("failed to tag %s as latest: %s", src.String(), err)
+		}
+	}
+}
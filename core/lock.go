@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+)
+
+// lockFile pins the source digest of every synced image, e.g.
+//
+//	images:
+//	  gcr.io/google-containers/pause:3.2: sha256:927d98197ec1141a368550822d18fa1c60bdae27b78b0c004f705f548c07814f
+type lockFile struct {
+	Images map[string]digest.Digest `yaml:"images"`
+}
+
+func loadLockFile(path string) (map[string]digest.Digest, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lf lockFile
+	if err = yaml.UnmarshalStrict(bs, &lf); err != nil {
+		return nil, fmt.Errorf("invalid lock file %s: %s", path, err)
+	}
+	for name, dgst := range lf.Images {
+		if err = dgst.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid lock file %s, image %s: %s", path, name, err)
+		}
+	}
+	return lf.Images, nil
+}
+
+// writeLockFile writes the source digests of the synced images.
+func writeLockFile(path string, images Images) error {
+	lf := lockFile{Images: make(map[string]digest.Digest)}
+	for _, img := range images {
+		if img.Success && img.Digest != "" {
+			lf.Images[img.String()] = img.Digest
+		}
+	}
+	bs, err := yaml.Marshal(&lf)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// sourceReference returns the source reference of the image without transport,
+// pinned images (lock file, digest references) are referenced by digest.
+func sourceReference(image *Image) string {
+	if image.Pinned == "" {
+		return image.String()
+	}
+	return fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), image.Pinned)
+}
+
+// digestReference returns the source reference of the image by its checked
+// digest, the tag may have moved since the check.
+func digestReference(image *Image) string {
+	if image.Digest == "" {
+		return image.String()
+	}
+	return fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), image.Digest)
+}
+
+// pinDigest pins the image to its checked digest, so the image passed by a
+// check (scan, allowlist, signature) is the one copied.
+func pinDigest(image *Image) {
+	if image.Pinned == "" {
+		image.Pinned = image.Digest
+	}
+}
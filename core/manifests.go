@@ -4,14 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
 
 	"github.com/containers/image/v5/manifest"
@@ -21,114 +22,159 @@ import (
 
 var manifestsMap = make(map[string]interface{}, 5000)
 
+// manifestTimes are the last synced times of the stored manifests by cache key.
+var manifestTimes = make(map[string]time.Time, 5000)
+
+// LoadManifests opens the manifest store of ManifestDir and loads the stored
+// manifests into the manifests cache.
 func LoadManifests() error {
-	_, err := os.Stat(ManifestDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return os.MkdirAll(ManifestDir, 0755)
-		}
+	var err error
+	if storage, err = openManifestStore(ManifestDir); err != nil {
 		return err
 	}
 
 	logrus.Infof("loading manifests path [%s]...", ManifestDir)
-	err = filepath.Walk(ManifestDir, func(path string, info os.FileInfo, ferr error) error {
-		if ferr != nil {
-			return ferr
-		}
-		if info.IsDir() {
+	err = storage.Walk(func(name string, mbs []byte, modTime time.Time) error {
+		if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, sbomFileSuffix) || strings.HasSuffix(name, platformFileSuffix) || strings.HasSuffix(name, configFileSuffix) {
 			return nil
 		}
-		logrus.Debugf("loading manifest file: %s", path)
-		ss := strings.Split(strings.TrimPrefix(path, ManifestDir), string(filepath.Separator))
-		prefix := strings.Join(ss[:len(ss)-1], "/")
-		tag := strings.TrimSuffix(ss[len(ss)-1], ".json")
-		cacheKey := strings.TrimPrefix(fmt.Sprintf("%s:%s", prefix, tag), "/")
-		logrus.Debugf("manifest cache key: %s", cacheKey)
-		mbs, rerr := ioutil.ReadFile(path)
-		if rerr != nil {
-			return rerr
+		logrus.Tracef("loading manifest file: %s", name)
+		cacheKey := strings.TrimSuffix(name, ".json")
+		if i := strings.LastIndex(cacheKey, "/"); i > 0 {
+			cacheKey = cacheKey[:i] + ":" + cacheKey[i+1:]
 		}
+		logrus.Tracef("manifest cache key: %s", cacheKey)
+		manifestTimes[cacheKey] = modTime
 
 		mType := manifest.GuessMIMEType(mbs)
 		// ignore blank json file
 		if mType == "" {
 			return nil
 		}
+		var parsed interface{}
+		var jerr error
 		switch mType {
 		case manifest.DockerV2ListMediaType:
 			var m2List manifest.Schema2List
-			if jerr := jsoniter.Unmarshal(mbs, &m2List); jerr == nil {
-				manifestsMap[cacheKey] = &m2List
-			} else {
-				logrus.Debugf("failed to parse json [%s]: %s", path, err)
+			if jerr = jsoniter.Unmarshal(mbs, &m2List); jerr == nil {
+				parsed = &m2List
 			}
-			return nil
 		case imgspecv1.MediaTypeImageIndex:
 			var o1List manifest.OCI1Index
-			if jerr := jsoniter.Unmarshal(mbs, &o1List); jerr == nil {
-				manifestsMap[cacheKey] = &o1List
-			} else {
-				logrus.Debugf("failed to parse json [%s]: %s", path, err)
+			if jerr = jsoniter.Unmarshal(mbs, &o1List); jerr == nil {
+				parsed = &o1List
 			}
-			return nil
 		default:
-			if m, jerr := manifest.FromBlob(mbs, mType); jerr == nil {
-				manifestsMap[cacheKey] = m
-			} else {
-				logrus.Debugf("failed to parse json [%s]: %s", path, err)
+			parsed, jerr = manifest.FromBlob(mbs, mType)
+		}
+		switch {
+		case jerr != nil:
+			logrus.Debugf("failed to parse json [%s]: %s", name, jerr)
+		case memoryBudget > 0:
+			// the parsed manifest is dropped with the file content
+			if c := newCompactManifest(mbs, parsed); c != nil {
+				manifestsMap[cacheKey] = c
 			}
-			return nil
+		default:
+			manifestsMap[cacheKey] = parsed
 		}
+		return nil
 	})
 	logrus.Infof("loaded manifests count: %d", len(manifestsMap))
 	return err
 }
 
-func getImageManifest(imageName string) (manifest.Manifest, manifest.List, error) {
-	srcRef, err := docker.ParseReference("//" + imageName)
+// getImageManifest returns the parsed and the raw manifest of the image,
+// either the image manifest or the manifest list is set.
+func getImageManifest(ctx context.Context, imageName string) (manifest.Manifest, manifest.List, []byte, error) {
+	mbs, err := getManifestBlob(ctx, imageName, &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}})
 	if err != nil {
-		return nil, nil, err
-	}
-
-	sourceCtx := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
-	imageSrcCtx, imageSrcCancel := context.WithTimeout(context.Background(), DefaultCtxTimeout)
-	defer imageSrcCancel()
-	src, err := srcRef.NewImageSource(imageSrcCtx, sourceCtx)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	getManifestCtx, getManifestCancel := context.WithTimeout(context.Background(), DefaultCtxTimeout)
-	defer getManifestCancel()
-	mbs, _, err := src.GetManifest(getManifestCtx, nil)
-	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	mType := manifest.GuessMIMEType(mbs)
 	if mType == "" {
-		return nil, nil, fmt.Errorf("faile to parse image [%s] manifest type", imageName)
+		return nil, nil, nil, withClass(ErrManifestInvalid, fmt.Errorf("faile to parse image [%s] manifest type", imageName))
 	}
 	switch mType {
 	case manifest.DockerV2ListMediaType:
 		var m2List manifest.Schema2List
 		err = jsoniter.Unmarshal(mbs, &m2List)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		return nil, &m2List, nil
+		return nil, &m2List, mbs, nil
 	case imgspecv1.MediaTypeImageIndex:
 		var o1List manifest.OCI1Index
 		err = jsoniter.Unmarshal(mbs, &o1List)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		return nil, &o1List, nil
+		return nil, &o1List, mbs, nil
 	default:
 		m, err := manifest.FromBlob(mbs, mType)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
-		return m, nil, nil
+		return m, nil, mbs, nil
+	}
+}
+
+// getManifestDigest returns the digest of the image top level manifest.
+func getManifestDigest(ctx context.Context, imageName string, sys *types.SystemContext) (digest.Digest, error) {
+	mbs, err := getManifestBlob(ctx, imageName, sys)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest(mbs)
+}
+
+func getManifestBlob(ctx context.Context, imageName string, sys *types.SystemContext) ([]byte, error) {
+	srcRef, err := docker.ParseReference("//" + imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	imageSrcCtx, imageSrcCancel := context.WithTimeout(ctx, DefaultCtxTimeout)
+	defer imageSrcCancel()
+	src, err := srcRef.NewImageSource(imageSrcCtx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = src.Close() }()
+
+	getManifestCtx, getManifestCancel := context.WithTimeout(ctx, DefaultCtxTimeout)
+	defer getManifestCancel()
+	mbs, _, err := src.GetManifest(getManifestCtx, nil)
+	return mbs, err
+}
+
+// getConfigBlob returns the image config blob, its digest is verified.
+func getConfigBlob(ctx context.Context, imageName string, info types.BlobInfo) ([]byte, error) {
+	srcRef, err := docker.ParseReference("//" + imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	blobCtx, blobCancel := context.WithTimeout(ctx, DefaultCtxTimeout)
+	defer blobCancel()
+	src, err := srcRef.NewImageSource(blobCtx, &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = src.Close() }()
+
+	rc, _, err := src.GetBlob(blobCtx, info, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	bs, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if d := digest.FromBytes(bs); d != info.Digest {
+		return nil, fmt.Errorf("config blob digest mismatch, expected: %s, got: %s", info.Digest, d)
 	}
+	return bs, nil
 }
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/yaml.v2"
+)
+
+// MappingEntry maps a synced source image to its destination image.
+type MappingEntry struct {
+	Source      string `json:"source" yaml:"source"`
+	Destination string `json:"destination" yaml:"destination"`
+	Digest      string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// writeMapping writes the source to destination mapping of the synced images,
+// the file is written as YAML if it has a .yaml or .yml extension, else JSON.
+func writeMapping(images Images, opt *SyncOption) error {
+	entries := make([]MappingEntry, 0, len(images))
+	for _, img := range images {
+		if !img.Success {
+			continue
+		}
+		e := MappingEntry{
+			Source:      img.String(),
+			Destination: destinationImage(img, opt).String(),
+			Digest:      img.DestDigest.String(),
+		}
+		if e.Digest == "" {
+			e.Digest = img.Digest.String()
+		}
+		entries = append(entries, e)
+	}
+
+	var bs []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(opt.MappingFile)) {
+	case ".yaml", ".yml":
+		bs, err = yaml.Marshal(entries)
+	default:
+		bs, err = jsoniter.MarshalIndent(entries, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(opt.MappingFile, bs, 0644)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// copyMemory is the estimated memory of a single image copy, mostly the
+	// layer buffers of the parallel layer copies
+	copyMemory = 16 << 20
+	// recompressMemory is the estimated memory of a single image copy which
+	// recompresses the layers
+	recompressMemory = 64 << 20
+	// copyBufferSize is the size of the pooled copy buffers
+	copyBufferSize = 32 << 10
+)
+
+var (
+	// MemoryLimit is the memory budget of the run(e.g. 512Mi), it sets the
+	// soft memory limit of the go runtime, stores the manifests cache in a
+	// compact form and limits the concurrent copies. Empty is unlimited.
+	MemoryLimit = ""
+
+	// memoryBudget is the parsed MemoryLimit in bytes, 0 if unlimited
+	memoryBudget int64
+)
+
+// copyBuffers are the buffers of the file and body copies.
+var copyBuffers = sync.Pool{New: func() interface{} {
+	buf := make([]byte, copyBufferSize)
+	return &buf
+}}
+
+// copyBuffer copies src to dst with a pooled buffer.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// ApplyMemoryLimit applies MemoryLimit before the manifests are loaded.
+func ApplyMemoryLimit() error {
+	if MemoryLimit == "" {
+		memoryBudget = 0
+		return nil
+	}
+	limit, err := parseByteSize(MemoryLimit)
+	if err != nil {
+		return fmt.Errorf("invalid memory limit %s: %s", MemoryLimit, err)
+	}
+	memoryBudget = limit
+	debug.SetMemoryLimit(limit)
+	logrus.Infof("memory limit: %d MiB", limit>>20)
+	return nil
+}
+
+// memoryLimitedWorkers caps the sync workers, so the estimated memory of
+// the concurrent copies takes at most half of the memory budget.
+func memoryLimitedWorkers(opt *SyncOption) {
+	if memoryBudget <= 0 {
+		return
+	}
+	perCopy := int64(copyMemory)
+	if opt.Recompress != "" {
+		perCopy = recompressMemory
+	}
+	if opt.ParallelPlatforms > 1 {
+		perCopy *= int64(opt.ParallelPlatforms)
+	}
+	workers := int(memoryBudget / 2 / perCopy)
+	if workers < 1 {
+		workers = 1
+	}
+	if opt.Limit > workers {
+		logrus.Warnf("process limit %d exceeds the memory limit, use %d", opt.Limit, workers)
+		opt.Limit = workers
+	}
+}
+
+// compactManifest is the manifests cache entry of runs with a memory limit,
+// it only keeps what the cached manifest is used for instead of the parsed
+// manifest.
+type compactManifest struct {
+	digest digest.Digest
+	// size is the config and layers size of image manifests
+	size int64
+	// platforms are the platform file names of manifest lists
+	platforms []string
+}
+
+func newCompactManifest(mbs []byte, m interface{}) *compactManifest {
+	dgst, err := manifest.Digest(mbs)
+	if err != nil {
+		return nil
+	}
+	c := &compactManifest{digest: dgst}
+	switch v := m.(type) {
+	case manifest.List:
+		for _, p := range listPlatforms(v) {
+			c.platforms = append(c.platforms, p.name)
+		}
+	case manifest.Manifest:
+		c.size = v.ConfigInfo().Size
+		for _, layer := range v.LayerInfos() {
+			if layer.Size > 0 {
+				c.size += layer.Size
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// parallelPlatforms reports whether the platform manifests of the manifest
+// list are copied concurrently, lists which are modified during the copy
+// are copied by containers/image.
+func parallelPlatforms(l manifest.List, opt *SyncOption) bool {
+	return l != nil && opt.ParallelPlatforms > 1 && !filtersPlatforms(opt) &&
+		opt.Recompress == "" && opt.CopyEngine != EngineCrane && opt.ContainerdNamespace == ""
+}
+
+// copyPlatforms copies the platform manifests of the list with at most
+// opt.ParallelPlatforms concurrent copies, then pushes the list manifest as
+// is to the destination tag, so the list keeps its digest.
+func copyPlatforms(ctx context.Context, image, destImage *Image, l manifest.List, listBlob []byte, opt *SyncOption, up *uploadProgress) error {
+	instances := l.Instances()
+	logrus.Debugf("copy %d platforms of %s concurrently...", len(instances), image.String())
+	g, _ := newTaskGroup(ctx, opt.ParallelPlatforms)
+	for _, instance := range instances {
+		instance := instance
+		g.Go(func(ctx context.Context) error {
+			return copyInstance(ctx, image, destImage, instance, opt, up)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	client := newRegistryClient(destImage.Repo, opt.User, opt.Password)
+	return client.putManifest(ctx, destImage.Repository(), destImage.Tag, listBlob, l.MIMEType())
+}
+
+// copyInstance copies the platform manifest of the list by its digest.
+func copyInstance(ctx context.Context, image, destImage *Image, instance digest.Digest, opt *SyncOption, up *uploadProgress) error {
+	policyContext, err := newPolicyContext(opt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = policyContext.Destroy() }()
+
+	srcRef, err := docker.ParseReference(fmt.Sprintf("//%s/%s@%s", image.Repo, image.Repository(), instance))
+	if err != nil {
+		return err
+	}
+	srcRef = newLimitedReference(srcRef, opt.ParallelLayers)
+	srcRef = newBlobCacheReference(srcRef, opt)
+	destRef, err := docker.ParseReference(fmt.Sprintf("//%s/%s@%s", destImage.Repo, destImage.Repository(), instance))
+	if err != nil {
+		return err
+	}
+	destRef = newResumableReference(destRef, destImage, opt, up)
+
+	progressCh := make(chan types.ProgressProperties)
+	progressDone := make(chan struct{})
+	go func() {
+		up.watch(image, progressCh)
+		close(progressDone)
+	}()
+	copied, err := copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{
+		SourceCtx:        &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}},
+		DestinationCtx:   destinationSystemContext(opt),
+		ProgressInterval: defaultProgressInterval,
+		Progress:         progressCh,
+	})
+	close(progressCh)
+	<-progressDone
+	if err != nil {
+		return fmt.Errorf("failed to copy image [%s] platform manifest %s: %s", image.String(), instance, err)
+	}
+	if dgst, derr := manifest.Digest(copied); derr == nil && dgst != instance {
+		return fmt.Errorf("image [%s] platform manifest %s has been modified during copy, copied digest: %s", image.String(), instance, dgst)
+	}
+	return nil
+}
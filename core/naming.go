@@ -0,0 +1,358 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultNameSeparator joins the image path components of flattened names.
+	defaultNameSeparator = "_"
+
+	// tagRewriteDate is replaced with the current date (YYYYMMDD) in tag rewrite replacements
+	tagRewriteDate = "{date}"
+)
+
+// nameTemplateFuncs are the functions available in destination name templates,
+// e.g. {{.Repo | replace "." "-"}}/{{.Name}}
+var nameTemplateFuncs = template.FuncMap{
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+var nameTemplates sync.Map // template text => *template.Template
+
+func parseNameTemplate(text string) (*template.Template, error) {
+	if t, ok := nameTemplates.Load(text); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("name").Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	nameTemplates.Store(text, t)
+	return t, nil
+}
+
+// checkNameTemplate validates the destination name template of the option.
+func checkNameTemplate(opt *SyncOption) error {
+	if opt.NameTemplate == "" {
+		return nil
+	}
+	_, err := renderName(opt.NameTemplate, &Image{Repo: defaultGcrRepo, User: defaultGcrNamespace, Name: "pause", Tag: "latest"})
+	return err
+}
+
+func renderName(text string, image *Image) (string, error) {
+	t, err := parseNameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, image); err != nil {
+		return "", err
+	}
+	name := strings.Trim(strings.TrimSpace(buf.String()), "/")
+	if name == "" {
+		return "", fmt.Errorf("name template %q renders an empty name", text)
+	}
+	return name, nil
+}
+
+// flattenName collapses the image path into a single repository name with
+// the separator of the option, dots are replaced if configured.
+func flattenName(image *Image, opt *SyncOption) string {
+	sep := opt.NameSeparator
+	if sep == "" {
+		sep = defaultNameSeparator
+	}
+	parts := []string{image.Repo}
+	if image.User != "" {
+		parts = append(parts, strings.Split(image.User, "/")...)
+	}
+	name := strings.Join(append(parts, image.Name), sep)
+	if opt.NameReplaceDots != "" {
+		name = strings.ReplaceAll(name, ".", opt.NameReplaceDots)
+	}
+	return name
+}
+
+// sanitizeName lowercases the name and truncates it to the max length of the
+// option, truncated names end with a hash of the full name to stay unique.
+func sanitizeName(name string, opt *SyncOption) string {
+	name = strings.ToLower(name)
+	if opt.NameMaxLength <= 0 || len(name) <= opt.NameMaxLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:8]
+	if opt.NameMaxLength <= len(hash)+1 {
+		return hash[:opt.NameMaxLength]
+	}
+	return strings.TrimRight(name[:opt.NameMaxLength-len(hash)-1], "._-/") + "-" + hash
+}
+
+// destinationRegistry returns the registry host which images sync to.
+func destinationRegistry(opt *SyncOption) string {
+	if opt.DestRegistry != "" {
+		return strings.TrimSuffix(opt.DestRegistry, "/")
+	}
+	return defaultDockerRepo
+}
+
+// destinationNamespace returns the destination namespace, the docker hub user by default.
+func destinationNamespace(opt *SyncOption) string {
+	if opt.DestNamespace != "" {
+		return strings.Trim(opt.DestNamespace, "/")
+	}
+	return opt.User
+}
+
+// preserveHierarchy reports whether destination names keep the nested image
+// path, docker hub only supports a single path level below the user.
+func preserveHierarchy(opt *SyncOption) bool {
+	switch opt.NameHierarchy {
+	case HierarchyPreserve:
+		return true
+	case HierarchyFlatten:
+		return false
+	default:
+		return destinationRegistry(opt) != defaultDockerRepo
+	}
+}
+
+// destinationName returns the destination repository name of the image, the
+// image path is flattened or preserved unless a name template is set.
+// Names disambiguated by resolveCollisions take precedence.
+func destinationName(image *Image, opt *SyncOption) string {
+	if image.DestName != "" {
+		return image.DestName
+	}
+	if opt.NameTemplate == "" {
+		if preserveHierarchy(opt) {
+			return sanitizeName(image.Repository(), opt)
+		}
+		return sanitizeName(flattenName(image, opt), opt)
+	}
+	name, err := renderName(opt.NameTemplate, image)
+	if err != nil {
+		logrus.Fatalf("failed to render image [%s] destination name: %s", image.String(), err)
+	}
+	return sanitizeName(name, opt)
+}
+
+// tagRewriteRule rewrites destination tags matching the regexp.
+type tagRewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+var tagRewriteRules sync.Map // rules text => []tagRewriteRule
+
+// parseTagRewrites parses the REGEXP=REPLACEMENT tag rewrite rules,
+// e.g. "^v(.+)$=$1" strips the v prefix of tags.
+func parseTagRewrites(rules []string) ([]tagRewriteRule, error) {
+	key := strings.Join(rules, "\n")
+	if rs, ok := tagRewriteRules.Load(key); ok {
+		return rs.([]tagRewriteRule), nil
+	}
+	var rs []tagRewriteRule
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid tag rewrite rule %q, expected REGEXP=REPLACEMENT", rule)
+		}
+		re, err := regexp.Compile(rule[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag rewrite rule %q: %s", rule, err)
+		}
+		rs = append(rs, tagRewriteRule{re: re, replacement: rule[i+1:]})
+	}
+	tagRewriteRules.Store(key, rs)
+	return rs, nil
+}
+
+// destinationTag returns the destination tag of the image, the first
+// matching tag rewrite rule is applied.
+func destinationTag(image *Image, opt *SyncOption) string {
+	if len(opt.TagRewrites) == 0 {
+		return image.Tag
+	}
+	rules, err := parseTagRewrites(opt.TagRewrites)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	for _, rule := range rules {
+		if !rule.re.MatchString(image.Tag) {
+			continue
+		}
+		replacement := strings.ReplaceAll(rule.replacement, tagRewriteDate, time.Now().UTC().Format("20060102"))
+		return rule.re.ReplaceAllString(image.Tag, replacement)
+	}
+	return image.Tag
+}
+
+// resolveCollisions detects different source repositories mapped to the same
+// destination repository, which would overwrite each other. Overridden
+// destinations are explicit and not checked. The colliding
+// names get a hash suffix of their source repository if disambiguation is
+// enabled, otherwise the collisions are returned as error. Different source
+// images mapped to the same destination tag, e.g. by tag rewrites or the
+// {date} placeholder, are always returned as error.
+func resolveCollisions(images Images, opt *SyncOption) error {
+	if err := resolveNameCollisions(images, opt); err != nil {
+		return err
+	}
+	return tagCollisions(images, opt)
+}
+
+// resolveNameCollisions detects and disambiguates the destination name
+// collisions of resolveCollisions.
+func resolveNameCollisions(images Images, opt *SyncOption) error {
+	sources := make(map[string]map[string]bool)
+	for _, img := range images {
+		if _, ok := overrideDestination(img, opt); ok {
+			continue
+		}
+		dest := destinationName(img, opt)
+		if sources[dest] == nil {
+			sources[dest] = make(map[string]bool)
+		}
+		sources[dest][img.Repo+"/"+img.Repository()] = true
+	}
+
+	var collisions []string
+	for dest, srcs := range sources {
+		if len(srcs) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(srcs))
+		for src := range srcs {
+			names = append(names, src)
+		}
+		sort.Strings(names)
+		collisions = append(collisions, fmt.Sprintf("%s <= %s", dest, strings.Join(names, ", ")))
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+	sort.Strings(collisions)
+	if !opt.Disambiguate {
+		return fmt.Errorf("destination name collisions:\n%s", strings.Join(collisions, "\n"))
+	}
+
+	for _, c := range collisions {
+		logrus.Warnf("destination name collision, disambiguate: %s", c)
+	}
+	for _, img := range images {
+		if _, ok := overrideDestination(img, opt); ok {
+			continue
+		}
+		dest := destinationName(img, opt)
+		if len(sources[dest]) < 2 {
+			continue
+		}
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(img.Repo+"/"+img.Repository())))[:8]
+		img.DestName = sanitizeName(dest+"-"+hash, opt)
+	}
+	return nil
+}
+
+// tagCollisions returns the destination tags of different source images as
+// error, the images would overwrite each other.
+func tagCollisions(images Images, opt *SyncOption) error {
+	sources := make(map[string]map[string]bool)
+	for _, img := range images {
+		dest := destinationImage(img, opt).String()
+		if sources[dest] == nil {
+			sources[dest] = make(map[string]bool)
+		}
+		sources[dest][img.String()] = true
+	}
+
+	var collisions []string
+	for dest, srcs := range sources {
+		if len(srcs) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(srcs))
+		for src := range srcs {
+			names = append(names, src)
+		}
+		sort.Strings(names)
+		collisions = append(collisions, fmt.Sprintf("%s <= %s", dest, strings.Join(names, ", ")))
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+	sort.Strings(collisions)
+	return fmt.Errorf("destination tag collisions:\n%s", strings.Join(collisions, "\n"))
+}
+
+// collisionGuard detects destination name collisions of images synced while
+// they are listed. Like resolveCollisions, all the colliding source
+// repositories get the hash suffixed destination name once the collision is
+// detected, the images synced before keep the destination name. The
+// destination tags of different source images always fail.
+type collisionGuard struct {
+	mu        sync.Mutex
+	sources   map[string]string // first source repository by destination name
+	colliding map[string]bool   // destination names of different source repositories
+	tags      map[string]string // first source image by destination image
+}
+
+func newCollisionGuard() *collisionGuard {
+	return &collisionGuard{sources: make(map[string]string), colliding: make(map[string]bool), tags: make(map[string]string)}
+}
+
+// check claims the destination name and tag of the image, with
+// opt.Disambiguate colliding names get a hash suffixed destination name.
+func (g *collisionGuard) check(img *Image, opt *SyncOption) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := overrideDestination(img, opt); !ok {
+		if err := g.checkName(img, opt); err != nil {
+			return err
+		}
+	}
+	dest := destinationImage(img, opt).String()
+	if claimed, ok := g.tags[dest]; ok && claimed != img.String() {
+		return fmt.Errorf("destination tag collision: %s <= %s, %s", dest, claimed, img.String())
+	}
+	g.tags[dest] = img.String()
+	return nil
+}
+
+// checkName claims the destination name of the image, g.mu must be held.
+func (g *collisionGuard) checkName(img *Image, opt *SyncOption) error {
+	dest := destinationName(img, opt)
+	src := img.Repo + "/" + img.Repository()
+	claimed, ok := g.sources[dest]
+	if !ok {
+		g.sources[dest] = src
+		claimed = src
+	}
+	if claimed != src && !opt.Disambiguate {
+		return fmt.Errorf("destination name collision: %s <= %s, %s", dest, claimed, src)
+	}
+	if claimed != src && !g.colliding[dest] {
+		g.colliding[dest] = true
+		logrus.Warnf("destination name collision, disambiguate: %s <= %s, %s, the images of %s synced before keep the name", dest, claimed, src, claimed)
+	}
+	if g.colliding[dest] {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(src)))[:8]
+		img.DestName = sanitizeName(dest+"-"+hash, opt)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	objectStoreRetry     = 5
+	objectStoreRetryTime = 500 * time.Millisecond
+)
+
+// objectStoreHTTPClient is the http client of the object storages, their
+// responses are not observed by the registry rate limiter.
+var objectStoreHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout, Transport: sharedTransport}
+
+// objectStoreSchemes are the default endpoints of the object storage URL
+// schemes, all of them are accessed through the S3 compatible api.
+var objectStoreSchemes = map[string]string{
+	"s3":  "https://s3.%s.amazonaws.com",
+	"gs":  "https://storage.googleapis.com",
+	"oss": "https://oss-%s.aliyuncs.com",
+}
+
+func isObjectStoreURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	_, ok := objectStoreSchemes[u.Scheme]
+	return ok && u.Host != ""
+}
+
+// objectStore stores the manifest files in a bucket, e.g. s3://bucket/prefix.
+// The credentials (HMAC keys for gcs) are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, the region from AWS_REGION.
+// AWS_ENDPOINT_URL overrides the endpoint for S3 compatible servers (e.g.
+// minio), buckets of custom endpoints are addressed in path style.
+type objectStore struct {
+	endpoint  *url.URL
+	pathStyle bool
+	bucket    string
+	prefix    string
+	region    string
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newObjectStore(s string) (*objectStore, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if u.Scheme == "gs" {
+		region = "auto"
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = objectStoreSchemes[u.Scheme]
+		if strings.Contains(endpoint, "%s") {
+			endpoint = fmt.Sprintf(endpoint, region)
+		}
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object storage endpoint %s: %s", endpoint, err)
+	}
+
+	store := &objectStore{
+		endpoint:     ep,
+		pathStyle:    pathStyle,
+		bucket:       u.Host,
+		prefix:       strings.Trim(u.Path, "/"),
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("object storage credentials are required, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	RegisterSecret(store.secretKey)
+	RegisterSecret(store.sessionToken)
+	return store, nil
+}
+
+func (s *objectStore) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+// url returns the object url of the key, an empty key is the bucket url.
+func (s *objectStore) url(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	// the request path must match the canonical path of the signature
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// do sends the request, failed requests and 5xx responses are retried with
+// an exponential backoff.
+func (s *objectStore) do(method string, u *url.URL, body []byte) ([]byte, error) {
+	var bs []byte
+	var err error
+	for attempt := 0; attempt < objectStoreRetry; attempt++ {
+		if attempt > 0 {
+			backoff := objectStoreRetryTime << uint(attempt-1)
+			logrus.Debugf("%s %s failed, retry in %s: %s", method, u.Path, backoff, err)
+			time.Sleep(backoff)
+		}
+		var retryable bool
+		if bs, retryable, err = s.send(method, u, body); err == nil || !retryable {
+			return bs, err
+		}
+	}
+	return nil, err
+}
+
+// send sends the request once, it reports whether the error is retryable.
+func (s *objectStore) send(method string, u *url.URL, body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	s.sign(req, body, time.Now().UTC())
+	logrus.Tracef("%s %s", method, u.String())
+	resp, err := objectStoreHTTPClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer drainBody(resp)
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, false, fmt.Errorf("%w: %s %s", errStoreNotFound, method, u.Path)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, resp.StatusCode/100 == 5, fmt.Errorf("%s %s: %s, %s", method, u.Path, resp.Status, bytes.TrimSpace(bs))
+	}
+	return bs, false, nil
+}
+
+// sign signs the request with AWS signature version 4.
+func (s *objectStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region)
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func (s *objectStore) Get(name string) ([]byte, error) {
+	return s.do(http.MethodGet, s.url(s.key(name), nil), nil)
+}
+
+func (s *objectStore) Put(name string, data []byte) error {
+	_, err := s.do(http.MethodPut, s.url(s.key(name), nil), data)
+	return err
+}
+
+// Delete removes the object, S3 deletes of missing objects succeed.
+func (s *objectStore) Delete(name string) error {
+	_, err := s.do(http.MethodDelete, s.url(s.key(name), nil), nil)
+	return err
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list returns the keys and modification times of all objects under the store prefix.
+func (s *objectStore) list() (map[string]time.Time, error) {
+	keys := make(map[string]time.Time)
+	prefix := s.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+	query := url.Values{"list-type": []string{"2"}, "prefix": []string{prefix}}
+	for {
+		bs, err := s.do(http.MethodGet, s.url("", query), nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err = xml.Unmarshal(bs, &result); err != nil {
+			return nil, fmt.Errorf("invalid bucket list response: %s", err)
+		}
+		for _, c := range result.Contents {
+			keys[c.Key] = c.LastModified
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *objectStore) Walk(fn func(name string, data []byte, modTime time.Time) error) error {
+	keys, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	// objects are downloaded concurrently, fn is called sequentially
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var ferr error
+	sem := make(chan struct{}, DefaultLimit)
+	for key, modTime := range keys {
+		k, t := key, modTime
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			bs, gerr := s.do(http.MethodGet, s.url(k, nil), nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if ferr != nil {
+				return
+			}
+			if gerr != nil {
+				ferr = gerr
+				return
+			}
+			ferr = fn(strings.TrimPrefix(strings.TrimPrefix(k, s.prefix), "/"), bs, t)
+		}()
+	}
+	wg.Wait()
+	return ferr
+}
+
+// uriEncode encodes the string as required by the signature, slashes are
+// encoded unless the string is a path.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		vs := append([]string(nil), query[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func sha256Hex(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputText  = "text"  // One line per image, e.g. "+ gcr.io/google-containers/pause:3.2"
+	OutputTable = "table" // Aligned columns with a header
+	OutputJSON  = "json"  // JSON array of the image records
+	OutputYAML  = "yaml"  // YAML list of the image records
+)
+
+// outputRecord is an image printed by the list, diff and verify modes.
+type outputRecord struct {
+	Image      string        `json:"image" yaml:"image"`
+	Status     string        `json:"status,omitempty" yaml:"status,omitempty"`
+	Digest     digest.Digest `json:"digest,omitempty" yaml:"digest,omitempty"`
+	DestDigest digest.Digest `json:"dest_digest,omitempty" yaml:"dest_digest,omitempty"`
+	Details    string        `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// outputRecords returns the records of the images inspected with opt.Mode.
+func outputRecords(images Images, opt *SyncOption) []outputRecord {
+	records := make([]outputRecord, 0, len(images))
+	for _, img := range images {
+		r := outputRecord{Image: img.String(), Digest: img.Digest}
+		switch {
+		case opt.Mode == ModeList:
+		case img.Skipped:
+			r.Status, r.Details = "skipped", img.SkipReason
+		case img.Failed():
+			r.Status = "failed"
+			if img.DigestMismatch {
+				r.Status = "mismatch"
+			}
+			if img.Err != nil {
+				r.Details = img.Err.Error()
+			}
+			r.DestDigest = img.DestDigest
+		case opt.Mode == ModeVerify:
+			r.Status, r.DestDigest = "verified", img.DestDigest
+		case img.CacheHit:
+			// unchanged images are not diffs
+			continue
+		case img.Changes != "" || manifestsMap[img.String()] != nil:
+			r.Status, r.Details = "changed", img.Changes
+		default:
+			r.Status = "new"
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// printImages prints the images inspected with opt.Mode to stdout in the opt.Output format.
+func printImages(images Images, opt *SyncOption) error {
+	records := outputRecords(images, opt)
+	switch opt.Output {
+	case OutputJSON:
+		bs, err := jsoniter.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+	case OutputYAML:
+		bs, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(bs))
+	case OutputTable:
+		printTable(records)
+	default:
+		for _, r := range records {
+			printText(r)
+		}
+	}
+	return nil
+}
+
+func printText(r outputRecord) {
+	switch r.Status {
+	case "":
+		fmt.Println(r.Image)
+	case "new":
+		fmt.Printf("+ %s\n", r.Image)
+	case "changed":
+		if r.Details == "" {
+			fmt.Printf("~ %s\n", r.Image)
+		} else {
+			fmt.Printf("~ %s: %s\n", r.Image, r.Details)
+		}
+	case "skipped":
+		fmt.Printf("- %s: %s\n", r.Image, r.Details)
+	case "verified":
+		fmt.Printf("= %s\n", r.Image)
+	default:
+		fmt.Printf("! %s: %s\n", r.Image, r.Details)
+	}
+}
+
+// printTable prints the records as aligned columns, empty columns are omitted.
+func printTable(records []outputRecord) {
+	header := []string{"IMAGE", "STATUS", "DIGEST", "DEST DIGEST", "DETAILS"}
+	rows := make([][]string, 0, len(records))
+	used := make([]bool, len(header))
+	used[0] = true
+	for _, r := range records {
+		row := []string{r.Image, r.Status, r.Digest.String(), r.DestDigest.String(), r.Details}
+		for i, v := range row {
+			used[i] = used[i] || v != ""
+		}
+		rows = append(rows, row)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		var cols []string
+		for i, v := range row {
+			if used[i] {
+				cols = append(cols, v)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cols, "\t"))
+	}
+	_ = w.Flush()
+}
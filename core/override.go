@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// overrideFile overrides the destination reference of source images, keys
+// are source repositories or tagged source images, e.g.
+//
+//	overrides:
+//	  gcr.io/google-containers/pause: mycorp/pause
+//	  gcr.io/google-containers/pause:3.2: harbor.internal/mirror/pause:3.2-gcr
+//
+// Destinations without tag keep the destination tag of the image.
+type overrideFile struct {
+	Overrides map[string]string `yaml:"overrides"`
+}
+
+var destinationOverrides sync.Map // file path => map[string]reference.Named
+
+func loadOverrides(path string) (map[string]reference.Named, error) {
+	if o, ok := destinationOverrides.Load(path); ok {
+		return o.(map[string]reference.Named), nil
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var of overrideFile
+	if err = yaml.UnmarshalStrict(bs, &of); err != nil {
+		return nil, fmt.Errorf("invalid overrides file %s: %s", path, err)
+	}
+	overrides := make(map[string]reference.Named, len(of.Overrides))
+	for src, dest := range of.Overrides {
+		named, perr := reference.ParseNormalizedNamed(dest)
+		if perr != nil {
+			return nil, fmt.Errorf("invalid override destination of %s: %s", src, perr)
+		}
+		if _, ok := named.(reference.Digested); ok {
+			return nil, fmt.Errorf("invalid override destination of %s: digest references are not supported", src)
+		}
+		overrides[src] = named
+	}
+	destinationOverrides.Store(path, overrides)
+	return overrides, nil
+}
+
+// overrideDestination returns the overridden destination image of the image,
+// tagged source image overrides take precedence over repository overrides.
+func overrideDestination(image *Image, opt *SyncOption) (*Image, bool) {
+	if opt.Destination != "" {
+		return copyDestination(image, opt), true
+	}
+	if opt.OverridesFile == "" {
+		return nil, false
+	}
+	overrides, err := loadOverrides(opt.OverridesFile)
+	if err != nil {
+		logrus.Fatalf("failed to load destination overrides: %s", err)
+	}
+	named, ok := overrides[image.String()]
+	if !ok {
+		if named, ok = overrides[image.Repo+"/"+image.Repository()]; !ok {
+			return nil, false
+		}
+	}
+
+	dest, err := parseImage(named.String())
+	if err != nil {
+		logrus.Fatalf("invalid override destination of image [%s]: %s", image.String(), err)
+	}
+	if _, tagged := named.(reference.Tagged); !tagged {
+		dest.Tag = destinationTag(image, opt)
+	}
+	return dest, true
+}
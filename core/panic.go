@@ -0,0 +1,130 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPanicDir is the directory of the panic diagnostic files
+	DefaultPanicDir = "."
+
+	// recentLogsSize is the count of the recent log lines in the panic diagnostics
+	recentLogsSize = 200
+)
+
+// panicBundle is the diagnostic file of a panic while syncing an image.
+type panicBundle struct {
+	Time        time.Time `json:"time"`
+	Image       string    `json:"image"`
+	Destination string    `json:"destination,omitempty"`
+	Digest      string    `json:"digest,omitempty"`
+	Attempts    int       `json:"attempts"`
+	Panic       string    `json:"panic"`
+	Stack       string    `json:"stack"`
+	Progress    string    `json:"progress,omitempty"`
+	Goroutines  int       `json:"goroutines"`
+	HeapAlloc   uint64    `json:"heap_alloc"`
+	Logs        []string  `json:"logs"`
+}
+
+// recentLogs keeps the recent log lines for the panic diagnostics.
+var recentLogs = &logRing{lines: make([]string, 0, recentLogsSize)}
+
+func init() {
+	logrus.AddHook(recentLogs)
+}
+
+// logRing is a logrus hook keeping the last recentLogsSize log lines.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+}
+
+func (r *logRing) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (r *logRing) Fire(entry *logrus.Entry) error {
+	line := fmt.Sprintf("%s %s %s", entry.Time.Format("2006-01-02 15:04:05"), entry.Level, entry.Message)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) < recentLogsSize {
+		r.lines = append(r.lines, line)
+		return nil
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % recentLogsSize
+	return nil
+}
+
+// snapshot returns the recent log lines in order.
+func (r *logRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, 0, len(r.lines))
+	for i := range r.lines {
+		lines = append(lines, Redact(r.lines[(r.next+i)%len(r.lines)]))
+	}
+	return lines
+}
+
+// logPanic is the panic handler of the goroutines pools, it logs the panic
+// value with the stack trace.
+func logPanic(i interface{}) {
+	logrus.Errorf("panic: %v\n%s", i, debug.Stack())
+}
+
+// imagePanicked fails the image with the recovered panic p of its sync, the
+// diagnostics are written to a file in opt.PanicDir.
+func imagePanicked(image *Image, p interface{}, opt *SyncOption, progress *runProgress) {
+	stack := string(debug.Stack())
+	logrus.Errorf("panic while syncing image [%s]: %v\n%s", image.String(), p, stack)
+
+	err := fmt.Errorf("panic: %v", p)
+	if opt.PanicDir != "" {
+		file, werr := writePanicBundle(image, p, stack, opt, progress)
+		if werr != nil {
+			logrus.Errorf("failed to write panic diagnostics: %s", werr)
+		} else {
+			logrus.Errorf("panic diagnostics of image [%s] written to %s", image.String(), file)
+			err = fmt.Errorf("panic: %v, diagnostics: %s", p, file)
+		}
+	}
+	image.Success, image.Skipped = false, false
+	image.Err = newSyncError(PhaseCopy, image, opt, image.Attempts, err)
+}
+
+func writePanicBundle(image *Image, p interface{}, stack string, opt *SyncOption, progress *runProgress) (string, error) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	now := time.Now().UTC()
+	bundle := panicBundle{
+		Time:        now,
+		Image:       image.String(),
+		Destination: destinationImage(image, opt).String(),
+		Digest:      image.Digest.String(),
+		Attempts:    image.Attempts,
+		Panic:       Redact(fmt.Sprint(p)),
+		Stack:       stack,
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   ms.HeapAlloc,
+		Logs:        recentLogs.snapshot(),
+	}
+	if progress != nil {
+		bundle.Progress = progress.String(opt)
+	}
+	bs, err := jsoniter.MarshalIndent(&bundle, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(opt.PanicDir, fmt.Sprintf("imgsync_panic_%s.json", now.Format("20060102T150405.000000000")))
+	return file, ioutil.WriteFile(file, bs, 0644)
+}
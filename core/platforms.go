@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// platformFileSuffix is the suffix of the platform manifest files stored in
+// the tag directory of manifest lists, e.g. pause/3.2/linux-arm64.platform.json
+const platformFileSuffix = ".platform.json"
+
+// configFileSuffix is the suffix of the stored image config files
+const configFileSuffix = ".config.json"
+
+// platformInstance is a platform manifest of a manifest list.
+type platformInstance struct {
+	name     string // os-architecture[-variant]
+	digest   digest.Digest
+	platform *imgspecv1.Platform
+}
+
+// listPlatforms returns the platform manifests of the manifest list,
+// platforms listed more than once are suffixed with their digest.
+func listPlatforms(l manifest.List) []platformInstance {
+	var platforms []platformInstance
+	add := func(p *imgspecv1.Platform, d digest.Digest) {
+		name := "unknown"
+		if p != nil {
+			name = strings.Join([]string{p.OS, p.Architecture}, "-")
+			if p.Variant != "" {
+				name += "-" + p.Variant
+			}
+		}
+		platforms = append(platforms, platformInstance{name: name, digest: d, platform: p})
+	}
+	switch list := l.(type) {
+	case *manifest.Schema2List:
+		for _, m := range list.Manifests {
+			add(&imgspecv1.Platform{OS: m.Platform.OS, Architecture: m.Platform.Architecture, Variant: m.Platform.Variant}, m.Digest)
+		}
+	case *manifest.OCI1Index:
+		for _, m := range list.Manifests {
+			add(m.Platform, m.Digest)
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, p := range platforms {
+		seen[p.name]++
+	}
+	for i, p := range platforms {
+		if seen[p.name] > 1 {
+			platforms[i].name += "-" + p.digest.Encoded()[:12]
+		}
+	}
+	return platforms
+}
+
+// storeImageConfig stores the config blob of the image manifest as <tag>.config.json
+func storeImageConfig(ctx context.Context, image *Image, m manifest.Manifest) error {
+	info := m.ConfigInfo()
+	if info.Digest == "" {
+		// docker schema1 manifests have no config blob
+		return nil
+	}
+	bs, err := fetchConfigBlob(ctx, image, info)
+	if err != nil {
+		return err
+	}
+	return storage.Put(manifestFileName(image, configFileSuffix), bs)
+}
+
+// storePlatformManifests stores the platform manifests of the image manifest
+// list as is, so their digests can be verified offline. The platform config
+// blobs are stored as <platform>.config.json with opt.StoreConfig.
+func storePlatformManifests(ctx context.Context, image *Image, l manifest.List, opt *SyncOption) error {
+	sys := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
+	for _, p := range listPlatforms(l) {
+		var mbs []byte
+		err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+			return limiter.do(ctx, func() error {
+				var gerr error
+				mbs, gerr = getManifestBlob(ctx, fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), p.digest), sys)
+				return gerr
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get image [%s] platform %s manifest: %s", image.String(), p.name, err)
+		}
+		dir := path.Join(image.Repo, image.User, image.Name, image.Tag)
+		if opt.PlatformManifests {
+			if err = storage.Put(path.Join(dir, p.name+platformFileSuffix), mbs); err != nil {
+				return err
+			}
+		}
+		if !opt.StoreConfig {
+			continue
+		}
+		m, err := manifest.FromBlob(mbs, manifest.GuessMIMEType(mbs))
+		if err != nil {
+			return fmt.Errorf("invalid image [%s] platform %s manifest: %s", image.String(), p.name, err)
+		}
+		if m.ConfigInfo().Digest == "" {
+			continue
+		}
+		bs, err := fetchConfigBlob(ctx, image, m.ConfigInfo())
+		if err != nil {
+			return err
+		}
+		if err = storage.Put(path.Join(dir, p.name+configFileSuffix), bs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fetchConfigBlob(ctx context.Context, image *Image, info types.BlobInfo) ([]byte, error) {
+	var bs []byte
+	err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+		return limiter.do(ctx, func() error {
+			var gerr error
+			bs, gerr = getConfigBlob(ctx, image.Repo+"/"+image.Repository(), info)
+			return gerr
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image [%s] config: %s", image.String(), err)
+	}
+	return bs, nil
+}
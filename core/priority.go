@@ -0,0 +1,55 @@
+package core
+
+import (
+	"path"
+	"sort"
+)
+
+const (
+	OrderNone   = ""       // Keep the synchronizer order
+	OrderNewest = "newest" // Sync the highest semver tags first
+)
+
+// prioritize orders the images to sync, images matching the priority list
+// come first in the list order, e.g. pause,coredns,etcd. The priority list
+// entries match image names or repositories and may contain glob patterns.
+func prioritize(images Images, opt *SyncOption) {
+	if len(opt.Priority) == 0 && opt.Order == OrderNone {
+		return
+	}
+	rank := func(img *Image) int {
+		for i, p := range opt.Priority {
+			if ok, _ := path.Match(p, img.Name); ok {
+				return i
+			}
+			if ok, _ := path.Match(p, img.Repository()); ok {
+				return i
+			}
+		}
+		return len(opt.Priority)
+	}
+	ranks := make(map[*Image]int, len(images))
+	versions := make(map[*Image][]int, len(images))
+	for _, img := range images {
+		ranks[img] = rank(img)
+		if v, ok := parseSemverTag(img.Tag); ok {
+			versions[img] = v
+		}
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		a, b := images[i], images[j]
+		if ranks[a] != ranks[b] {
+			return ranks[a] < ranks[b]
+		}
+		if opt.Order != OrderNewest {
+			return false
+		}
+		va, aok := versions[a]
+		vb, bok := versions[b]
+		if aok != bok {
+			return aok
+		}
+		return aok && semverLess(vb, va)
+	})
+}
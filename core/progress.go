@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultProgressInterval is the interval of the run progress logs
+const DefaultProgressInterval = time.Minute
+
+// runProgress tracks the completed images and copied bytes of a run.
+type runProgress struct {
+	start  time.Time
+	total  int64 // images to sync, received images while they are still listed
+	listed bool  // all images are known, the ETA is only logged then
+	done   int64
+	copied int64
+}
+
+// newRunProgress returns the progress of total images, a negative total
+// counts the images as they are received.
+func newRunProgress(total int) *runProgress {
+	rp := &runProgress{start: time.Now(), listed: total >= 0}
+	if total > 0 {
+		rp.total = int64(total)
+	}
+	return rp
+}
+
+func (rp *runProgress) receive() {
+	if !rp.listed {
+		atomic.AddInt64(&rp.total, 1)
+	}
+}
+
+// complete records a processed image and the bytes copied for it.
+func (rp *runProgress) complete(copied int64) {
+	atomic.AddInt64(&rp.done, 1)
+	atomic.AddInt64(&rp.copied, copied)
+}
+
+// watch logs the progress every interval until stop is called.
+func (rp *runProgress) watch(interval time.Duration, opt *SyncOption) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				logrus.Info(rp.String(opt))
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(quit)
+	}
+}
+
+// String formats the progress, e.g.
+//
+//	batch 2/10: 1234/5000 done, 420.0GB copied, 35.2MB/s, ETA 2h13m
+func (rp *runProgress) String(opt *SyncOption) string {
+	done, total, copied := atomic.LoadInt64(&rp.done), atomic.LoadInt64(&rp.total), atomic.LoadInt64(&rp.copied)
+	elapsed := time.Since(rp.start)
+	s := fmt.Sprintf("%d/%d done, %s copied", done, total, humanSize(copied))
+	if !rp.listed {
+		s = fmt.Sprintf("%d/%d done(listing), %s copied", done, total, humanSize(copied))
+	}
+	if secs := elapsed.Seconds(); secs >= 1 {
+		s += fmt.Sprintf(", %s/s", humanSize(int64(float64(copied)/secs)))
+	}
+	if rp.listed && done > 0 && done < total {
+		eta := time.Duration(float64(elapsed) / float64(done) * float64(total-done))
+		if eta < time.Minute {
+			s += ", ETA " + eta.Round(time.Second).String()
+		} else {
+			s += ", ETA " + strings.TrimSuffix(eta.Round(time.Minute).String(), "0s")
+		}
+	}
+	if opt.BatchTotal > 1 && opt.BatchNumber > 0 {
+		s = fmt.Sprintf("batch %d/%d: %s", opt.BatchNumber, opt.BatchTotal, s)
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkDestinationTag checks whether syncing the image overwrites an existing
+// destination tag with a different digest, which is only allowed with opt.Force.
+// Destination tags which already have the source digest are marked present.
+func checkDestinationTag(ctx context.Context, image *Image, opt *SyncOption) (bool, error) {
+	// filtered or converted manifests never match the source digest
+	if opt.ContainerdNamespace != "" || opt.Recompress != "" || filtersPlatforms(opt) || (image.Schema1 && schema1MIMEType(opt) != "") {
+		return true, nil
+	}
+	destImage := destinationImage(image, opt)
+	client := newRegistryClient(destImage.Repo, opt.User, opt.Password)
+	dgst, exists, err := client.headManifest(ctx, destImage.Repository(), destImage.Tag)
+	if err != nil {
+		return false, err
+	}
+	if !exists || dgst == "" {
+		return true, nil
+	}
+	if dgst == image.Digest {
+		image.DestDigest = dgst
+		image.DestPresent = true
+		return true, nil
+	}
+	if !opt.Force {
+		image.Skip(fmt.Sprintf("destination tag exists with a different digest %s, use --force to overwrite", dgst))
+		return false, nil
+	}
+	if !confirm(opt, "overwrite destination tag %s digest %s with %s?", destImage.String(), dgst, image.Digest) {
+		image.Skip(fmt.Sprintf("overwriting destination tag digest %s not confirmed", dgst))
+		return false, nil
+	}
+	image.Overwritten = dgst
+	logrus.Warnf("overwrite image [%s] digest %s with %s", destImage.String(), dgst, image.Digest)
+	return true, nil
+}
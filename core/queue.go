@@ -0,0 +1,186 @@
+package core
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueStatusSuccess = "success"
+	queueStatusSkipped = "skipped"
+	queueStatusFailed  = "failed"
+)
+
+// queueEntry is a line of the work queue file, the listed images are written
+// when the queue is created and the status of processed images is appended.
+type queueEntry struct {
+	Image  *queueImage `json:"image,omitempty"`
+	Done   string      `json:"done,omitempty"`
+	Status string      `json:"status,omitempty"`
+}
+
+type queueImage struct {
+	Repo string `json:"repo"`
+	User string `json:"user,omitempty"`
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+// queuedImages returns the images of the work queue file which have not been
+// processed yet, failed images are retried. If the queue file does not exist,
+// the images are listed and written to a new queue file.
+func queuedImages(opt *SyncOption, list func() Images) Images {
+	if opt.QueueFile == "" {
+		return list()
+	}
+	images, done, err := readQueue(opt.QueueFile)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Fatalf("failed to read work queue: %s", err)
+	}
+	if err == nil {
+		var pending Images
+		for _, img := range images {
+			if status := done[img.String()]; status != queueStatusSuccess && status != queueStatusSkipped {
+				pending = append(pending, img)
+			}
+		}
+		logrus.Infof("continue work queue [%s], pending images: %d/%d", opt.QueueFile, len(pending), len(images))
+		return pending
+	}
+
+	images = list()
+	if err = writeQueue(opt.QueueFile, images); err != nil {
+		logrus.Fatalf("failed to write work queue: %s", err)
+	}
+	return images
+}
+
+func readQueue(path string) (Images, map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var images Images
+	done := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e queueEntry
+		// a crash may leave a partial last line
+		if jerr := jsoniter.Unmarshal(scanner.Bytes(), &e); jerr != nil {
+			logrus.Warnf("ignore invalid work queue entry: %s", scanner.Text())
+			continue
+		}
+		if e.Image != nil {
+			images = append(images, &Image{Repo: e.Image.Repo, User: e.Image.User, Name: e.Image.Name, Tag: e.Image.Tag})
+		} else if e.Done != "" {
+			done[e.Done] = e.Status
+		}
+	}
+	return images, done, scanner.Err()
+}
+
+// writeQueue writes the work queue to a temporary file in the same directory
+// and renames it, an interrupted write never truncates the previous queue.
+func writeQueue(path string, images Images) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err = f.Chmod(0644); err == nil {
+		err = writeQueueEntries(f, images)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func writeQueueEntries(f *os.File, images Images) error {
+	w := bufio.NewWriter(f)
+	for _, img := range images {
+		bs, err := jsoniter.Marshal(&queueEntry{Image: &queueImage{Repo: img.Repo, User: img.User, Name: img.Name, Tag: img.Tag}})
+		if err != nil {
+			return err
+		}
+		_, _ = w.Write(append(bs, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// workQueue appends the status of processed images to the work queue file.
+type workQueue struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openWorkQueue(path string) (*workQueue, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &workQueue{path: path, f: f}, nil
+}
+
+func (q *workQueue) record(image *Image) {
+	status := queueStatusFailed
+	if image.Success {
+		status = queueStatusSuccess
+	} else if image.Skipped {
+		status = queueStatusSkipped
+	}
+	bs, _ := jsoniter.Marshal(&queueEntry{Done: image.String(), Status: status})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.f.Write(append(bs, '\n')); err != nil {
+		logrus.Errorf("failed to record image [%s] in work queue: %s", image.String(), err)
+	}
+}
+
+// close closes the queue file, it is removed once all queued images have
+// been processed, so the next run lists the images again.
+func (q *workQueue) close() {
+	_ = q.f.Close()
+	images, done, err := readQueue(q.path)
+	if err != nil {
+		logrus.Errorf("failed to read work queue: %s", err)
+		return
+	}
+	var pending int
+	for _, img := range images {
+		if done[img.String()] == "" {
+			pending++
+		}
+	}
+	if pending > 0 {
+		logrus.Infof("work queue [%s] pending images: %d", q.path, pending)
+		return
+	}
+	if err = os.Remove(q.path); err != nil {
+		logrus.Errorf("failed to remove completed work queue: %s", err)
+	}
+}
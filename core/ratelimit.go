@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultRateLimitPause = 1 * time.Minute
+
+	// DefaultRateLimitStorm is the count of rate limited requests within
+	// rateLimitStormWindow which pauses all workers
+	DefaultRateLimitStorm = 3
+	rateLimitStormWindow  = 10 * time.Second
+
+	// maximum number of rate limit pauses for a single image,
+	// these pauses are not counted as sync retries
+	defaultRateLimitRetry = 10
+)
+
+var limiter = rateLimiter{pause: DefaultRateLimitPause, storm: DefaultRateLimitStorm}
+
+// rateLimiter pauses all workers while the registry rate limit is exhausted.
+// A single rate limited request only delays its own caller, a burst of them
+// (a 429 storm of the destination) pauses all workers for the advertised
+// Retry-After window, so the in-flight images do not fail one by one.
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+	pause time.Duration
+
+	storm      int         // rate limited requests within rateLimitStormWindow which pause all workers
+	hits       []time.Time // rate limited requests within rateLimitStormWindow
+	retryUntil time.Time   // end of the last advertised Retry-After window
+
+	budget  time.Duration // run time budget, pauses never outlast it
+	maxWait time.Duration // image timeout, longer pauses fail the images as rate limited
+}
+
+// configure sets the limits of the sync options, it is called before any
+// worker starts.
+func (rl *rateLimiter) configure(opt *SyncOption) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if opt.RateLimitPause > 0 {
+		rl.pause = opt.RateLimitPause
+	}
+	if opt.RateLimitStorm > 0 {
+		rl.storm = opt.RateLimitStorm
+	}
+	rl.budget = opt.MaxDuration
+	rl.maxWait = opt.Timeout
+}
+
+// reset clears the pauses and rate limited requests of the previous run.
+func (rl *rateLimiter) reset() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.until, rl.retryUntil, rl.hits = time.Time{}, time.Time{}, nil
+}
+
+// wait blocks until the pause window has passed or ctx is done. A pause
+// longer than the image timeout fails at once as rate limited.
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	for {
+		rl.mu.Lock()
+		d := time.Until(rl.until)
+		maxWait := rl.maxWait
+		rl.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		if maxWait > 0 && d > maxWait {
+			return withClass(ErrRateLimited, fmt.Errorf("registry rate limit pause of %s exceeds the image timeout %s", d.Round(time.Second), maxWait))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// block pauses all workers for d, an existing longer pause is kept. The
+// pause is capped at the rest of the run time budget.
+func (rl *rateLimiter) block(d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if d <= 0 {
+		d = rl.pause
+	}
+	if rl.budget > 0 {
+		if left := time.Until(runStart.Add(rl.budget)); d > left {
+			d = left
+		}
+	}
+	if d <= 0 {
+		return
+	}
+	until := time.Now().Add(d)
+	if until.After(rl.until) {
+		logrus.Warnf("registry rate limit reached, pause all workers for %s", d)
+		rl.until = until
+	}
+}
+
+// observe checks the rate limit headers of a registry response. Only the
+// requests sent by registryHTTPClient are observed (tag lists, manifest
+// checks, blob uploads), the image copies of containers/image use their own
+// transport and only fail with 429 when the limit is exhausted.
+func (rl *rateLimiter) observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rl.advertise(retryAfter(resp))
+		return
+	}
+	// RateLimit-Remaining: 0;w=21600
+	remaining, window, ok := parseRateLimit(resp.Header.Get("RateLimit-Remaining"))
+	if ok && remaining == 0 {
+		rl.block(window)
+	}
+}
+
+// advertise records the Retry-After window of a rate limited response.
+func (rl *rateLimiter) advertise(after time.Duration) {
+	if after <= 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if until := time.Now().Add(after); until.After(rl.retryUntil) {
+		rl.retryUntil = until
+	}
+}
+
+// limited records a rate limited request, it returns the time to wait before
+// the next request, the rest of the advertised Retry-After window or the
+// pause, and whether the requests burst is a storm which pauses all workers.
+func (rl *rateLimiter) limited() (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	hits := rl.hits[:0]
+	for _, t := range rl.hits {
+		if now.Sub(t) < rateLimitStormWindow {
+			hits = append(hits, t)
+		}
+	}
+	rl.hits = append(hits, now)
+
+	d := rl.pause
+	if rl.retryUntil.After(now) {
+		d = rl.retryUntil.Sub(now)
+	}
+	storm := rl.storm <= 1 || len(rl.hits) >= rl.storm
+	if storm && len(rl.hits) == rl.storm {
+		logrus.Warnf("%d rate limited requests within %s", len(rl.hits), rateLimitStormWindow)
+	}
+	return d, storm
+}
+
+// do runs f, running f again if it is rate limited. The rate limited caller
+// waits by itself, all workers are paused on a rate limit storm.
+func (rl *rateLimiter) do(ctx context.Context, f func() error) error {
+	var err error
+	for i := 0; i < defaultRateLimitRetry; i++ {
+		if err = rl.wait(ctx); err != nil {
+			return err
+		}
+		if err = f(); !isRateLimited(err) {
+			return err
+		}
+		d, storm := rl.limited()
+		if storm {
+			rl.block(d)
+			continue
+		}
+		rl.mu.Lock()
+		maxWait := rl.maxWait
+		rl.mu.Unlock()
+		if maxWait > 0 && d > maxWait {
+			return err
+		}
+		logrus.Debugf("rate limited, retry in %s", d)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	return err
+}
+
+func isRateLimited(err error) bool {
+	return errors.Is(classify(err), ErrRateLimited)
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	after := resp.Header.Get("Retry-After")
+	if after == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(after); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(after); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// parseRateLimit parses the docker hub rate limit header value, e.g. "100;w=21600".
+func parseRateLimit(val string) (int, time.Duration, bool) {
+	if val == "" {
+		return 0, 0, false
+	}
+	ss := strings.Split(val, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(ss[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, s := range ss[1:] {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "w=") {
+			if secs, werr := strconv.Atoi(strings.TrimPrefix(s, "w=")); werr == nil {
+				window = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "******"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string              // static credentials, e.g. passwords and keys
+	tokens    = map[string]string{} // the latest short-lived token of each registry
+	replacer  = strings.NewReplacer()
+
+	// credentials patterns which may be echoed by registries or http clients
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(authorization:\s*(?:bearer|basic)\s+)[^\s"']+`),
+		regexp.MustCompile(`(?i)("(?:token|access_token|refresh_token|password)"\s*:\s*")[^"]*`),
+		regexp.MustCompile(`(?i)((?:password|passwd|token)=)[^\s&"']+`),
+		regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+	}
+)
+
+// RegisterSecret registers a secret value which is redacted from
+// all logs, errors and reports.
+func RegisterSecret(secret string) {
+	// too short values would redact unrelated text
+	if len(secret) < 4 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+	rebuildReplacer()
+}
+
+// RegisterToken registers the short-lived token of the registry, it replaces
+// the previous token of the registry so refreshed tokens do not pile up.
+func RegisterToken(registry, token string) {
+	if len(token) < 4 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if tokens[registry] == token {
+		return
+	}
+	tokens[registry] = token
+	rebuildReplacer()
+}
+
+// rebuildReplacer rebuilds the replacer of the registered secrets, secretsMu
+// must be held.
+func rebuildReplacer() {
+	oldnew := make([]string, 0, 2*(len(secrets)+len(tokens)))
+	for _, secret := range secrets {
+		oldnew = append(oldnew, secret, redacted)
+	}
+	for _, token := range tokens {
+		oldnew = append(oldnew, token, redacted)
+	}
+	replacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact removes the registered secrets and known credentials patterns from s.
+func Redact(s string) string {
+	secretsMu.RLock()
+	r := replacer
+	secretsMu.RUnlock()
+	s = r.Replace(s)
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}"+redacted+"${2}")
+	}
+	return s
+}
+
+// RedactFormatter is a logrus formatter which redacts the formatted entries.
+type RedactFormatter struct {
+	logrus.Formatter
+}
+
+func (f *RedactFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	bs, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(Redact(string(bs))), nil
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// referrerDescriptor is an OCI 1.1 descriptor with artifact type.
+type referrerDescriptor struct {
+	imgspecv1.Descriptor
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// listReferrers queries the OCI 1.1 referrers api of the image source registry,
+// registries which do not support the api return no referrers.
+func listReferrers(ctx context.Context, image *Image, dgst digest.Digest) ([]referrerDescriptor, error) {
+	client := newRegistryClient(image.Repo, "", "")
+	header := http.Header{"Accept": []string{imgspecv1.MediaTypeImageIndex}}
+	resp, err := client.do(ctx, http.MethodGet, image.Repository(), "referrers/"+dgst.String(), header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusBadRequest:
+		logrus.Debugf("registry %s does not support the referrers api", image.Repo)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to list image [%s] referrers, status: %s", image.String(), resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var index struct {
+		Manifests []referrerDescriptor `json:"manifests"`
+	}
+	if err = jsoniter.Unmarshal(body, &index); err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// copyReferrers copies the artifacts (SBOMs, provenance, signatures) which refer
+// to the synced image digest, the artifacts keep their digests on the destination.
+func copyReferrers(ctx context.Context, image *Image, opt *SyncOption) error {
+	if image.Digest == "" {
+		return nil
+	}
+	referrers, err := listReferrers(ctx, image, image.Digest)
+	if err != nil {
+		return err
+	}
+	destImage := destinationImage(image, opt)
+	for _, r := range referrers {
+		src := fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), r.Digest)
+		dest := fmt.Sprintf("%s/%s@%s", destImage.Repo, destImage.Repository(), r.Digest)
+		logrus.Debugf("copy image [%s] referrer %s (%s)", image.String(), r.Digest, r.ArtifactType)
+		if err = copyReference(ctx, src, dest, opt); err != nil {
+			return fmt.Errorf("failed to copy image [%s] referrer %s: %s", image.String(), r.Digest, err)
+		}
+	}
+	if len(referrers) > 0 {
+		logrus.Infof("copied %d referrers of image [%s]", len(referrers), image.String())
+	}
+	image.Referrers = len(referrers)
+	return nil
+}
+
+// emptyConfig is the OCI 1.1 empty config descriptor of artifact manifests.
+var emptyConfig = imgspecv1.Descriptor{
+	MediaType: "application/vnd.oci.empty.v1+json",
+	Digest:    digest.FromBytes([]byte("{}")),
+	Size:      2,
+}
+
+// referrerManifest is an OCI 1.1 artifact manifest which refers to its subject.
+type referrerManifest struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	MediaType     string                 `json:"mediaType"`
+	ArtifactType  string                 `json:"artifactType"`
+	Config        imgspecv1.Descriptor   `json:"config"`
+	Layers        []imgspecv1.Descriptor `json:"layers"`
+	Subject       *imgspecv1.Descriptor  `json:"subject"`
+}
+
+// pushReferrer pushes the artifact to the destination as an OCI referrer of
+// the synced image, the artifact manifest is pushed by digest.
+func pushReferrer(ctx context.Context, image *Image, artifactType string, data []byte, opt *SyncOption) error {
+	if _, err := destinationDigestRef(ctx, image, opt); err != nil {
+		return err
+	}
+	destImage := destinationImage(image, opt)
+	client := newRegistryClient(destImage.Repo, opt.User, opt.Password)
+	subject, mType, err := client.getManifest(ctx, destImage.Repository(), image.DestDigest.String())
+	if err != nil {
+		return err
+	}
+
+	if _, err = client.putBlob(ctx, destImage.Repository(), []byte("{}")); err != nil {
+		return err
+	}
+	layer, err := client.putBlob(ctx, destImage.Repository(), data)
+	if err != nil {
+		return err
+	}
+	m := referrerManifest{
+		SchemaVersion: 2,
+		MediaType:     imgspecv1.MediaTypeImageManifest,
+		ArtifactType:  artifactType,
+		Config:        emptyConfig,
+		Layers:        []imgspecv1.Descriptor{{MediaType: artifactType, Digest: layer, Size: int64(len(data))}},
+		Subject:       &imgspecv1.Descriptor{MediaType: mType, Digest: digest.FromBytes(subject), Size: int64(len(subject))},
+	}
+	mbs, err := jsoniter.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dgst := digest.FromBytes(mbs)
+	if err = client.putManifest(ctx, destImage.Repository(), dgst.String(), mbs, imgspecv1.MediaTypeImageManifest); err != nil {
+		return err
+	}
+	logrus.Debugf("pushed image [%s] referrer %s (%s)", image.String(), dgst, artifactType)
+	return nil
+}
@@ -0,0 +1,333 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/manifest"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+const dockerHubRegistryHost = "registry-1.docker.io"
+
+// registryClient is a minimal docker registry v2 api client, it is used for
+// the api calls which containers/image does not expose.
+type registryClient struct {
+	host     string
+	user     string
+	password string
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer tokens by scope
+}
+
+func newRegistryClient(host, user, password string) *registryClient {
+	if host == defaultDockerRepo {
+		host = dockerHubRegistryHost
+	}
+	return &registryClient{
+		host:     host,
+		user:     user,
+		password: password,
+		tokens:   make(map[string]string),
+	}
+}
+
+// do sends a request to /v2/<repo>/<path>, it authorizes the request with a
+// bearer token when the registry challenges it.
+func (c *registryClient) do(ctx context.Context, method, repo, path string, header http.Header, body []byte) (*http.Response, error) {
+	return c.doURL(ctx, method, repo, fmt.Sprintf("https://%s/v2/%s/%s", c.host, repo, path), header, body)
+}
+
+// doURL sends a request to the registry address of the repository, e.g. a
+// blob upload location.
+func (c *registryClient) doURL(ctx context.Context, method, repo, addr string, header http.Header, body []byte) (*http.Response, error) {
+	scope := c.scope(method, repo, addr)
+	send := func() (*http.Response, error) {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := c.newRequest(ctx, method, scope, addr, header, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		return registryHTTPClient.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	drainBody(resp)
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, withClass(ErrAuth, fmt.Errorf("unauthorized: %s %s", method, addr))
+	}
+	if err = c.fetchToken(ctx, challenge, scope); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// stream sends the body stream to the registry address of the repository
+// without the request timeout. An expired token is refreshed and the request
+// sent again if the registry rejected it before reading the stream, else the
+// error is not an auth error so the upload is retried from its session.
+func (c *registryClient) stream(ctx context.Context, method, repo, addr string, header http.Header, body io.Reader) (*http.Response, error) {
+	scope := c.scope(method, repo, addr)
+	for attempt := 0; ; attempt++ {
+		counter := &countingReader{r: body}
+		req, err := c.newRequest(ctx, method, scope, addr, header, counter)
+		if err != nil {
+			return nil, err
+		}
+		// the stream is only sent once the registry accepted the request
+		req.Header.Set("Expect", "100-continue")
+		resp, err := uploadHTTPClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		drainBody(resp)
+		if attempt > 0 || !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, withClass(ErrAuth, fmt.Errorf("unauthorized: %s %s", method, addr))
+		}
+		if err = c.fetchToken(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+		if counter.n > 0 {
+			return nil, fmt.Errorf("token expired while streaming %s %s, refreshed", method, addr)
+		}
+	}
+}
+
+// uploadURL returns the absolute address of the upload location, empty if
+// the location is empty.
+func (c *registryClient) uploadURL(location string) string {
+	if location == "" || strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location
+	}
+	return "https://" + c.host + "/" + strings.TrimPrefix(location, "/")
+}
+
+// scope returns the token scope of the request, the blob upload requests
+// need the push scope, e.g. the upload status.
+func (c *registryClient) scope(method, repo, addr string) string {
+	scope := fmt.Sprintf("repository:%s:pull", repo)
+	if (method != http.MethodGet && method != http.MethodHead) || strings.Contains(addr, "/blobs/uploads/") {
+		scope += ",push"
+	}
+	return scope
+}
+
+// newRequest returns the request authorized with the token of the scope, or
+// the basic auth credentials before the registry challenged the requests.
+func (c *registryClient) newRequest(ctx context.Context, method, scope, addr string, header http.Header, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, addr, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if req.URL.Host != c.host {
+		// upload locations on other hosts, e.g. a storage backend, are presigned
+		logrus.Tracef("%s %s", method, addr)
+		return req, nil
+	}
+	c.mu.Lock()
+	token := c.tokens[scope]
+	c.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	logrus.Tracef("%s %s", method, addr)
+	return req, nil
+}
+
+func (c *registryClient) fetchToken(ctx context.Context, challenge, scope string) error {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("invalid auth challenge: %s", challenge)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := registryHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, "failed to get registry token")
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	token := jsoniter.Get(body, "token").ToString()
+	if token == "" {
+		token = jsoniter.Get(body, "access_token").ToString()
+	}
+	RegisterToken(c.host, token)
+	c.mu.Lock()
+	c.tokens[scope] = token
+	c.mu.Unlock()
+	return nil
+}
+
+// manifestAcceptTypes are the manifest types accepted by manifest requests.
+var manifestAcceptTypes = []string{
+	manifest.DockerV2ListMediaType,
+	manifest.DockerV2Schema2MediaType,
+	manifest.DockerV2Schema1SignedMediaType,
+	manifest.DockerV2Schema1MediaType,
+	imgspecv1.MediaTypeImageIndex,
+	imgspecv1.MediaTypeImageManifest,
+}
+
+// headManifest returns the manifest digest of the repository tag or digest,
+// the returned bool is false if the manifest does not exist.
+func (c *registryClient) headManifest(ctx context.Context, repo, ref string) (digest.Digest, bool, error) {
+	header := http.Header{"Accept": manifestAcceptTypes}
+	resp, err := c.do(ctx, http.MethodHead, repo, "manifests/"+ref, header, nil)
+	if err != nil {
+		return "", false, err
+	}
+	drainBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return digest.Digest(resp.Header.Get("Docker-Content-Digest")), true, nil
+	case http.StatusNotFound:
+		return "", false, nil
+	default:
+		return "", false, statusError(resp, "failed to query manifest %s/%s:%s", c.host, repo, ref)
+	}
+}
+
+// getManifest returns the manifest and its media type of the repository tag or digest.
+func (c *registryClient) getManifest(ctx context.Context, repo, ref string) ([]byte, string, error) {
+	header := http.Header{"Accept": manifestAcceptTypes}
+	resp, err := c.do(ctx, http.MethodGet, repo, "manifests/"+ref, header, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", statusError(resp, "failed to get manifest %s/%s:%s", c.host, repo, ref)
+	}
+	mbs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	mType := resp.Header.Get("Content-Type")
+	if mType == "" {
+		mType = manifest.GuessMIMEType(mbs)
+	}
+	return mbs, mType, nil
+}
+
+// putManifest uploads the manifest to the repository tag.
+func (c *registryClient) putManifest(ctx context.Context, repo, tag string, mbs []byte, mType string) error {
+	header := http.Header{"Content-Type": []string{mType}}
+	resp, err := c.do(ctx, http.MethodPut, repo, "manifests/"+tag, header, mbs)
+	if err != nil {
+		return err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return statusError(resp, "failed to put manifest %s/%s:%s", c.host, repo, tag)
+	}
+	return nil
+}
+
+// putBlob uploads the blob to the repository in a single request, blobs the
+// repository already has are not uploaded again.
+func (c *registryClient) putBlob(ctx context.Context, repo string, blob []byte) (digest.Digest, error) {
+	dgst := digest.FromBytes(blob)
+	resp, err := c.do(ctx, http.MethodHead, repo, "blobs/"+dgst.String(), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	drainBody(resp)
+	if resp.StatusCode == http.StatusOK {
+		return dgst, nil
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, repo, "blobs/uploads/", nil, []byte{})
+	if err != nil {
+		return "", err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusAccepted {
+		return "", statusError(resp, "failed to start blob %s upload", dgst)
+	}
+	location := c.uploadURL(resp.Header.Get("Location"))
+	if location == "" {
+		return "", fmt.Errorf("failed to start blob %s upload: no upload location", dgst)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("digest", dgst.String())
+	u.RawQuery = q.Encode()
+
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	resp, err = c.doURL(ctx, http.MethodPut, repo, u.String(), header, blob)
+	if err != nil {
+		return "", err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusCreated {
+		return "", statusError(resp, "failed to upload blob %s", dgst)
+	}
+	return dgst, nil
+}
+
+var challengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseChallenge parses the WWW-Authenticate header parameters,
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+	for _, m := range challengeParamRe.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	return params
+}
+
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
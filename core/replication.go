@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// harborRegistry is a registry endpoint of harbor which replications pull from.
+type harborRegistry struct {
+	ID       int64  `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Insecure bool   `json:"insecure"`
+}
+
+type harborFilter struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type harborTrigger struct {
+	Type     string                 `json:"type"`
+	Settings *harborTriggerSettings `json:"trigger_settings,omitempty"`
+}
+
+type harborTriggerSettings struct {
+	Cron string `json:"cron"`
+}
+
+// harborPolicy is a pull based replication policy of a source repository.
+type harborPolicy struct {
+	ID            int64           `json:"id,omitempty"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	SrcRegistry   *harborRegistry `json:"src_registry"`
+	DestNamespace string          `json:"dest_namespace"`
+	// the leading source path components replaced by the destination namespace
+	DestNamespaceReplaceCount int            `json:"dest_namespace_replace_count"`
+	Filters                   []harborFilter `json:"filters"`
+	Trigger                   harborTrigger  `json:"trigger"`
+	Enabled                   bool           `json:"enabled"`
+	Override                  bool           `json:"override"`
+
+	images Images // images replicated by the policy
+}
+
+var policyNameRe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// replicationPolicies returns the replication policies of the images, one
+// policy per source repository filtering its listed tags.
+func replicationPolicies(images Images, opt *SyncOption) []*harborPolicy {
+	sources := make(map[string]Images)
+	for _, img := range images {
+		if img.Tag == latestTag && (opt.LatestPolicy == LatestSkip || opt.LatestPolicy == LatestSemver) {
+			img.Skip("latest tag policy: " + opt.LatestPolicy)
+			continue
+		}
+		repo := img.Repo + "/" + img.Repository()
+		sources[repo] = append(sources[repo], img)
+		img.Success = true
+	}
+
+	trigger := harborTrigger{Type: "manual"}
+	if opt.ReplicationCron != "" {
+		trigger = harborTrigger{Type: "scheduled", Settings: &harborTriggerSettings{Cron: opt.ReplicationCron}}
+	}
+	var policies []*harborPolicy
+	for repo, imgs := range sources {
+		img := imgs[0]
+		var repoTags []string
+		for _, i := range imgs {
+			repoTags = append(repoTags, i.Tag)
+		}
+		sort.Strings(repoTags)
+		tagFilter := repoTags[0]
+		if len(repoTags) > 1 {
+			tagFilter = "{" + strings.Join(repoTags, ",") + "}"
+		}
+		policies = append(policies, &harborPolicy{
+			Name:                      "imgsync-" + strings.Trim(policyNameRe.ReplaceAllString(strings.ToLower(repo), "-"), "-"),
+			Description:               "Mirror of " + repo + ", generated by imgsync",
+			SrcRegistry:               harborSourceRegistry(img.Repo),
+			DestNamespace:             destinationNamespace(opt),
+			DestNamespaceReplaceCount: strings.Count(img.Repository(), "/"),
+			Filters: []harborFilter{
+				{Type: "name", Value: img.Repository()},
+				{Type: "tag", Value: tagFilter},
+			},
+			Trigger:  trigger,
+			Enabled:  true,
+			Override: opt.Force,
+			images:   imgs,
+		})
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// harborSourceRegistry returns the harbor registry endpoint of the source registry host.
+func harborSourceRegistry(host string) *harborRegistry {
+	if host == defaultDockerRepo {
+		return &harborRegistry{Name: "imgsync-docker-hub", Type: "docker-hub", URL: "https://hub.docker.com"}
+	}
+	return &harborRegistry{Name: "imgsync-" + host, Type: "docker-registry", URL: "https://" + host}
+}
+
+// replicateImages creates or updates the harbor replication policies of the
+// images on the destination registry instead of syncing them, with
+// opt.ReplicationRulesFile the policies are only written to the file.
+func replicateImages(ctx context.Context, images Images, opt *SyncOption) Images {
+	policies := replicationPolicies(images, opt)
+	if opt.ReplicationRulesFile != "" {
+		bs, err := jsoniter.MarshalIndent(policies, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(opt.ReplicationRulesFile, bs, 0644)
+		}
+		if err != nil {
+			logrus.Fatalf("failed to write replication rules file: %s", err)
+		}
+		logrus.Infof("wrote %d replication rules to %s", len(policies), opt.ReplicationRulesFile)
+		return images
+	}
+
+	host := destinationRegistry(opt)
+	client := newHarborClient(host, opt.User, opt.Password)
+	ok, err := client.isHarbor(ctx)
+	if err != nil {
+		logrus.Fatalf("failed to connect to harbor %s: %s", host, err)
+	}
+	if !ok {
+		logrus.Fatalf("destination registry %s is not a harbor registry, set --dest-registry", host)
+	}
+
+	registries := make(map[string]int64)
+	for _, p := range policies {
+		id, ok := registries[p.SrcRegistry.URL]
+		if !ok {
+			if id, err = ensureHarborRegistry(ctx, client, p.SrcRegistry); err != nil {
+				logrus.Fatalf("failed to create harbor registry endpoint %s: %s", p.SrcRegistry.URL, err)
+			}
+			registries[p.SrcRegistry.URL] = id
+		}
+		p.SrcRegistry = &harborRegistry{ID: id}
+		if err = upsertHarborPolicy(ctx, client, p); err != nil {
+			logrus.Errorf("failed to create harbor replication policy %s: %s", p.Name, err)
+			for _, img := range p.images {
+				img.Success = false
+				img.Err = err
+			}
+		}
+	}
+	logrus.Infof("created or updated %d harbor replication policies on %s", len(policies), host)
+	return images
+}
+
+// ensureHarborRegistry returns the id of the registry endpoint with the url,
+// the endpoint is created if it does not exist.
+func ensureHarborRegistry(ctx context.Context, client *harborClient, r *harborRegistry) (int64, error) {
+	for page := 1; ; page++ {
+		var list []harborRegistry
+		if err := client.get(ctx, fmt.Sprintf("/registries?page=%d&page_size=100", page), &list); err != nil {
+			return 0, err
+		}
+		for _, existing := range list {
+			if strings.TrimSuffix(existing.URL, "/") == r.URL {
+				return existing.ID, nil
+			}
+		}
+		if len(list) < 100 {
+			break
+		}
+	}
+	resp, err := client.send(ctx, http.MethodPost, "/registries", r, http.StatusCreated)
+	if err != nil {
+		return 0, err
+	}
+	logrus.Infof("created harbor registry endpoint %s", r.URL)
+	return locationID(resp)
+}
+
+// upsertHarborPolicy updates the policy of the same name or creates it.
+func upsertHarborPolicy(ctx context.Context, client *harborClient, p *harborPolicy) error {
+	var list []harborPolicy
+	if err := client.get(ctx, "/replication/policies?name="+url.QueryEscape(p.Name), &list); err != nil {
+		return err
+	}
+	for _, existing := range list {
+		if existing.Name != p.Name {
+			continue
+		}
+		p.ID = existing.ID
+		_, err := client.send(ctx, http.MethodPut, fmt.Sprintf("/replication/policies/%d", p.ID), p, http.StatusOK)
+		if err == nil {
+			logrus.Debugf("updated harbor replication policy %s", p.Name)
+		}
+		return err
+	}
+	_, err := client.send(ctx, http.MethodPost, "/replication/policies", p, http.StatusCreated)
+	if err == nil {
+		logrus.Debugf("created harbor replication policy %s", p.Name)
+	}
+	return err
+}
+
+// locationID returns the id of the resource created by the request, e.g.
+// Location: /api/v2.0/registries/5
+func locationID(resp *http.Response) (int64, error) {
+	loc := resp.Header.Get("Location")
+	id, err := strconv.ParseInt(path.Base(loc), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid created resource location: %s", loc)
+	}
+	return id, nil
+}
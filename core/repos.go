@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	VisibilityPublic  = "public"  // Created destination repositories are public
+	VisibilityPrivate = "private" // Created destination repositories are private
+)
+
+// repoCreator creates the destination repositories before the first push,
+// the repositories which exist or have been created are cached.
+type repoCreator struct {
+	mu      sync.Mutex
+	created map[string]bool
+	hub     *hubClient
+}
+
+var repoCreation = &repoCreator{created: make(map[string]bool)}
+
+// ensureRepository creates the destination repository of the image with
+// opt.RepoVisibility if it does not exist. Docker Hub repositories and Harbor
+// projects are created, other registries create repositories on push.
+func ensureRepository(ctx context.Context, dest *Image, opt *SyncOption) error {
+	repoCreation.mu.Lock()
+	defer repoCreation.mu.Unlock()
+
+	private := opt.RepoVisibility == VisibilityPrivate
+	var key string
+	var create func() error
+	if dest.Repo == defaultDockerRepo {
+		key = dest.Repo + "/" + dest.Repository()
+		create = func() error { return repoCreation.createHubRepository(ctx, dest, opt, private) }
+	} else {
+		// harbor repositories are created on push, their project must exist
+		ss := strings.SplitN(dest.Repository(), "/", 2)
+		key = dest.Repo + "/" + ss[0]
+		create = func() error { return createHarborProject(ctx, dest.Repo, ss[0], opt, private) }
+	}
+	if repoCreation.created[key] {
+		return nil
+	}
+	if err := create(); err != nil {
+		return err
+	}
+	repoCreation.created[key] = true
+	return nil
+}
+
+func (rc *repoCreator) createHubRepository(ctx context.Context, dest *Image, opt *SyncOption, private bool) error {
+	if dest.User == "" || strings.Contains(dest.Name, "/") {
+		return fmt.Errorf("invalid docker hub repository %s, expected namespace/name", dest.Repository())
+	}
+	if rc.hub == nil {
+		rc.hub = newHubClient(opt.User, opt.Password)
+	}
+	exists, err := rc.hub.repositoryExists(ctx, dest.Repository())
+	if err != nil || exists {
+		return err
+	}
+	if err = rc.hub.createRepository(ctx, dest.User, dest.Name, private); err != nil {
+		return err
+	}
+	logrus.Infof("created %s docker hub repository %s", opt.RepoVisibility, dest.Repository())
+	return nil
+}
+
+// createHarborProject creates the project of the harbor registry, registries
+// which do not serve the harbor api are skipped.
+func createHarborProject(ctx context.Context, host, project string, opt *SyncOption, private bool) error {
+	client := newHarborClient(host, opt.User, opt.Password)
+	ok, err := client.isHarbor(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logrus.Warnf("registry %s is not a harbor registry, its repositories are created on push", host)
+		return nil
+	}
+
+	resp, err := client.send(ctx, http.MethodHead, "/projects?project_name="+url.QueryEscape(project), nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	// conflicts are projects created concurrently
+	type metadata struct {
+		Public string `json:"public"`
+	}
+	_, err = client.send(ctx, http.MethodPost, "/projects", struct {
+		ProjectName string   `json:"project_name"`
+		Metadata    metadata `json:"metadata"`
+	}{project, metadata{fmt.Sprint(!private)}}, http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("created %s harbor project %s/%s", opt.RepoVisibility, host, project)
+	return nil
+}
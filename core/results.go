@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+)
+
+// imageResult is the sync result of an image in the results file.
+type imageResult struct {
+	Image          string        `json:"image"`
+	Success        bool          `json:"success"`
+	CacheHit       bool          `json:"cache_hit,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	ErrorClass     string        `json:"error_class,omitempty"`
+	Digest         digest.Digest `json:"digest,omitempty"`
+	DestDigest     digest.Digest `json:"dest_digest,omitempty"`
+	DestPresent    bool          `json:"dest_present,omitempty"`
+	DigestMismatch bool          `json:"digest_mismatch,omitempty"`
+	Findings       string        `json:"findings,omitempty"`
+	Unverified     bool          `json:"unverified,omitempty"`
+	Overwritten    digest.Digest `json:"overwritten,omitempty"`
+	DestTag        string        `json:"dest_tag,omitempty"`
+	Changes        string        `json:"changes,omitempty"`
+	Recompressed   string        `json:"recompressed,omitempty"`
+	Skipped        bool          `json:"skipped,omitempty"`
+	SkipReason     string        `json:"skip_reason,omitempty"`
+}
+
+// writeResults writes the sync results of the images to the JSON file.
+func writeResults(file string, images Images) error {
+	results := make([]imageResult, 0, len(images))
+	for _, img := range images {
+		r := imageResult{
+			Image:          img.String(),
+			Success:        img.Success,
+			CacheHit:       img.CacheHit,
+			Digest:         img.Digest,
+			DestDigest:     img.DestDigest,
+			DestPresent:    img.DestPresent,
+			DigestMismatch: img.DigestMismatch,
+			Findings:       img.Findings,
+			Unverified:     img.Unverified,
+			Overwritten:    img.Overwritten,
+			DestTag:        img.DestTag,
+			Changes:        img.Changes,
+			Recompressed:   img.Recompressed,
+			Skipped:        img.Skipped,
+			SkipReason:     img.SkipReason,
+		}
+		if img.Err != nil {
+			r.Error, r.ErrorClass = img.Err.Error(), errorClassName(img.Err)
+		}
+		results = append(results, r)
+	}
+	bs, err := jsoniter.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, bs, 0644)
+}
+
+// loadResults loads the images of the results file.
+func loadResults(file string) (Images, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var results []imageResult
+	if err = jsoniter.Unmarshal(bs, &results); err != nil {
+		return nil, err
+	}
+	images := make(Images, 0, len(results))
+	for _, r := range results {
+		img, err := parseImage(r.Image)
+		if err != nil {
+			return nil, err
+		}
+		img.Success, img.CacheHit = r.Success, r.CacheHit
+		img.Digest, img.DestDigest, img.DigestMismatch = r.Digest, r.DestDigest, r.DigestMismatch
+		img.DestPresent = r.DestPresent
+		img.Findings, img.Unverified, img.Overwritten = r.Findings, r.Unverified, r.Overwritten
+		img.DestTag, img.Changes, img.Recompressed = r.DestTag, r.Changes, r.Recompressed
+		img.Skipped, img.SkipReason = r.Skipped, r.SkipReason
+		if r.Error != "" {
+			img.Err = withClass(errorClassByName(r.ErrorClass), errors.New(r.Error))
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// ReportResults renders the report of the results files, e.g. to merge the
+// results of sharded sync jobs into one report.
+func ReportResults(files []string, opt *SyncOption) (Images, error) {
+	var images Images
+	for _, file := range files {
+		imgs, err := loadResults(file)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, imgs...)
+	}
+	opt.Report = true
+	report(images, opt)
+	return images, nil
+}
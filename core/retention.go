@@ -0,0 +1,122 @@
+package core
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/sirupsen/logrus"
+)
+
+// prunedManifests are the images pruned from the manifest store by the retention policy.
+var prunedManifests struct {
+	sync.Mutex
+	images []string
+}
+
+// applyRetention prunes the stored manifests beyond opt.RetainTags most
+// recently synced tags per image, or synced more than opt.RetainDays days ago.
+// The images of this run count as synced now, cache hits included. Batched
+// runs only prune the tags of their batch, the other batches prune theirs.
+func applyRetention(images Images, opt *SyncOption) {
+	if opt.RetainTags <= 0 && opt.RetainDays <= 0 || opt.OnlyDownloadManifests {
+		return
+	}
+	batched := opt.BatchNumber > 0 && opt.BatchTotal > 1
+	if batched && opt.BatchBySize {
+		logrus.Warn("the batches by size are not stable, the retention policy is skipped")
+		return
+	}
+	now := time.Now()
+	for _, img := range images {
+		if img.Success {
+			manifestTimes[img.String()] = now
+		}
+	}
+
+	type storedTag struct {
+		key    string
+		repo   string
+		tag    string
+		synced time.Time
+	}
+	repos := make(map[string][]storedTag)
+	for key, synced := range manifestTimes {
+		i := strings.LastIndex(key, ":")
+		repos[key[:i]] = append(repos[key[:i]], storedTag{key: key, repo: key[:i], tag: key[i+1:], synced: synced})
+	}
+
+	var expired []storedTag
+	for _, tags := range repos {
+		sort.Slice(tags, func(i, j int) bool {
+			if !tags[i].synced.Equal(tags[j].synced) {
+				return tags[i].synced.After(tags[j].synced)
+			}
+			return tags[i].tag > tags[j].tag
+		})
+		for i, t := range tags {
+			tooOld := opt.RetainDays > 0 && now.Sub(t.synced) > time.Duration(opt.RetainDays)*24*time.Hour
+			if batched && nameShard(t.key, opt.BatchTotal) != opt.BatchNumber-1 {
+				continue
+			}
+			if (opt.RetainTags > 0 && i >= opt.RetainTags) || tooOld {
+				expired = append(expired, t)
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for _, t := range expired {
+		logrus.Infof("stored manifest %s expired by the retention policy", t.key)
+	}
+	if !confirm(opt, "prune %d stored manifests expired by the retention policy?", len(expired)) {
+		return
+	}
+
+	var pruned []string
+	for _, t := range expired {
+		if err := pruneManifest(t.repo, t.tag); err != nil {
+			logrus.Errorf("failed to prune manifest %s: %s", t.key, err)
+			continue
+		}
+		pruned = append(pruned, t.key)
+	}
+	if len(pruned) == 0 {
+		return
+	}
+	sort.Strings(pruned)
+	logrus.Infof("pruned stored manifests count: %d", len(pruned))
+	prunedManifests.Lock()
+	prunedManifests.images = append(prunedManifests.images, pruned...)
+	prunedManifests.Unlock()
+}
+
+// pruneManifest removes the files of the stored tag and drops it from the cache.
+func pruneManifest(repo, tag string) error {
+	key := repo + ":" + tag
+	names := []string{tag + ".json", tag + sbomFileSuffix, tag + configFileSuffix}
+	var platforms []string
+	switch m := manifestsMap[key].(type) {
+	case manifest.List:
+		for _, p := range listPlatforms(m) {
+			platforms = append(platforms, p.name)
+		}
+	case *compactManifest:
+		platforms = m.platforms
+	}
+	for _, p := range platforms {
+		names = append(names, path.Join(tag, p+platformFileSuffix), path.Join(tag, p+configFileSuffix))
+	}
+	for _, name := range names {
+		if err := storage.Delete(path.Join(repo, name)); err != nil {
+			return err
+		}
+	}
+	delete(manifestsMap, key)
+	delete(manifestTimes, key)
+	return nil
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sbomFileSuffix is the suffix of SBOM files stored next to the manifest files.
+const sbomFileSuffix = ".sbom.json"
+
+// sbomMediaTypes are the artifact media types of the syft output formats.
+var sbomMediaTypes = map[string]string{
+	"spdx-json":      "application/spdx+json",
+	"cyclonedx-json": "application/vnd.cyclonedx+json",
+	"syft-json":      "application/vnd.syft+json",
+}
+
+// generateSBOM generates the image SBOM with syft, stores it next to the
+// image manifest file as <tag>.sbom.json and pushes it to the destination
+// as an OCI referrer of the synced image. syft is run as a CLI like trivy
+// and cosign, the syft library needs a newer containers/image than the one
+// the copies are built on.
+func generateSBOM(ctx context.Context, image *Image, opt *SyncOption) error {
+	out, err := runCommand(ctx, nil, "syft", "scan", "registry:"+digestReference(image), "--quiet", "--output", opt.SBOMFormat)
+	if err != nil {
+		return fmt.Errorf("failed to generate image [%s] sbom: %s", image.String(), err)
+	}
+	if err = storage.Put(manifestFileName(image, sbomFileSuffix), out); err != nil {
+		return fmt.Errorf("failed to storage image [%s] sbom: %s", image.String(), err)
+	}
+	logrus.Debugf("generated image [%s] sbom", image.String())
+	if opt.ContainerdNamespace != "" {
+		return nil
+	}
+	mediaType, ok := sbomMediaTypes[opt.SBOMFormat]
+	if !ok {
+		mediaType = "application/json"
+	}
+	if err = pushReferrer(ctx, image, mediaType, out, opt); err != nil {
+		return fmt.Errorf("failed to push image [%s] sbom: %s", image.String(), err)
+	}
+	return nil
+}
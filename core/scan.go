@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// trivy severities from low to high
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID string
+			Severity        string
+		}
+	}
+}
+
+// scanImage scans the source image with trivy, it returns the vulnerabilities
+// count by severity of the severities at or above opt.ScanSeverity.
+func scanImage(ctx context.Context, image *Image, opt *SyncOption) (map[string]int, error) {
+	threshold := severityIndex(opt.ScanSeverity)
+	if threshold < 0 {
+		return nil, fmt.Errorf("unknown scan severity: %s", opt.ScanSeverity)
+	}
+	out, err := runCommand(ctx, nil, "trivy", "image",
+		"--quiet",
+		"--format", "json",
+		"--severity", strings.Join(severities[threshold:], ","),
+		digestReference(image))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan image [%s]: %s", image.String(), err)
+	}
+	var report trivyReport
+	if err = jsoniter.Unmarshal(out, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse image [%s] scan result: %s", image.String(), err)
+	}
+
+	findings := make(map[string]int)
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			if severityIndex(v.Severity) >= threshold {
+				findings[strings.ToUpper(v.Severity)]++
+			}
+		}
+	}
+	return findings, nil
+}
+
+func severityIndex(severity string) int {
+	for i, s := range severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatFindings formats the findings from high to low severity, e.g. "CRITICAL: 1, HIGH: 3".
+func formatFindings(findings map[string]int) string {
+	var ss []string
+	for s := range findings {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool { return severityIndex(ss[i]) > severityIndex(ss[j]) })
+	for i, s := range ss {
+		ss[i] = fmt.Sprintf("%s: %d", s, findings[s])
+	}
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CosignKeyless is the CosignKey value which signs images keyless via OIDC.
+const CosignKeyless = "keyless"
+
+// signImage signs the destination image digest after the image has been pushed.
+func signImage(ctx context.Context, image *Image, opt *SyncOption) error {
+	if opt.CosignKey == "" && opt.NotationKey == "" {
+		return nil
+	}
+	ref, err := destinationDigestRef(ctx, image, opt)
+	if err != nil {
+		return err
+	}
+	if opt.CosignKey != "" {
+		if err = cosignSign(ctx, destinationImage(image, opt).Repo, ref, opt); err != nil {
+			return err
+		}
+	}
+	if opt.NotationKey != "" {
+		if err = notationSign(ctx, ref, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destinationDigestRef returns the destination image reference by digest,
+// signatures must refer to a digest instead of a mutable tag.
+func destinationDigestRef(ctx context.Context, image *Image, opt *SyncOption) (string, error) {
+	destImage := destinationImage(image, opt)
+	dgst := image.DestDigest
+	if dgst == "" {
+		var err error
+		dgst, err = getManifestDigest(ctx, destImage.String(), destinationSystemContext(opt))
+		if err != nil {
+			return "", fmt.Errorf("failed to get image [%s] digest: %s", destImage.String(), err)
+		}
+		image.DestDigest = dgst
+	}
+	return fmt.Sprintf("%s/%s@%s", destImage.Repo, destImage.Repository(), dgst), nil
+}
+
+// cosignSign signs the image with cosign, the destination credentials are
+// passed in a temporary docker config.
+func cosignSign(ctx context.Context, registry, ref string, opt *SyncOption) error {
+	configDir, err := tempDockerConfig(registry, opt)
+	if err != nil {
+		return fmt.Errorf("failed to write cosign docker config: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(configDir) }()
+
+	args := []string{"sign", "--yes"}
+	if opt.CosignKey != CosignKeyless {
+		args = append(args, "--key", opt.CosignKey)
+	}
+	args = append(args, ref)
+	if _, err = runCommand(ctx, []string{"DOCKER_CONFIG=" + configDir}, "cosign", args...); err != nil {
+		return fmt.Errorf("failed to sign image [%s]: %s", ref, err)
+	}
+	logrus.Infof("signed image [%s] with cosign", ref)
+	return nil
+}
+
+// notationSign signs the image with a key configured in notation (notation key list).
+func notationSign(ctx context.Context, ref string, opt *SyncOption) error {
+	var env []string
+	if opt.User != "" {
+		env = []string{"NOTATION_USERNAME=" + opt.User, "NOTATION_PASSWORD=" + opt.Password}
+	}
+	args := []string{"sign", "--key", opt.NotationKey, ref}
+	if _, err := runCommand(ctx, env, "notation", args...); err != nil {
+		return fmt.Errorf("failed to sign image [%s]: %s", ref, err)
+	}
+	logrus.Infof("signed image [%s] with notation", ref)
+	return nil
+}
+
+// verifySourceSignature verifies the cosign signature of the source image digest,
+// against the public key or the keyless certificate identity.
+func verifySourceSignature(ctx context.Context, image *Image, opt *SyncOption) error {
+	ref := digestReference(image)
+	args := []string{"verify", "--output", "json"}
+	if opt.VerifyKey != "" {
+		args = append(args, "--key", opt.VerifyKey)
+	} else {
+		args = append(args,
+			"--certificate-identity-regexp", opt.VerifyIdentity,
+			"--certificate-oidc-issuer-regexp", opt.VerifyIssuer)
+	}
+	args = append(args, ref)
+	if _, err := runCommand(ctx, nil, "cosign", args...); err != nil {
+		return fmt.Errorf("failed to verify image [%s] signature: %s", ref, err)
+	}
+	logrus.Debugf("image [%s] signature verified", ref)
+	return nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// skopeoRegistry is a registry of the skopeo sync YAML source, e.g.
+//
+//	gcr.io:
+//	  images:
+//	    google-containers/pause: ["3.1", "3.2"]
+type skopeoRegistry struct {
+	Images           map[string][]string `yaml:"images,omitempty"`
+	ImagesByTagRegex map[string]string   `yaml:"images-by-tag-regex,omitempty"`
+	ImagesBySemver   map[string]string   `yaml:"images-by-semver,omitempty"`
+	Credentials      *struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"credentials,omitempty"`
+	TLSVerify *bool  `yaml:"tls-verify,omitempty"`
+	CertDir   string `yaml:"cert-dir,omitempty"`
+}
+
+// loadSkopeoConfig returns the images of the skopeo sync YAML source file.
+// Images without tags sync all repository tags, images-by-tag-regex sync the
+// tags matching the regexp. Digest references, images-by-semver, credentials
+// and tls settings are not supported and are ignored with a warning.
+func loadSkopeoConfig(path string) ([]staticImage, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]*skopeoRegistry
+	if err = yaml.Unmarshal(bs, &config); err != nil {
+		return nil, fmt.Errorf("invalid skopeo sync file %s: %s", path, err)
+	}
+
+	var list []staticImage
+	for registry, r := range config {
+		if r == nil {
+			continue
+		}
+		if r.Credentials != nil || r.TLSVerify != nil || r.CertDir != "" {
+			logrus.Warnf("credentials and tls settings of registry %s are ignored, images are pulled anonymously", registry)
+		}
+		for repo := range r.ImagesBySemver {
+			logrus.Warnf("images-by-semver of %s/%s is not supported, the image is ignored", registry, repo)
+		}
+		for repo, refs := range r.Images {
+			si := staticImage{Name: registry + "/" + repo}
+			for _, ref := range refs {
+				if strings.Contains(ref, ":") {
+					logrus.Warnf("digest reference %s@%s is not supported, the reference is ignored", si.Name, ref)
+					continue
+				}
+				si.Tags = append(si.Tags, ref)
+			}
+			if len(refs) > 0 && len(si.Tags) == 0 {
+				continue
+			}
+			list = append(list, si)
+		}
+		for repo, re := range r.ImagesByTagRegex {
+			si := staticImage{Name: registry + "/" + repo, Include: re}
+			if si.include, err = regexp.Compile(re); err != nil {
+				return nil, fmt.Errorf("invalid tag regex of image %s: %s", si.Name, err)
+			}
+			list = append(list, si)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// skopeoConfig returns the skopeo sync YAML source of the images, the
+// latest tags are dropped by the latest policy as they would not be synced.
+func skopeoConfig(images Images, opt *SyncOption) map[string]*skopeoRegistry {
+	config := make(map[string]*skopeoRegistry)
+	for _, img := range images {
+		if img.Tag == latestTag && (opt.LatestPolicy == LatestSkip || opt.LatestPolicy == LatestSemver) {
+			img.Skip("latest tag policy: " + opt.LatestPolicy)
+			continue
+		}
+		r, ok := config[img.Repo]
+		if !ok {
+			r = &skopeoRegistry{Images: make(map[string][]string)}
+			config[img.Repo] = r
+		}
+		r.Images[img.Repository()] = append(r.Images[img.Repository()], img.Tag)
+		img.Success = true
+	}
+	return config
+}
+
+// exportSkopeo writes the images as skopeo sync YAML to opt.ExportFile or
+// stdout. skopeo sync can not rename images, the synced repositories keep
+// their source path under the destination.
+func exportSkopeo(images Images, opt *SyncOption) Images {
+	bs, err := yaml.Marshal(skopeoConfig(images, opt))
+	if err != nil {
+		logrus.Fatalf("failed to encode skopeo sync config: %s", err)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# skopeo sync --src yaml --dest docker <file> %s/%s\n", destinationRegistry(opt), destinationNamespace(opt))
+	buf.WriteString("# skopeo keeps the source repository paths, the imgsync destination names are not applied\n")
+	buf.Write(bs)
+
+	if opt.ExportFile == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = ioutil.WriteFile(opt.ExportFile, buf.Bytes(), 0644)
+	}
+	if err != nil {
+		logrus.Fatalf("failed to write skopeo sync config: %s", err)
+	}
+	return images
+}
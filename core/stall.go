@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// minStallTimeout is the lowest stall timeout, the progress of layer copies
+// is only reported every defaultProgressInterval.
+const minStallTimeout = 6 * defaultProgressInterval
+
+// touch records a progress event of the copy.
+func (up *uploadProgress) touch() {
+	atomic.StoreInt64(&up.last, time.Now().UnixNano())
+}
+
+// sinceProgress returns the time since the last progress event.
+func (up *uploadProgress) sinceProgress() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&up.last)))
+}
+
+// watchStall returns the context of a copy which is cancelled when the copy
+// has made no progress for the timeout, slow copies which are still moving
+// are not cancelled. The returned stop func ends the watch and reports
+// whether the copy has been cancelled for stalling.
+func (up *uploadProgress) watchStall(ctx context.Context, timeout time.Duration) (context.Context, func() bool) {
+	if timeout <= 0 {
+		return ctx, func() bool { return false }
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	up.touch()
+
+	var stalled int32
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(timeout / 6)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if up.sinceProgress() >= timeout {
+					atomic.StoreInt32(&stalled, 1)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() bool {
+		close(done)
+		cancel()
+		return atomic.LoadInt32(&stalled) == 1
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestStore stores the manifest files, file names are slash separated
+// paths relative to the store root, e.g. gcr.io/google-containers/pause/3.2.json
+type manifestStore interface {
+	// Walk calls fn with the name, content and modification time of every stored file.
+	Walk(fn func(name string, data []byte, modTime time.Time) error) error
+	Put(name string, data []byte) error
+	// Delete removes the file, missing files are ignored.
+	Delete(name string) error
+}
+
+// errStoreNotFound is returned by storeReader.Get for missing files.
+var errStoreNotFound = errors.New("file not found")
+
+// storeReader is implemented by manifest stores which read single files.
+type storeReader interface {
+	Get(name string) ([]byte, error)
+}
+
+// storage is the manifest store of ManifestDir, it is opened by LoadManifests.
+var storage manifestStore = localStore("manifests")
+
+// openManifestStore opens the local directory or object storage URL
+// (s3://, gs:// and oss://) of the manifest store.
+func openManifestStore(dir string) (manifestStore, error) {
+	var base manifestStore = localStore(dir)
+	if isObjectStoreURL(dir) {
+		bucket, err := newObjectStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		base = bucket
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s, err := newCompressedStore(base, ManifestCompression)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ManifestContentAddressed && ManifestArchive:
+		return nil, fmt.Errorf("content addressed manifests can not be archived")
+	case ManifestContentAddressed:
+		return newCASStore(s), nil
+	case ManifestArchive:
+		return newArchiveStore(s), nil
+	}
+	return s, nil
+}
+
+// manifestFileName returns the store file name of the image tag file with the suffix.
+func manifestFileName(image *Image, suffix string) string {
+	return path.Join(image.Repo, image.User, image.Name, image.Tag+suffix)
+}
+
+// localStore stores the manifest files in a local directory.
+type localStore string
+
+func (ls localStore) Walk(fn func(name string, data []byte, modTime time.Time) error) error {
+	root := string(ls)
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		bs, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(p, root)), "/")
+		return fn(name, bs, info.ModTime())
+	})
+}
+
+func (ls localStore) Get(name string) ([]byte, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(string(ls), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil, errStoreNotFound
+	}
+	return bs, err
+}
+
+func (ls localStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(string(ls), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (ls localStore) Put(name string, data []byte) error {
+	p := filepath.Join(string(ls), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
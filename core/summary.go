@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// invalidRefs are the image references found by the helm and cluster sources
+// which can not be parsed, they are reported as failures.
+var invalidRefs struct {
+	sync.Mutex
+	refs []string
+}
+
+// recordInvalidRef records an image reference which can not be parsed.
+func recordInvalidRef(ref string, err error) {
+	invalidRefs.Lock()
+	defer invalidRefs.Unlock()
+	invalidRefs.refs = append(invalidRefs.refs, fmt.Sprintf("%s: %s", ref, err))
+}
+
+// invalidRefsCount returns the count of the invalid image references.
+func invalidRefsCount() int {
+	invalidRefs.Lock()
+	defer invalidRefs.Unlock()
+	return len(invalidRefs.refs)
+}
+
+// invalidRefsSummary returns the summary of the invalid image references.
+func invalidRefsSummary() string {
+	invalidRefs.Lock()
+	defer invalidRefs.Unlock()
+	if len(invalidRefs.refs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("========================================\n")
+	b.WriteString(fmt.Sprintf("Invalid image references: %d\n", len(invalidRefs.refs)))
+	for _, ref := range invalidRefs.refs {
+		b.WriteString("  " + ref + "\n")
+	}
+	return b.String()
+}
+
+// errorSummary returns the errors summary of the failed images grouped by
+// error class, e.g.
+//
+//	Sync errors: 37 rate-limited, 4 not found, 2 timeout
+//	rate-limited:
+//	  gcr.io/google-containers/pause:3.2
+//	...
+//
+// It is empty if no image failed with an error.
+func errorSummary(images Images) string {
+	groups := make(map[string][]string)
+	for _, img := range images {
+		if !img.Failed() || img.Err == nil {
+			continue
+		}
+		class := errorClassName(img.Err)
+		groups[class] = append(groups[class], img.String())
+	}
+	if len(groups) == 0 {
+		return ""
+	}
+
+	classes := make([]string, 0, len(groups))
+	for class := range groups {
+		classes = append(classes, class)
+	}
+	// the largest groups first, other errors last
+	sort.Slice(classes, func(i, j int) bool {
+		ci, cj := classes[i], classes[j]
+		if (ci == errorOtherClass) != (cj == errorOtherClass) {
+			return cj == errorOtherClass
+		}
+		if len(groups[ci]) != len(groups[cj]) {
+			return len(groups[ci]) > len(groups[cj])
+		}
+		return ci < cj
+	})
+
+	counts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		counts = append(counts, fmt.Sprintf("%d %s", len(groups[class]), class))
+	}
+	var b strings.Builder
+	b.WriteString("========================================\n")
+	b.WriteString("Sync errors: " + strings.Join(counts, ", ") + "\n")
+	for _, class := range classes {
+		sort.Strings(groups[class])
+		b.WriteString(class + ":\n")
+		for _, name := range groups[class] {
+			b.WriteString("  " + name + "\n")
+		}
+	}
+	return b.String()
+}
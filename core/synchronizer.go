@@ -4,20 +4,22 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
-	"os"
-	"path/filepath"
+	"os/exec"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/panjf2000/ants/v2"
 
 	"github.com/containers/image/v5/manifest"
-
-	jsoniter "github.com/json-iterator/go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker"
@@ -29,107 +31,766 @@ import (
 
 type Synchronizer interface {
 	Images(ctx context.Context) Images
-	Sync(ctx context.Context, opt *SyncOption)
+	Sync(ctx context.Context, opt *SyncOption) error
+}
+
+// ImageStreamer is implemented by synchronizers which can send the images
+// while they are still listing them.
+type ImageStreamer interface {
+	StreamImages(ctx context.Context, out chan<- *Image)
 }
 
 type SyncOption struct {
 	User                  string        // Docker Hub User
 	Password              string        // Docker Hub User Password
+	DestRegistry          string        // Destination registry host, docker hub by default
+	DestNamespace         string        // Destination namespace, the user by default
 	Timeout               time.Duration // Sync single image timeout
+	MinThroughput         string        // Minimum copy throughput per second(e.g. 1Mi) of the adaptive image timeouts, empty uses Timeout
 	Limit                 int           // Images sync process limit
-	BatchSize             int           // Batch size for batch synchronization
+	BatchSize             int           // Deprecated, the batches count is set by BatchTotal
 	BatchNumber           int           // Sync specified batch
+	BatchTotal            int           // Total batches count of BatchNumber and NextBatch
+	BatchBySize           bool          // Spread images over batches by estimated transfer size
+	Priority              []string      // Image names or repositories (glob patterns) synced first
+	Order                 string        // Order of the remaining images (newest)
+	NextBatch             bool          // Sync the first batch not completed according to the checkpoint file
+	CheckpointFile        string        // Checkpoint file of the completed batches
 	OnlyDownloadManifests bool          // Only download Manifests file
 	Report                bool          // Report sync result
 	ReportLevel           int           // Report level
 	ReportFile            string        // Report file
+	ParallelLayers        int           // Parallel layer copies per image (0 means transport default)
+	ParallelPlatforms     int           // Parallel platform manifest copies of manifest lists (0 or 1 copies them sequentially)
+	CopyEngine            string        // Image copy engine (containers-image/crane)
+	Recompress            string        // Recompress zstd layers to the compression (gzip)
+	ContainerdNamespace   string        // Import the images into the local containerd namespace instead of pushing them
+	ContainerdAddress     string        // containerd socket address
+	RateLimitPause        time.Duration // Pause all workers when the registry rate limit is reached
+	RateLimitStorm        int           // Rate limited requests within 10s which pause all workers
+	FailureRate           float64       // Allowed failed images rate, exceeding it makes the sync fail
+	FailFast              bool          // Stop the sync queue on the first failed image
+	MaxFailures           int           // Stop the sync queue when the failed images count reached
+	MaxFailureRate        float64       // Stop the sync queue when the failed images rate reached
+	Verify                bool          // Verify the destination manifest digest after sync
+	VerifyRetry           bool          // Retry the sync when the destination digest mismatch
+	Schema1               string        // Docker schema1 manifests handling (copy/convert/convert-oci/skip)
+	PreserveDigests       bool          // Copy manifests bit-for-bit, fail the image when the digest would change
+	SkipWindows           bool          // Drop windows platforms from manifest lists
+	Platforms             []string      // Only copy the platforms (os/arch[/variant]) of manifest lists
+	Destination           string        // Destination reference of a single image copy, taking precedence over the name mapping
+	CopyReferrers         bool          // Copy OCI referrers (SBOMs, attestations, signatures) of synced images
+	CopySignatures        bool          // Copy cosign signature and attestation tags of synced images
+	CosignKey             string        // Sign pushed images with the cosign key ("keyless" signs via OIDC)
+	NotationKey           string        // Sign pushed images with the notation key
+	ScanSeverity          string        // Scan source images with trivy, skip images with findings at or above the severity
+	ScanFlagOnly          bool          // Only report scan findings instead of skipping images
+	PolicyFile            string        // containers/image signature policy file (policy.json)
+	SBOMFormat            string        // Generate SBOMs of synced images with syft in the format (e.g. spdx-json)
+	VerifyKey             string        // Verify source image signatures with the cosign public key
+	VerifyIdentity        string        // Verify keyless source image signatures with the certificate identity regexp
+	VerifyIssuer          string        // Verify keyless source image signatures with the OIDC issuer regexp
+	AllowlistFile         string        // Only sync images whose digest is listed in the file
+	Force                 bool          // Overwrite destination tags which have a different digest
+	Yes                   bool          // Confirm overwriting destination tags and pruning manifests without prompting
+	AuditLog              string        // Append pushed images to the hash chained audit log file
+	AuditKey              string        // Sign audit log entries with the ed25519 private key file
+	NameTemplate          string        // Go template of the destination repository name, e.g. {{.User}}_{{.Name}}
+	NameSeparator         string        // Separator of the flattened destination name components
+	NameReplaceDots       string        // Replace dots of flattened destination names
+	NameMaxLength         int           // Truncate destination names longer than the length
+	NameHierarchy         string        // Flatten or preserve image paths in destination names (auto/flatten/preserve)
+	TagRewrites           []string      // Destination tag rewrite rules (REGEXP=REPLACEMENT)
+	Disambiguate          bool          // Suffix colliding destination names with a source hash instead of aborting
+	MappingFile           string        // Write the source to destination mapping of synced images to the file
+	LatestPolicy          string        // Handling of latest tags (keep/skip/semver)
+	LockFile              string        // Only sync the images pinned by the lock file from their pinned digests
+	WriteLockFile         string        // Write the source digests of synced images to the lock file
+	OverridesFile         string        // YAML file of per image destination overrides
+	Dedup                 bool          // Copy tags of the same digest once and tag the others on the destination
+	QueueFile             string        // Work queue file, a restarted sync continues its pending images without listing
+	Pipeline              bool          // Copy the images while the tags are still being listed
+	MaxDuration           time.Duration // Run time budget, no new images are started when it is nearly exhausted
+	FailedFile            string        // File of the failed images of the last run
+	RetryFailed           bool          // Only sync the failed images of the last run instead of listing the images
+	DeadLetterFile        string        // File of the images failed after their retries, kept across runs until they are synced
+	ImagesFrom            string        // Only sync the images of the dead-letter or failed images file instead of listing the images
+	HistoryFile           string        // Failure history file, previously failed images are synced last
+	QuarantineAfter       int           // Consecutive failures after which images are only retried every QuarantineRetry
+	QuarantineRetry       time.Duration // Retry interval of quarantined images
+	PlatformManifests     bool          // Store the platform manifests of manifest lists in the tag directory
+	StoreConfig           bool          // Store the image config blobs next to the manifests
+	CreateRepos           bool          // Create the destination repositories before pushing
+	RepoVisibility        string        // Visibility of the created destination repositories (public/private)
+	Webhooks              []string      // Webhook urls notified of every synced image
+	WebhookSecret         string        // HMAC-SHA256 key of the webhook request signatures
+	HubRateCheck          bool          // Check the docker hub pull rate limit, images exceeding the quota are left to the next run
+	HubRateInterval       time.Duration // Interval of the docker hub pull rate limit queries during the run
+	HubRateReserve        int           // Docker hub pulls kept in reserve of the quota
+	HubDescription        bool          // Set the docker hub descriptions of the synced destination repositories
+	RetainTags            int           // Keep the most recently synced tags count per image in the manifest store
+	RetainDays            int           // Prune stored manifests last synced more than the days ago
+	ResultsFile           string        // Write the sync results of the images to the JSON file
+	Mode                  string        // Run mode (list/diff/verify), the images are inspected instead of synced
+	ProgressInterval      time.Duration // Interval of the run progress logs, 0 disables them
+	ReplicationCron       string        // Cron schedule of the harbor replication policies, manual triggers by default
+	ReplicationRulesFile  string        // Write the harbor replication policies to the JSON file instead of creating them
+	ExportFile            string        // File of the exported skopeo sync YAML, stdout by default
+	TagsCacheFile         string        // Tags list cache file, unchanged repositories are listed with conditional requests
+	IncrementalTags       bool          // Only list the tags after the last cached tag of the repositories
+	TagsRefresh           time.Duration // Interval of the full tags listings of incremental listings
+	BlobCacheDir          string        // Directory of the blob info cache reused between runs
+	BlobCacheContents     bool          // Also cache the blob contents downloaded from the sources in the blob cache directory
+	StallTimeout          time.Duration // Cancel and retry the copies which have made no progress for the duration, 0 disables it
+	PanicDir              string        // Directory of the diagnostic files of the images panicked while syncing, empty disables them
+	Output                string        // Output format of the list, diff and verify modes (text/table/json/yaml)
+	DryRun                bool          // Diff the images and estimate the transfer size and run time instead of syncing
+	TransferRate          float64       // Estimated transfer rate per worker in MB/s of dry runs
+
+	QueryLimit        int      // Query Gcr images limit
+	NameSpaces        []string // Gcr image namespaces
+	Recursive         bool     // Walk nested gcr sub namespaces
+	Kubeadm           bool     // Sync kubeadm images (change gcr.io to k8s.gcr.io, and remove namespace)
+	KubernetesVersion string   // Only sync the kubeadm images of the kubernetes versions or version ranges
+
+	FlannelReleases string // Flannel releases to sync: latest, the latest N releases or all
+	FlannelArchTags bool   // Also sync architecture suffixed tags of flannel releases
+
+	ImagesFile string   // YAML file of the static image list or the skopeo sync source
+	PluginArgs []string // Arguments of the exec plugin
 
-	QueryLimit int    // Query Gcr images limit
-	NameSpace  string // Gcr image namespace
-	Kubeadm    bool   // Sync kubeadm images (change gcr.io to k8s.gcr.io, and remove namespace)
+	HelmCharts []string // Helm chart references, an optional chart version follows "@"
+	HelmValues []string // Helm values files of the charts
+	HelmSet    []string // Helm values (key=value) of the charts
+
+	Kubeconfig     string   // Kubeconfig file of the scanned cluster
+	KubeContext    string   // Kubeconfig context of the scanned cluster
+	KubeNamespaces []string // Scanned cluster namespaces, all namespaces if empty
 }
 
 type TagsOption struct {
 	Timeout time.Duration
 }
 
+var (
+	synchronizersMu sync.RWMutex
+	synchronizers   = make(map[string]Synchronizer)
+)
+
+func init() {
+	Register("gcr", &gcr)
+	Register("flannel", &fl)
+	Register("kNative", &kNative)
+	Register("static", &static)
+	Register("skopeo", &skopeo)
+	Register("helm", &helm)
+	Register("cluster", &cluster)
+}
+
+// Register makes a synchronizer available by the name, it panics if the name
+// is already registered or the synchronizer is nil.
+func Register(name string, s Synchronizer) {
+	synchronizersMu.Lock()
+	defer synchronizersMu.Unlock()
+	if s == nil {
+		panic("imgsync: register synchronizer " + name + " is nil")
+	}
+	if _, dup := synchronizers[name]; dup {
+		panic("imgsync: register synchronizer " + name + " twice")
+	}
+	synchronizers[name] = s
+}
+
+// List returns the sorted names of the registered synchronizers.
+func List() []string {
+	synchronizersMu.RLock()
+	defer synchronizersMu.RUnlock()
+	names := make([]string, 0, len(synchronizers))
+	for name := range synchronizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSynchronizer returns the registered synchronizer of the name,
+// "exec:/path/to/plugin" names return an exec plugin synchronizer.
 func NewSynchronizer(name string) Synchronizer {
-	switch name {
-	case "gcr":
-		return &gcr
-	case "flannel":
-		return &fl
-	case "kNative":
-		return &kNative
-	default:
-		logrus.Fatalf("failed to create synchronizer %s: unknown synchronizer", name)
-		// just for compiling
-		return nil
+	if strings.HasPrefix(name, execSynchronizerPrefix) {
+		return newExecPlugin(strings.TrimPrefix(name, execSynchronizerPrefix))
 	}
+	synchronizersMu.RLock()
+	s, ok := synchronizers[name]
+	synchronizersMu.RUnlock()
+	if !ok {
+		logrus.Fatalf("failed to create synchronizer %s: unknown synchronizer, available: %s", name, strings.Join(List(), ", "))
+	}
+	return s
+}
+
+// collectImages returns all images the streamer sends.
+func collectImages(ctx context.Context, s ImageStreamer) Images {
+	out := make(chan *Image, DefaultLimit)
+	go func() {
+		defer close(out)
+		s.StreamImages(ctx, out)
+	}()
+	var images Images
+	for img := range out {
+		images = append(images, img)
+	}
+	return images
+}
+
+// syncListed lists and syncs the images of the synchronizer, with opt.Pipeline
+// the images of streamers are synced while they are listed.
+func syncListed(ctx context.Context, s Synchronizer, opt *SyncOption) Images {
+	useTagCache(opt)
+	if opt.ImagesFrom != "" {
+		if opt.RetryFailed || opt.QueueFile != "" {
+			logrus.Warnf("the images of %s are synced, the failed images and the work queue are ignored", opt.ImagesFrom)
+		}
+		return SyncImages(ctx, imagesFrom(opt.ImagesFrom), opt)
+	}
+	if opt.RetryFailed {
+		if opt.QueueFile != "" {
+			logrus.Warn("the failed images of the last run are retried, the work queue is ignored")
+		}
+		return SyncImages(ctx, failedImages(opt), opt)
+	}
+	if opt.Pipeline && opt.Mode == ModeSync {
+		streamer, ok := s.(ImageStreamer)
+		switch {
+		case !ok:
+			logrus.Warn("the synchronizer can not list images while syncing, pipeline is ignored")
+		case opt.QueueFile != "":
+			logrus.Warn("the work queue needs the whole image list, pipeline is ignored")
+		default:
+			in := make(chan *Image, opt.Limit)
+			go func() {
+				defer close(in)
+				streamer.StreamImages(ctx, in)
+			}()
+			return SyncImageStream(ctx, in, opt)
+		}
+	}
+	images := queuedImages(opt, func() Images { return s.Images(ctx) })
+	logrus.Infof("sync images count: %d", len(images))
+	return SyncImages(ctx, images, opt)
 }
 
 func SyncImages(ctx context.Context, images Images, opt *SyncOption) Images {
+	if opt.NextBatch {
+		if opt.CheckpointFile == "" {
+			opt.CheckpointFile = DefaultCheckpointFile
+		}
+		nextBatch(opt)
+	}
 	imgs := batchProcess(images, opt)
+	sort.Sort(imgs)
+	prioritize(imgs, opt)
+	history := failureHistory(opt)
+	if history != nil {
+		deprioritizeFailures(imgs, history)
+	}
 	logrus.Infof("starting sync images, image total: %d", len(imgs))
 
-	processWg := new(sync.WaitGroup)
-	processWg.Add(len(imgs))
+	initSyncOption(opt)
+	if opt.Mode == ModeList {
+		return listImages(imgs, opt)
+	}
+	if opt.Mode == ModeReplicate {
+		return replicateImages(ctx, imgs, opt)
+	}
+	if opt.Mode == ModeSkopeo {
+		return exportSkopeo(imgs, opt)
+	}
+	// collisions are checked across all batches
+	if err := resolveCollisions(images, opt); err != nil {
+		logrus.Fatal(err)
+	}
+	if opt.Mode != ModeSync {
+		return inspectImages(ctx, imgs, opt)
+	}
 
+	in := make(chan *Image)
+	go func() {
+		defer close(in)
+		for _, img := range imgs {
+			in <- img
+		}
+	}()
+	imgs, completed := syncImages(ctx, in, len(imgs), opt, history, nil)
+
+	// interrupted batches are synced again by the next run
+	if opt.NextBatch && opt.BatchTotal > 1 && completed {
+		completeBatch(opt)
+	}
+	if opt.LatestPolicy == LatestSemver {
+		aliasLatest(ctx, images, opt)
+	}
+	if opt.HubDescription && !opt.OnlyDownloadManifests {
+		describeRepositories(ctx, imgs, opt)
+	}
+	writeSyncFiles(imgs, opt)
+	return imgs
+}
+
+// SyncImageStream syncs the images received from in while they are still
+// being listed. Priority order, size batches and checkpoints need the whole
+// image list and are ignored, destination name collisions are detected as
+// the images arrive.
+func SyncImageStream(ctx context.Context, in <-chan *Image, opt *SyncOption) Images {
+	if len(opt.Priority) > 0 || opt.Order != OrderNone || opt.BatchBySize || opt.NextBatch {
+		logrus.Warn("priority, order, batch by size and next batch are ignored when syncing images while listing")
+	}
+	initSyncOption(opt)
+	if opt.BatchNumber > 0 && opt.BatchTotal > 1 {
+		in = shardStream(in, opt)
+	}
+	logrus.Info("starting sync images while listing")
+	imgs, _ := syncImages(ctx, in, -1, opt, failureHistory(opt), newCollisionGuard())
+	if opt.LatestPolicy == LatestSemver {
+		aliasLatest(ctx, imgs, opt)
+	}
+	if opt.HubDescription && !opt.OnlyDownloadManifests {
+		describeRepositories(ctx, imgs, opt)
+	}
+	writeSyncFiles(imgs, opt)
+	return imgs
+}
+
+// shardStream filters the images of the batch opt.BatchNumber from in.
+func shardStream(in <-chan *Image, opt *SyncOption) <-chan *Image {
+	out := make(chan *Image)
+	go func() {
+		defer close(out)
+		for img := range in {
+			if imageShard(img, opt.BatchTotal) == opt.BatchNumber-1 {
+				out <- img
+			}
+		}
+	}()
+	return out
+}
+
+// initSyncOption sets the option defaults and validates the option.
+func initSyncOption(opt *SyncOption) {
 	if opt.Limit == 0 {
 		opt.Limit = DefaultLimit
 	}
+	memoryLimitedWorkers(opt)
+	RegisterSecret(opt.Password)
+	if errs := checkSyncOption(opt); len(errs) > 0 {
+		logrus.Fatal(errs[0])
+	}
+	if opt.DryRun {
+		opt.Mode = ModeDiff
+	}
+	limiter.configure(opt)
+}
 
-	pool, err := ants.NewPool(opt.Limit, ants.WithPreAlloc(true), ants.WithPanicHandler(func(i interface{}) {
-		logrus.Error(i)
-	}))
+// checkSyncOption returns the errors of the invalid options.
+func checkSyncOption(opt *SyncOption) []error {
+	var errs []error
+	switch opt.Mode {
+	case ModeSync, ModeList, ModeDiff, ModeVerify, ModeReplicate, ModeSkopeo:
+	default:
+		errs = append(errs, fmt.Errorf("invalid mode: %s", opt.Mode))
+	}
+	switch opt.Output {
+	case "", OutputText, OutputTable, OutputJSON, OutputYAML:
+	default:
+		errs = append(errs, fmt.Errorf("invalid output format: %s", opt.Output))
+	}
+	if opt.DryRun && opt.Mode != ModeSync && opt.Mode != ModeDiff {
+		errs = append(errs, fmt.Errorf("dry run can not be used with the %s mode", opt.Mode))
+	}
+	if opt.Order != OrderNone && opt.Order != OrderNewest {
+		errs = append(errs, fmt.Errorf("invalid order: %s", opt.Order))
+	}
+	switch opt.LatestPolicy {
+	case "", LatestKeep, LatestSkip, LatestSemver:
+	default:
+		errs = append(errs, fmt.Errorf("invalid latest policy: %s", opt.LatestPolicy))
+	}
+	switch opt.NameHierarchy {
+	case "", HierarchyAuto, HierarchyFlatten, HierarchyPreserve:
+	default:
+		errs = append(errs, fmt.Errorf("invalid name hierarchy: %s", opt.NameHierarchy))
+	}
+	switch opt.RepoVisibility {
+	case "", VisibilityPublic, VisibilityPrivate:
+	default:
+		errs = append(errs, fmt.Errorf("invalid repository visibility: %s", opt.RepoVisibility))
+	}
+	switch opt.Recompress {
+	case "":
+	case RecompressGzip:
+		if opt.PreserveDigests {
+			errs = append(errs, fmt.Errorf("zstd layers recompression can not be used with --preserve-digests"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid layer recompression: %s", opt.Recompress))
+	}
+	switch opt.CopyEngine {
+	case "", EngineContainersImage:
+	case EngineCrane:
+		errs = append(errs, checkCraneOption(opt)...)
+	default:
+		errs = append(errs, fmt.Errorf("invalid copy engine: %s", opt.CopyEngine))
+	}
+	if opt.StallTimeout > 0 && opt.StallTimeout < minStallTimeout {
+		errs = append(errs, fmt.Errorf("stall timeout must be at least %s", minStallTimeout))
+	}
+	if err := checkBlobCacheDir(opt); err != nil {
+		errs = append(errs, err)
+	}
+	if opt.IncrementalTags && opt.TagsCacheFile == "" {
+		errs = append(errs, fmt.Errorf("incremental tags listing needs the --tags-cache file"))
+	}
+	if opt.ContainerdNamespace != "" {
+		errs = append(errs, checkContainerdOption(opt)...)
+	}
+	for _, p := range opt.Platforms {
+		if ss := strings.Split(p, "/"); len(ss) < 2 || len(ss) > 3 {
+			errs = append(errs, fmt.Errorf("invalid platform %s, expected os/arch[/variant]", p))
+		}
+	}
+	if opt.OverridesFile != "" {
+		if _, err := loadOverrides(opt.OverridesFile); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load destination overrides: %s", err))
+		}
+	}
+	if err := checkNameTemplate(opt); err != nil {
+		errs = append(errs, fmt.Errorf("invalid destination name template: %s", err))
+	}
+	if _, err := parseTagRewrites(opt.TagRewrites); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkConfirmOption(opt); err != nil {
+		errs = append(errs, err)
+	}
+	if (opt.BatchNumber > 0 || opt.NextBatch) && opt.BatchTotal <= 0 {
+		errs = append(errs, fmt.Errorf("--batch-number and --next-batch need --batch-total or --shard"))
+	}
+	if opt.VerifyIdentity != "" && opt.VerifyIssuer == "" {
+		errs = append(errs, fmt.Errorf("--verify-identity needs the --verify-issuer OIDC issuer"))
+	}
+	if opt.SBOMFormat != "" {
+		if _, err := exec.LookPath("syft"); err != nil {
+			errs = append(errs, fmt.Errorf("--sbom needs syft in PATH: %s", err))
+		}
+	}
+	if opt.MinThroughput != "" {
+		if _, err := parseByteSize(opt.MinThroughput); err != nil {
+			errs = append(errs, fmt.Errorf("invalid min throughput %s: %s", opt.MinThroughput, err))
+		}
+	}
+	return errs
+}
+
+// syncImages syncs the total images received from in until it is closed,
+// total is negative while the images are still listed, history is the failure
+// history of opt.HistoryFile. The returned bool reports whether all received
+// images have been processed.
+func syncImages(ctx context.Context, in <-chan *Image, total int, opt *SyncOption, history map[string]*failureRecord, collisions *collisionGuard) (Images, bool) {
+	processWg := new(sync.WaitGroup)
+
+	var allowlist map[digest.Digest]bool
+	if opt.AllowlistFile != "" {
+		var aerr error
+		if allowlist, aerr = loadDigestList(opt.AllowlistFile); aerr != nil {
+			logrus.Fatalf("failed to load digest allowlist: %s", aerr)
+		}
+		logrus.Infof("loaded digest allowlist count: %d", len(allowlist))
+	}
+	var locked map[string]digest.Digest
+	if opt.LockFile != "" {
+		var lerr error
+		if locked, lerr = loadLockFile(opt.LockFile); lerr != nil {
+			logrus.Fatalf("failed to load lock file: %s", lerr)
+		}
+		logrus.Infof("loaded lock file images count: %d", len(locked))
+	}
+	var dedup *digestDedup
+	if opt.Dedup && !opt.OnlyDownloadManifests {
+		dedup = newDigestDedup()
+	}
+	var queue *workQueue
+	if opt.QueueFile != "" && !opt.OnlyDownloadManifests {
+		var qerr error
+		if queue, qerr = openWorkQueue(opt.QueueFile); qerr != nil {
+			logrus.Fatalf("failed to open work queue: %s", qerr)
+		}
+		defer queue.close()
+	}
+	var audit *auditLog
+	if opt.AuditLog != "" && !opt.OnlyDownloadManifests {
+		var aerr error
+		if audit, aerr = openAuditLog(opt.AuditLog, opt.AuditKey); aerr != nil {
+			logrus.Fatalf("failed to open audit log: %s", aerr)
+		}
+		defer func() { _ = audit.close() }()
+	}
+	webhooks := newWebhookNotifier(ctx, opt)
+	defer webhooks.close()
+
+	pool, err := ants.NewPool(opt.Limit, ants.WithPreAlloc(true), ants.WithPanicHandler(logPanic))
 	if err != nil {
 		logrus.Fatalf("failed to create goroutines pool: %s", err)
 	}
-	sort.Sort(imgs)
-	for i := 0; i < len(imgs); i++ {
-		k := i
+	// queueCtx stops the remaining images, in-flight copies still use ctx
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	defer stopQueue()
+	var stopOnce sync.Once
+	var processedCount, failedCount, remainingCount int64
+	// stopReason is the reason of the remaining images which were not attempted
+	var stopReason atomic.Value
+	stop := func(format string, args ...interface{}) {
+		stopOnce.Do(func() {
+			stopReason.Store(fmt.Sprintf(format, args...))
+			logrus.Errorf(format+", stop syncing the remaining images", args...)
+			stopQueue()
+		})
+	}
+	var overBudget int32
+	if opt.MaxDuration > 0 {
+		// in-flight copies finish within the reserved rest of the budget
+		timer := time.AfterFunc(time.Until(runStart.Add(opt.MaxDuration-opt.MaxDuration/budgetReserve)), func() {
+			atomic.StoreInt32(&overBudget, 1)
+			stop("time budget %s is nearly exhausted", opt.MaxDuration)
+		})
+		defer timer.Stop()
+	}
+	failed := func(img *Image) {
+		img.Err = classify(img.Err)
+		n := atomic.AddInt64(&failedCount, 1)
+		if opt.FailFast {
+			stop("fail fast: image %s failed", img.String())
+		}
+		if opt.MaxFailures > 0 && n >= int64(opt.MaxFailures) {
+			stop("failed images count reached the limit %d", opt.MaxFailures)
+		}
+		processed := atomic.AddInt64(&processedCount, 1)
+		if opt.MaxFailureRate > 0 && processed >= defaultFailureRateSamples && float64(n)/float64(processed) >= opt.MaxFailureRate {
+			stop("failed images rate reached the limit %.2f%%", opt.MaxFailureRate*100)
+		}
+	}
+
+	progress := newRunProgress(total)
+	stopProgress := progress.watch(opt.ProgressInterval, opt)
+	defer stopProgress()
+	stopFlush := watchManifestFlush(queueCtx)
+	defer stopFlush()
+	quota := newHubQuota(ctx, opt)
+	stopQuota := quota.watch(queueCtx, opt)
+	defer stopQuota()
+
+	var imgs Images
+	for img := range in {
+		imgs = append(imgs, img)
+		progress.receive()
+		image := img
+		processWg.Add(1)
 		err = pool.Submit(func() {
 			defer processWg.Done()
+			var copied int64
+			defer func() { progress.complete(copied) }()
+			defer func() {
+				if p := recover(); p != nil {
+					imagePanicked(image, p, opt, progress)
+					failed(image)
+				}
+			}()
 
 			select {
-			case <-ctx.Done():
+			case <-queueCtx.Done():
+				// remaining images are not failures, the next run syncs them
+				atomic.AddInt64(&remainingCount, 1)
+				image.Skipped = true
+				if atomic.LoadInt32(&overBudget) == 1 {
+					image.SkipReason = "time budget exhausted"
+				} else if reason, ok := stopReason.Load().(string); ok {
+					image.SkipReason = "not attempted, sync stopped: " + reason
+				} else {
+					image.SkipReason = "not attempted, sync interrupted"
+				}
 			default:
-				logrus.Debugf("process image: %s", imgs[k].String())
-				m, l, needSync := checkSync(imgs[k])
+				// count the image when it is finished, failed() counts the failed images
+				defer func() {
+					if !image.Failed() {
+						atomic.AddInt64(&processedCount, 1)
+					}
+				}()
+				if queue != nil {
+					defer queue.record(image)
+				}
+				logrus.Debugf("process image: %s", image.String())
+				if collisions != nil {
+					if cerr := collisions.check(image, opt); cerr != nil {
+						image.Err = newSyncError(PhaseCheck, image, opt, 0, cerr)
+						logrus.Error(image.Err)
+						failed(image)
+						return
+					}
+				}
+				if tag := destinationTag(image, opt); tag != image.Tag {
+					image.DestTag = tag
+				}
+				if image.Tag == latestTag && (opt.LatestPolicy == LatestSkip || opt.LatestPolicy == LatestSemver) {
+					image.Skip("latest tag policy: " + opt.LatestPolicy)
+					return
+				}
+				if r, ok := quarantined(image, history, opt); ok {
+					image.Skip(fmt.Sprintf("quarantined after %d failures, last error: %s", r.Failures, r.Error))
+					return
+				}
+				if locked != nil {
+					pinned, ok := locked[image.String()]
+					if !ok {
+						image.Skip("not in lock file")
+						return
+					}
+					image.Pinned = pinned
+				}
+				if !quota.take(image) {
+					image.Skip("docker hub pull quota exhausted, left to the next run")
+					return
+				}
+				m, l, bs, needSync := checkSync(ctx, image, opt)
 				if !needSync {
+					if image.Err != nil {
+						failed(image)
+					}
 					return
 				}
-				var bs []byte
-				if m != nil {
-					bs, err = jsoniter.MarshalIndent(m, "", "    ")
-				} else {
-					bs, err = jsoniter.MarshalIndent(l, "", "    ")
+				if locked != nil {
+					// the manifests were fetched by the locked digest, only warn for moved tags
+					sys := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
+					if dgst, derr := getManifestDigest(ctx, image.String(), sys); derr == nil && dgst != image.Pinned {
+						logrus.Warnf("image [%s] digest changed to %s, sync the locked digest %s", image.String(), dgst, image.Pinned)
+					}
+				}
+				if allowlist != nil {
+					if !allowlist[image.Digest] {
+						image.Skip(fmt.Sprintf("digest %s not in allowlist", image.Digest))
+						return
+					}
+					pinDigest(image)
+				}
+				if image.Schema1 && opt.Schema1 == Schema1Skip {
+					image.Skip("docker schema1 manifest")
+					return
+				}
+				if opt.ScanSeverity != "" && !opt.OnlyDownloadManifests {
+					findings, serr := scanImage(ctx, image, opt)
+					if serr != nil {
+						image.Err = newSyncError(PhaseCheck, image, opt, 0, serr)
+						logrus.Error(image.Err)
+						failed(image)
+						return
+					}
+					if len(findings) > 0 {
+						image.Findings = formatFindings(findings)
+						if !opt.ScanFlagOnly {
+							image.Skip("vulnerabilities found: " + image.Findings)
+							return
+						}
+						logrus.Warnf("image [%s] vulnerabilities found: %s", image.String(), image.Findings)
+					}
+					pinDigest(image)
 				}
-				if err != nil {
-					logrus.Errorf("failed to storage image [%s] manifests: %s", imgs[k].String(), err)
+				if (opt.VerifyKey != "" || opt.VerifyIdentity != "") && !opt.OnlyDownloadManifests {
+					if verr := verifySourceSignature(ctx, image, opt); verr != nil {
+						image.Unverified = true
+						image.Skip(verr.Error())
+						return
+					}
+					pinDigest(image)
+				}
+				if image.Digest != "" && !opt.OnlyDownloadManifests {
+					ok, perr := checkDestinationTag(ctx, image, opt)
+					if perr != nil {
+						image.Err = newSyncError(PhaseCheck, image, opt, 0, perr)
+						logrus.Error(image.Err)
+						failed(image)
+						return
+					}
+					if !ok {
+						return
+					}
 				}
-				logrus.Debug(string(bs))
+				if image.DestPresent {
+					logrus.Infof("image [%s] destination already has digest %s, skip copy...", image.String(), image.Digest)
+					image.Success = true
+					if perr := storage.Put(manifestFileName(image, ".json"), bs); perr != nil {
+						logrus.Error(newSyncError(PhaseStore, image, opt, 0, fmt.Errorf("failed to store manifests: %s", perr)))
+					}
+					return
+				}
+				logrus.Trace(string(bs))
 
-				rerr := retry(defaultSyncRetry, defaultSyncRetryTime, func() error {
-					return sync2DockerHub(imgs[k], opt)
+				var leader *dedupLeader
+				if dedup != nil && image.Digest != "" {
+					var release func()
+					if leader, release = dedup.claim(image, opt); release != nil {
+						defer release()
+					} else if !leader.wait(queueCtx) {
+						// sync the image itself if the leader failed
+						leader = nil
+					}
+				}
+
+				up := newUploadProgress()
+				rerr := retryWithContext(queueCtx, defaultSyncRetry, defaultSyncRetryTime, func() error {
+					image.Attempts++
+					serr := limiter.do(ctx, func() error {
+						if leader != nil {
+							return tagDestination(ctx, leader.image, image, opt)
+						}
+						return sync2DockerHub(ctx, image, l, bs, opt, up)
+					})
+					// auth errors will not recover by retrying
+					if opt.FailFast && isAuthError(serr) {
+						stop("fail fast: image %s authentication failed", image.String())
+					}
+					if serr != nil {
+						return serr
+					}
+					return postSync(ctx, image, opt)
 				})
+				_, copied = up.committedSize()
+				if rerr != nil && image.Schema1 && schema1MIMEType(opt) != "" && !opt.PreserveDigests {
+					image.Skip(fmt.Sprintf("unconvertible docker schema1 manifest: %s", rerr))
+					return
+				}
 				if rerr != nil {
-					imgs[k].Err = rerr
-					logrus.Errorf("failed to process image %s, error: %s", imgs[k].String(), rerr)
+					image.Err = newSyncError(PhaseCopy, image, opt, image.Attempts, rerr)
+					logrus.Error(image.Err)
+					failed(image)
 					return
 				}
-				imgs[k].Success = true
-
-				storageDir := filepath.Join(ManifestDir, imgs[k].Repo, imgs[k].User, imgs[k].Name)
-				// ignore other error
-				if _, err = os.Stat(storageDir); err != nil {
-					if err = os.MkdirAll(storageDir, 0755); err != nil {
-						logrus.Errorf("failed to storage image [%s] manifests: %s", imgs[k].String(), err)
+				image.Success = true
+				if audit != nil {
+					if aerr := audit.record(image, destinationImage(image, opt)); aerr != nil {
+						logrus.Errorf("failed to record image [%s] audit log: %s", image.String(), aerr)
 					}
 				}
+				webhooks.synced(image, destinationImage(image, opt))
 
-				if ferr := ioutil.WriteFile(filepath.Join(storageDir, imgs[k].Tag+".json"), bs, 0644); ferr != nil {
-					logrus.Errorf("failed to storage image [%s] manifests: %s", imgs[k].String(), ferr)
+				if perr := storage.Put(manifestFileName(image, ".json"), bs); perr != nil {
+					logrus.Error(newSyncError(PhaseStore, image, opt, 0, fmt.Errorf("failed to store manifests: %s", perr)))
+				}
+				if l != nil && (opt.PlatformManifests || opt.StoreConfig) {
+					if perr := storePlatformManifests(ctx, image, l, opt); perr != nil {
+						logrus.Error(newSyncError(PhaseStore, image, opt, 0, fmt.Errorf("failed to store platform manifests: %s", perr)))
+					}
+				}
+				if m != nil && opt.StoreConfig {
+					if cerr := storeImageConfig(ctx, image, m); cerr != nil {
+						logrus.Error(newSyncError(PhaseStore, image, opt, 0, fmt.Errorf("failed to store config: %s", cerr)))
+					}
 				}
 			}
 		})
@@ -139,132 +800,478 @@ func SyncImages(ctx context.Context, images Images, opt *SyncOption) Images {
 	}
 	processWg.Wait()
 	pool.Release()
-	return imgs
+	if opt.ProgressInterval > 0 {
+		logrus.Info(progress.String(opt))
+	}
+	if history != nil && !opt.OnlyDownloadManifests {
+		if herr := writeHistory(opt.HistoryFile, history, imgs); herr != nil {
+			logrus.Errorf("failed to write failure history: %s", herr)
+		}
+	}
+	hubRate.Lock()
+	if hubRate.deferred > 0 {
+		logrus.Warnf("docker hub pull quota exhausted, %d docker hub images remain to sync", hubRate.deferred)
+	}
+	hubRate.Unlock()
+	if n := atomic.LoadInt64(&remainingCount); n > 0 {
+		if atomic.LoadInt32(&overBudget) == 1 {
+			logrus.Warnf("time budget %s exhausted, %d of %d images remain to sync", opt.MaxDuration, n, len(imgs))
+		} else {
+			logrus.Warnf("sync stopped, %d of %d images were not attempted", n, len(imgs))
+		}
+	}
+	return imgs, queueCtx.Err() == nil && int(atomic.LoadInt64(&processedCount)) == len(imgs)
+}
+
+// writeSyncFiles prunes and writes the buffered manifests, the lock and
+// mapping files of the synced images, the manifests are committed with ManifestGit.
+func writeSyncFiles(imgs Images, opt *SyncOption) {
+	applyRetention(imgs, opt)
+	flushManifests()
+	commitManifests(imgs)
+	saveTagCache()
+	if opt.WriteLockFile != "" && !opt.OnlyDownloadManifests {
+		if err := writeLockFile(opt.WriteLockFile, imgs); err != nil {
+			logrus.Errorf("failed to write lock file: %s", err)
+		}
+	}
+	if opt.MappingFile != "" && !opt.OnlyDownloadManifests {
+		if err := writeMapping(imgs, opt); err != nil {
+			logrus.Errorf("failed to write mapping file: %s", err)
+		}
+	}
+	if opt.FailedFile != "" {
+		if err := writeFailed(opt.FailedFile, imgs); err != nil {
+			logrus.Errorf("failed to write failed images file: %s", err)
+		}
+	}
+	if opt.DeadLetterFile != "" && !opt.OnlyDownloadManifests {
+		if err := updateDeadLetters(opt.DeadLetterFile, imgs); err != nil {
+			logrus.Errorf("failed to write dead-letter file: %s", err)
+		}
+	}
+	if opt.ResultsFile != "" {
+		if err := writeResults(opt.ResultsFile, imgs); err != nil {
+			logrus.Errorf("failed to write results file: %s", err)
+		}
+	}
 }
 
-func sync2DockerHub(image *Image, opt *SyncOption) error {
+// sync2DockerHub copies the image to the destination, blob is the source
+// manifest of the image and l the parsed manifest list if it is a list.
+func sync2DockerHub(ctx context.Context, image *Image, l manifest.List, blob []byte, opt *SyncOption, up *uploadProgress) error {
 	if opt.OnlyDownloadManifests {
 		return nil
 	}
-	destImage := Image{
-		Repo: defaultDockerRepo,
-		User: opt.User,
-		Name: image.MergeName(),
-		Tag:  image.Tag,
+	destImage := destinationImage(image, opt)
+	if opt.CreateRepos {
+		if err := ensureRepository(ctx, destImage, opt); err != nil {
+			return err
+		}
 	}
 
-	logrus.Infof("syncing %s => %s", image.String(), destImage.String())
+	dest := destImage.String()
+	if opt.ContainerdNamespace != "" {
+		dest = fmt.Sprintf("containerd %s/%s:%s", opt.ContainerdNamespace, containerdName(image), image.Tag)
+	}
+	logrus.Infof("syncing %s => %s", image.String(), dest)
 
-	ctx, cancel := context.WithTimeout(context.Background(), opt.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, imageTimeout(ctx, image, l, blob, opt))
 	defer cancel()
 
-	policyContext, err := signature.NewPolicyContext(
-		&signature.Policy{
-			Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
-		},
-	)
+	if opt.CopyEngine == EngineCrane {
+		return craneCopy(ctx, image, destImage, opt)
+	}
+
+	stallTimeout := opt.StallTimeout
+	if opt.ContainerdNamespace != "" {
+		// the containerd import after the copy reports no progress
+		stallTimeout = 0
+	}
+	stallCtx, stalled := up.watchStall(ctx, stallTimeout)
+	err := copyToDestination(stallCtx, image, destImage, l, blob, opt, up)
+	if stalled() {
+		logrus.Warnf("image [%s] copy made no progress for %s, cancelled", image.String(), opt.StallTimeout)
+		return withClass(ErrTimeout, fmt.Errorf("copy stalled, no progress for %s", opt.StallTimeout))
+	}
+	return err
+}
+
+// copyToDestination copies the image with containers/image, the layer
+// progress is reported to up.
+func copyToDestination(ctx context.Context, image, destImage *Image, l manifest.List, blob []byte, opt *SyncOption, up *uploadProgress) error {
+	if parallelPlatforms(l, opt) {
+		up.resume(image)
+		return copyPlatforms(ctx, image, destImage, l, blob, opt, up)
+	}
+
+	policyContext, err := newPolicyContext(opt)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = policyContext.Destroy() }()
 
-	srcRef, err := docker.ParseReference("//" + image.String())
+	srcRef, err := docker.ParseReference("//" + sourceReference(image))
 	if err != nil {
 		return err
 	}
+	srcRef = newLimitedReference(srcRef, opt.ParallelLayers)
+	srcRef = newBlobCacheReference(srcRef, opt)
+	srcRef = newPlatformFilterReference(srcRef, image, newPlatformFilter(opt))
 	destRef, err := docker.ParseReference("//" + destImage.String())
 	if err != nil {
 		return err
 	}
+	var layout string
+	if opt.ContainerdNamespace != "" {
+		var cleanup func()
+		if destRef, layout, cleanup, err = containerdLayout(image); err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	if layout == "" {
+		destRef = newResumableReference(destRef, destImage, opt, up)
+	}
 
 	sourceCtx := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
-	destinationCtx := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{
-		Username: opt.User,
-		Password: opt.Password,
-	}}
+	destinationCtx := destinationSystemContext(opt)
+	destinationCtx.CompressionFormat = recompressionFormat(opt)
+
+	up.resume(image)
+	progressCh := make(chan types.ProgressProperties)
+	progressDone := make(chan struct{})
+	go func() {
+		up.watch(image, progressCh)
+		close(progressDone)
+	}()
+
+	var forceMIMEType string
+	if image.Schema1 && !opt.PreserveDigests {
+		forceMIMEType = schema1MIMEType(opt)
+	}
 
 	logrus.Debugf("copy %s to docker hub...", image.String())
+	copiedManifest, err := copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{
+		SourceCtx:             sourceCtx,
+		DestinationCtx:        destinationCtx,
+		ImageListSelection:    copy.CopyAllImages,
+		ProgressInterval:      defaultProgressInterval,
+		Progress:              progressCh,
+		ForceManifestMIMEType: forceMIMEType,
+	})
+	close(progressCh)
+	<-progressDone
+	logrus.Debugf("%s copy done.", image.String())
+	if err == nil {
+		recompressedLayers(image, blob, copiedManifest, opt)
+	}
+	if err == nil && layout != "" {
+		return containerdImport(ctx, image, layout, opt)
+	}
+	if err != nil || !opt.PreserveDigests || image.Digest == "" {
+		return err
+	}
+
+	// the manifest list or instance manifests have been re-serialized during copy
+	copiedDigest, err := manifest.Digest(copiedManifest)
+	if err != nil {
+		return err
+	}
+	if copiedDigest != image.Digest {
+		return fmt.Errorf("image [%s] manifest has been modified during copy, source digest: %s, copied digest: %s", image.String(), image.Digest, copiedDigest)
+	}
+	return nil
+}
+
+// postSync runs the steps after the image has been copied to the destination,
+// a returned error makes the sync retried.
+func postSync(ctx context.Context, image *Image, opt *SyncOption) error {
+	if opt.OnlyDownloadManifests {
+		return nil
+	}
+	if opt.Verify {
+		if err := verifyDigest(ctx, image, opt); err != nil {
+			if opt.VerifyRetry {
+				return err
+			}
+			logrus.Error(err)
+		}
+	}
+	if opt.CopyReferrers {
+		if err := copyReferrers(ctx, image, opt); err != nil {
+			return err
+		}
+	}
+	if opt.CopySignatures {
+		if err := copyCosignTags(ctx, image, opt); err != nil {
+			return err
+		}
+	}
+	if err := signImage(ctx, image, opt); err != nil {
+		return err
+	}
+	if opt.SBOMFormat != "" {
+		if err := generateSBOM(ctx, image, opt); err != nil {
+			logrus.Error(err)
+		}
+	}
+	return nil
+}
+
+// newPolicyContext returns the signature policy which source images must
+// meet, all images are accepted when no policy file is specified.
+func newPolicyContext(opt *SyncOption) (*signature.PolicyContext, error) {
+	if opt.PolicyFile == "" {
+		return signature.NewPolicyContext(
+			&signature.Policy{
+				Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+			},
+		)
+	}
+	policy, err := signature.NewPolicyFromFile(opt.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy file %s: %s", opt.PolicyFile, err)
+	}
+	return signature.NewPolicyContext(policy)
+}
+
+// copyReference copies a single docker reference (name:tag or name@digest) as is.
+func copyReference(ctx context.Context, src, dest string, opt *SyncOption) error {
+	return copyReferenceWithContext(ctx, src, dest, &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}, opt)
+}
+
+// copyReferenceWithContext copies a single docker reference with the source system context.
+func copyReferenceWithContext(ctx context.Context, src, dest string, sourceCtx *types.SystemContext, opt *SyncOption) error {
+	policyContext, err := newPolicyContext(opt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = policyContext.Destroy() }()
+
+	srcRef, err := docker.ParseReference("//" + src)
+	if err != nil {
+		return err
+	}
+	destRef, err := docker.ParseReference("//" + dest)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opt.Timeout)
+	defer cancel()
 	_, err = copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{
 		SourceCtx:          sourceCtx,
-		DestinationCtx:     destinationCtx,
+		DestinationCtx:     destinationSystemContext(opt),
 		ImageListSelection: copy.CopyAllImages,
 	})
-	logrus.Debugf("%s copy done.", image.String())
 	return err
 }
 
-func getImageTags(imageName string, opt TagsOption) ([]string, error) {
+// schema1MIMEType returns the manifest type which schema1 manifests convert to.
+func schema1MIMEType(opt *SyncOption) string {
+	switch opt.Schema1 {
+	case Schema1Convert:
+		return manifest.DockerV2Schema2MediaType
+	case Schema1ConvertOCI:
+		return imgspecv1.MediaTypeImageManifest
+	default:
+		return ""
+	}
+}
+
+// destinationImage returns the destination image which the image syncs to.
+func destinationImage(image *Image, opt *SyncOption) *Image {
+	if dest, ok := overrideDestination(image, opt); ok {
+		return dest
+	}
+	return &Image{
+		Repo: destinationRegistry(opt),
+		User: destinationNamespace(opt),
+		Name: destinationName(image, opt),
+		Tag:  destinationTag(image, opt),
+	}
+}
+
+// destinationSystemContext returns the system context of the destination,
+// copies keep the blob info cache(known blob locations and compressed
+// digests) in opt.BlobCacheDir if set.
+func destinationSystemContext(opt *SyncOption) *types.SystemContext {
+	return &types.SystemContext{
+		DockerAuthConfig: &types.DockerAuthConfig{
+			Username: opt.User,
+			Password: opt.Password,
+		},
+		BlobInfoCacheDir: opt.BlobCacheDir,
+	}
+}
+
+func getImageTags(ctx context.Context, imageName string, opt TagsOption) ([]string, error) {
 	srcRef, err := docker.ParseReference("//" + imageName)
 	if err != nil {
-		return nil, err
+		return nil, listError(imageName, err)
 	}
 	sourceCtx := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{}}
-	tagsCtx, tagsCancel := context.WithTimeout(context.Background(), opt.Timeout)
+	tagsCtx, tagsCancel := context.WithTimeout(ctx, opt.Timeout)
 	defer tagsCancel()
-	return docker.GetRepositoryTags(tagsCtx, sourceCtx, srcRef)
+	var tags []string
+	if tagsCache != nil {
+		tags, err = tagsCache.list(tagsCtx, imageName)
+	} else {
+		tags, err = docker.GetRepositoryTags(tagsCtx, sourceCtx, srcRef)
+	}
+	return tags, classify(listError(imageName, err))
 }
 
-func checkSync(image *Image) (manifest.Manifest, manifest.List, bool) {
+func checkSync(ctx context.Context, image *Image, opt *SyncOption) (manifest.Manifest, manifest.List, []byte, bool) {
 	var m manifest.Manifest
 	var l manifest.List
-	var merr error
+	var mbs []byte
 
-	err := retry(DefaultGoRequestRetry, DefaultGoRequestRetryTime, func() error {
-		m, l, merr = getImageManifest(image.String())
-		if merr != nil {
+	var attempt int
+	err := retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+		attempt++
+		return limiter.do(ctx, func() error {
+			var merr error
+			m, l, mbs, merr = getImageManifest(ctx, sourceReference(image))
+			if merr != nil {
+				return merr
+			}
+			image.Digest, merr = manifest.Digest(mbs)
 			return merr
-		}
-		return nil
+		})
 	})
 
 	if err != nil {
-		image.Err = err
-		logrus.Errorf("failed to get image [%s] manifest, error: %s", image.String(), err)
-		return nil, nil, false
+		image.Err = classify(newSyncError(PhaseCheck, image, opt, attempt, fmt.Errorf("failed to get manifest: %w", err)))
+		logrus.Error(image.Err)
+		return nil, nil, nil, false
+	}
+	if _, ok := m.(*manifest.Schema1); ok {
+		image.Schema1 = true
+		logrus.Debugf("image [%s] has a docker schema1 manifest", image.String())
 	}
 	val, ok := manifestsMap[image.String()]
-	if (ok && m != nil && reflect.DeepEqual(m, val)) || (ok && l != nil && reflect.DeepEqual(l, val)) {
+	compact, isCompact := val.(*compactManifest)
+	if (isCompact && compact.digest == image.Digest) || (ok && m != nil && reflect.DeepEqual(m, val)) || (ok && l != nil && reflect.DeepEqual(l, val)) {
 		image.Success = true
 		image.CacheHit = true
 		logrus.Debugf("image [%s] not changed, skip sync...", image.String())
-		return nil, nil, false
+		return nil, nil, nil, false
+	}
+	if ok {
+		var cur interface{} = l
+		if m != nil {
+			cur = m
+		}
+		if image.Changes = manifestDiff(val, cur); image.Changes != "" {
+			logrus.Infof("image [%s] changed: %s", image.String(), image.Changes)
+		}
 	}
-	return m, l, true
+	return m, l, mbs, true
 }
 
+// batchProcess returns the images of the batch opt.BatchNumber, images are
+// assigned to batches by the hash of their name, so every image stays in the
+// same batch when images are added or removed upstream.
 func batchProcess(images Images, opt *SyncOption) Images {
-	if opt.BatchSize > 0 && opt.BatchNumber > 0 && len(images) > opt.BatchSize {
-		n := len(images) / opt.BatchSize
-		var start, end int
-		if opt.BatchNumber >= n {
-			start = opt.BatchSize * (n - 1)
-			return images[start:]
+	if opt.BatchNumber <= 0 {
+		return images
+	}
+	total := opt.BatchTotal
+	if total <= 1 {
+		return images
+	}
+	if opt.BatchNumber > total {
+		logrus.Fatalf("batch number %d exceeds the batches count %d", opt.BatchNumber, total)
+	}
+
+	var batch Images
+	if opt.BatchBySize {
+		batch = sizeBatch(images, total, opt.BatchNumber)
+	} else {
+		for _, img := range images {
+			if imageShard(img, total) == opt.BatchNumber-1 {
+				batch = append(batch, img)
+			}
 		}
-		start = opt.BatchSize * (opt.BatchNumber - 1)
-		end = opt.BatchSize * opt.BatchNumber
-		return images[start:end]
 	}
-	return images
+	logrus.Infof("batch %d/%d images count: %d", opt.BatchNumber, total, len(batch))
+	return batch
 }
 
-func report(images Images, opt *SyncOption) {
-	if !opt.Report {
-		return
+// imageShard returns the stable shard index of the image.
+func imageShard(image *Image, shards int) int {
+	return nameShard(image.String(), shards)
+}
+
+// nameShard returns the stable shard index of the image name, e.g. gcr.io/ns/name:tag.
+func nameShard(name string, shards int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int(h.Sum64() % uint64(shards))
+}
+
+// CheckFailures returns an error if the failed images rate exceeds opt.FailureRate.
+// The invalid image references of the source count as failed images.
+func CheckFailures(images Images, opt *SyncOption) error {
+	failedCount := invalidRefsCount()
+	total := len(images) + failedCount
+	for _, img := range images {
+		if img.Failed() {
+			failedCount++
+		}
 	}
-	var successCount, failedCount, cacheHitCount int
-	var report string
+	if failedCount == 0 {
+		return nil
+	}
+	rate := float64(failedCount) / float64(total)
+	if rate > opt.FailureRate {
+		return fmt.Errorf("%d of %d images failed to sync (%.2f%%), exceeds the failure rate %.2f%%", failedCount, total, rate*100, opt.FailureRate*100)
+	}
+	logrus.Warnf("%d of %d images failed to sync (%.2f%%)", failedCount, total, rate*100)
+	return nil
+}
 
+// imageCounts are the result counts of the images.
+type imageCounts struct {
+	Total, Success, Failed, Skipped, CacheHit, Mismatch int
+}
+
+func countImages(images Images) imageCounts {
+	c := imageCounts{Total: len(images)}
 	for _, img := range images {
 		if img.Success {
-			successCount++
+			c.Success++
 			if img.CacheHit {
-				cacheHitCount++
+				c.CacheHit++
 			}
+		} else if img.Skipped {
+			c.Skipped++
 		} else {
-			failedCount++
+			c.Failed++
+		}
+		if img.DigestMismatch {
+			c.Mismatch++
 		}
 	}
-	report = fmt.Sprintf(reportHeaderTpl, Banner, len(images), failedCount, successCount, cacheHitCount)
+	return c
+}
+
+func report(images Images, opt *SyncOption) {
+	writeActionsOutputs(images, opt)
+	// the errors summary is printed without the report too
+	summary := errorSummary(images) + invalidRefsSummary()
+	if !opt.Report {
+		if summary != "" {
+			fmt.Println(Redact(summary))
+		}
+		return
+	}
+	c := countImages(images)
+	report := fmt.Sprintf(reportHeaderTpl, Banner, c.Total, c.Failed, c.Success, c.Skipped, c.CacheHit, c.Mismatch)
+	report += hubRateReport()
+	report += summary
 
 	if opt.ReportLevel > 1 {
 		var buf bytes.Buffer
@@ -274,6 +1281,72 @@ func report(images Images, opt *SyncOption) {
 			logrus.Errorf("failed to create report error: %s", err)
 		}
 		report += buf.String()
+
+		buf.Reset()
+		reportFindings, _ := template.New("").Parse(reportFindingsTpl)
+		err = reportFindings.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report findings: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportUnverified, _ := template.New("").Parse(reportUnverifiedTpl)
+		err = reportUnverified.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report unverified: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportOverwritten, _ := template.New("").Parse(reportOverwrittenTpl)
+		err = reportOverwritten.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report overwritten: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportRewritten, _ := template.New("").Parse(reportRewrittenTpl)
+		err = reportRewritten.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report rewritten: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportRecompressed, _ := template.New("").Parse(reportRecompressedTpl)
+		err = reportRecompressed.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report recompressed: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportChanged, _ := template.New("").Parse(reportChangedTpl)
+		err = reportChanged.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report changed: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		reportSkipped, _ := template.New("").Parse(reportSkippedTpl)
+		err = reportSkipped.Execute(&buf, images)
+		if err != nil {
+			logrus.Errorf("failed to create report skipped: %s", err)
+		}
+		report += buf.String()
+
+		buf.Reset()
+		prunedManifests.Lock()
+		reportPruned, _ := template.New("").Parse(reportPrunedTpl)
+		err = reportPruned.Execute(&buf, prunedManifests.images)
+		prunedManifests.Unlock()
+		if err != nil {
+			logrus.Errorf("failed to create report pruned: %s", err)
+		}
+		report += buf.String()
 	}
 
 	if opt.ReportLevel > 2 {
@@ -285,6 +1358,7 @@ func report(images Images, opt *SyncOption) {
 		}
 		report += buf.String()
 	}
+	report = Redact(report)
 	fmt.Println(report)
 	if opt.ReportFile != "" {
 		err := ioutil.WriteFile(opt.ReportFile, []byte(report), 0644)
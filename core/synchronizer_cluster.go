@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// clusterWorkloads are the kubernetes resources scanned for image references.
+const clusterWorkloads = "pods,deployments,daemonsets,statefulsets,replicasets,jobs,cronjobs"
+
+var cluster Cluster
+
+// Cluster syncs the images referenced by the workloads of a kubernetes
+// cluster, the workloads are listed with kubectl.
+type Cluster struct {
+	kubeconfig string
+	context    string
+	namespaces []string
+}
+
+func (c *Cluster) Images(ctx context.Context) Images {
+	logrus.Info("scan kubernetes cluster workloads...")
+	var globals []string
+	if c.kubeconfig != "" {
+		globals = append(globals, "--kubeconfig", c.kubeconfig)
+	}
+	if c.context != "" {
+		globals = append(globals, "--context", c.context)
+	}
+
+	refs := make(map[string]bool)
+	scan := func(nsArgs ...string) {
+		args := append([]string{"get", clusterWorkloads, "--output", "json"}, nsArgs...)
+		out, err := runCommand(ctx, nil, "kubectl", append(args, globals...)...)
+		if err != nil {
+			logrus.Fatalf("failed to list cluster workloads: %s", err)
+		}
+		if err = findManifestImageRefs(out, refs); err != nil {
+			logrus.Fatalf("failed to parse cluster workloads: %s", err)
+		}
+	}
+	if len(c.namespaces) == 0 {
+		scan("--all-namespaces")
+	}
+	for _, ns := range c.namespaces {
+		scan("--namespace", ns)
+	}
+	return imagesFromRefs(refs)
+}
+
+func (c *Cluster) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, c.setDefault(opt), opt)
+	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+func (c *Cluster) setDefault(opt *SyncOption) *Cluster {
+	c.kubeconfig = opt.Kubeconfig
+	c.context = opt.KubeContext
+	c.namespaces = opt.KubeNamespaces
+	return c
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	execSynchronizerPrefix = "exec:"
+
+	// execPluginProtocol is the plugin protocol version passed to plugins
+	execPluginProtocol = "1"
+)
+
+// ExecPlugin is a synchronizer backed by an external plugin binary. The plugin
+// writes one JSON object per line to stdout for each image to sync, either a
+// full reference or its parts:
+//
+//	{"image": "registry.example.com/team/app:v1.0.0"}
+//	{"repo": "registry.example.com", "user": "team", "name": "app", "tag": "v1.0.0"}
+//
+// The plugin receives the protocol version in IMGSYNC_PLUGIN_PROTOCOL, a
+// non-zero exit status fails the sync.
+type ExecPlugin struct {
+	path       string
+	args       []string
+	queryLimit int
+}
+
+type execPluginImage struct {
+	Image string `json:"image"`
+	Repo  string `json:"repo"`
+	User  string `json:"user"`
+	Name  string `json:"name"`
+	Tag   string `json:"tag"`
+}
+
+func newExecPlugin(path string) *ExecPlugin {
+	return &ExecPlugin{path: path}
+}
+
+func (ep *ExecPlugin) Images(ctx context.Context) Images {
+	logrus.Infof("get plugin [%s] images...", ep.path)
+	env := []string{
+		"IMGSYNC_PLUGIN_PROTOCOL=" + execPluginProtocol,
+		"IMGSYNC_QUERY_LIMIT=" + strconv.Itoa(ep.queryLimit),
+	}
+	out, err := runCommand(ctx, env, ep.path, ep.args...)
+	if err != nil {
+		logrus.Fatalf("failed to run plugin: %s", err)
+	}
+	images, err := parsePluginImages(out)
+	if err != nil {
+		logrus.Fatalf("invalid plugin [%s] output: %s", ep.path, err)
+	}
+	return images
+}
+
+func parsePluginImages(out []byte) (Images, error) {
+	var images Images
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var pi execPluginImage
+		if err := jsoniter.Unmarshal(scanner.Bytes(), &pi); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		if pi.Image != "" {
+			img, err := parseImage(pi.Image)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			images = append(images, img)
+			continue
+		}
+		if pi.Repo == "" || pi.Name == "" || pi.Tag == "" {
+			return nil, fmt.Errorf("line %d: repo, name and tag are required", line)
+		}
+		images = append(images, &Image{Repo: pi.Repo, User: pi.User, Name: pi.Name, Tag: pi.Tag})
+	}
+	return images, scanner.Err()
+}
+
+func (ep *ExecPlugin) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, ep.setDefault(opt), opt)
+	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+func (ep *ExecPlugin) setDefault(opt *SyncOption) *ExecPlugin {
+	ep.args = opt.PluginArgs
+	if opt.QueryLimit == 0 {
+		ep.queryLimit = DefaultLimit
+	} else {
+		ep.queryLimit = opt.QueryLimit
+	}
+	return ep
+}
@@ -2,14 +2,31 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	FlannelReleasesAll    = "all"    // Sync all flannel releases of github
+	FlannelReleasesLatest = "latest" // Sync the latest flannel release
+
+	flannelReleasesTpl = "https://api.github.com/repos/flannel-io/flannel/releases?per_page=100&page=%d"
+)
+
+// flannelArchs are the architecture suffixes of flannel image tags, e.g. v0.13.0-arm64
+var flannelArchs = []string{"amd64", "arm64", "arm", "ppc64le", "s390x", "mips64le", "riscv64"}
+
 var fl Flannel
 
 type Flannel struct {
+	releases int // number of latest releases to sync, -1 syncs all releases, 0 syncs all tags
+	archTags bool
 }
 
 func (fl *Flannel) Images(ctx context.Context) Images {
@@ -18,12 +35,26 @@ func (fl *Flannel) Images(ctx context.Context) Images {
 	select {
 	case <-ctx.Done():
 	default:
-		tags, err := getImageTags(flannelImageName, TagsOption{Timeout: DefaultCtxTimeout})
+		var tags []string
+		err := limiter.do(ctx, func() error {
+			var lerr error
+			tags, lerr = getImageTags(ctx, flannelImageName, TagsOption{Timeout: DefaultCtxTimeout})
+			return lerr
+		})
 		if err != nil {
-			logrus.Errorf("failed to get [%s] image tags, error: %s", flannelImageName, err)
+			logrus.Error(err)
 			return nil
 		}
 
+		if fl.releases != 0 {
+			releases, rerr := fl.githubReleases(ctx)
+			if rerr != nil {
+				logrus.Errorf("failed to get flannel releases, error: %s", rerr)
+				return nil
+			}
+			tags = fl.releaseTags(releases, tags)
+		}
+
 		ss := strings.Split(flannelImageName, "/")
 		for _, tag := range tags {
 			images = append(images, &Image{
@@ -38,13 +69,104 @@ func (fl *Flannel) Images(ctx context.Context) Images {
 	return images
 }
 
-func (fl *Flannel) Sync(ctx context.Context, opt *SyncOption) {
-	flImages := fl.setDefault(opt).Images(ctx)
-	logrus.Infof("sync images count: %d", len(flImages))
-	imgs := SyncImages(ctx, flImages, opt)
+func (fl *Flannel) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, fl.setDefault(opt), opt)
 	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+// releaseTags returns the registry tags of the releases, together with
+// their architecture suffixed tags if enabled. Releases without image tags
+// are skipped before the latest releases limit is applied, so the limit
+// counts the releases which can be synced.
+func (fl *Flannel) releaseTags(releases, tags []string) []string {
+	exists := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		exists[tag] = true
+	}
+
+	var rTags []string
+	var synced int
+	for _, release := range releases {
+		if fl.releases > 0 && synced == fl.releases {
+			break
+		}
+		var relTags []string
+		if exists[release] {
+			relTags = append(relTags, release)
+		}
+		if fl.archTags {
+			for _, arch := range flannelArchs {
+				if tag := release + "-" + arch; exists[tag] {
+					relTags = append(relTags, tag)
+				}
+			}
+		}
+		if len(relTags) == 0 {
+			logrus.Warnf("flannel release %s has no image tag", release)
+			continue
+		}
+		rTags = append(rTags, relTags...)
+		synced++
+	}
+	return rTags
 }
 
-func (fl *Flannel) setDefault(_ *SyncOption) *Flannel {
+// githubReleases returns the flannel release tags of github, newest first,
+// drafts and pre-releases are ignored.
+func (fl *Flannel) githubReleases(ctx context.Context) ([]string, error) {
+	var releases []string
+	for page := 1; ; page++ {
+		header := http.Header{}
+		if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+			RegisterSecret(token)
+			header.Set("Authorization", "token "+token)
+		}
+		resp, body, err := httpGet(ctx, fmt.Sprintf(flannelReleasesTpl, page), header)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("github api status: %s", resp.Status)
+		}
+
+		var rs []struct {
+			TagName    string `json:"tag_name"`
+			Draft      bool   `json:"draft"`
+			Prerelease bool   `json:"prerelease"`
+		}
+		if err := jsoniter.Unmarshal(body, &rs); err != nil {
+			return nil, err
+		}
+		if len(rs) == 0 {
+			return releases, nil
+		}
+		for _, r := range rs {
+			if !r.Draft && !r.Prerelease {
+				releases = append(releases, r.TagName)
+			}
+		}
+		if fl.releases > 0 && len(releases) >= fl.releases {
+			return releases, nil
+		}
+	}
+}
+
+func (fl *Flannel) setDefault(opt *SyncOption) *Flannel {
+	fl.archTags = opt.FlannelArchTags
+	switch opt.FlannelReleases {
+	case "":
+		fl.releases = 0
+	case FlannelReleasesAll:
+		fl.releases = -1
+	case FlannelReleasesLatest:
+		fl.releases = 1
+	default:
+		n, err := strconv.Atoi(opt.FlannelReleases)
+		if err != nil || n <= 0 {
+			logrus.Fatalf("invalid flannel releases: %s", opt.FlannelReleases)
+		}
+		fl.releases = n
+	}
 	return fl
 }
@@ -3,12 +3,9 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
-	"github.com/panjf2000/ants/v2"
-
-	"github.com/parnurzeal/gorequest"
-
 	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
 )
@@ -18,127 +15,200 @@ var gcr Gcr
 type Gcr struct {
 	kubeadm    bool
 	queryLimit int
-	namespace  string
+	namespaces []string
+	recursive  bool
+	k8sVersion string
 }
 
-func (gcr *Gcr) Images(ctx context.Context) Images {
-	publicImageNames := gcr.imageNames()
+// gcrImageName is a gcr image name within its namespace.
+type gcrImageName struct {
+	namespace string
+	name      string
+}
 
-	logrus.Info("get gcr public image tags...")
-	pool, err := ants.NewPool(gcr.queryLimit, ants.WithPreAlloc(true), ants.WithPanicHandler(func(i interface{}) {
-		logrus.Error(i)
-	}))
-	if err != nil {
-		logrus.Fatalf("failed to create goroutines pool: %s", err)
-	}
+func (gcr *Gcr) Images(ctx context.Context) Images {
+	return collectImages(ctx, gcr)
+}
 
-	var images Images
-	imgCh := make(chan Image, gcr.queryLimit)
-	err = pool.Submit(func() {
-		for image := range imgCh {
-			img := image
-			images = append(images, &img)
+// StreamImages sends the images to out as soon as their tags are listed.
+func (gcr *Gcr) StreamImages(ctx context.Context, out chan<- *Image) {
+	if gcr.k8sVersion != "" {
+		images, err := kubeadmImages(ctx, gcr.k8sVersion)
+		if err != nil {
+			logrus.Fatalf("failed to get kubeadm images: %s", err)
 		}
-	})
-	if err != nil {
-		logrus.Fatalf("failed to submit task: %s", err)
+		for _, img := range images {
+			out <- img
+		}
+		return
 	}
 
-	imgGetWg := new(sync.WaitGroup)
-	imgGetWg.Add(len(publicImageNames))
+	publicImageNames := gcr.imageNames(ctx)
+
+	logrus.Info("get gcr public image tags...")
+	g, _ := newTaskGroup(ctx, gcr.queryLimit)
 	for _, tmpImageName := range publicImageNames {
-		imageName := tmpImageName
-		err = pool.Submit(func() {
-			defer imgGetWg.Done()
-			select {
-			case <-ctx.Done():
-			default:
-				var iName string
-				if gcr.kubeadm {
-					iName = fmt.Sprintf("%s/%s/%s", defaultGcrRepo, defaultGcrNamespace, imageName)
-				} else {
-					iName = fmt.Sprintf("%s/%s/%s", defaultGcrRepo, gcr.namespace, imageName)
+		imageName := tmpImageName.name
+		namespace := tmpImageName.namespace
+		g.Go(func(ctx context.Context) error {
+			var iName string
+			if gcr.kubeadm {
+				iName = fmt.Sprintf("%s/%s/%s", defaultGcrRepo, defaultGcrNamespace, imageName)
+			} else {
+				iName = fmt.Sprintf("%s/%s/%s", defaultGcrRepo, namespace, imageName)
+			}
+
+			logrus.Tracef("query image [%s] tags...", iName)
+			var tags []string
+			terr := limiter.do(ctx, func() error {
+				var lerr error
+				tags, lerr = getImageTags(ctx, iName, TagsOption{Timeout: DefaultCtxTimeout})
+				return lerr
+			})
+			if terr != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
 				}
+				logrus.Error(terr)
+				return nil
+			}
+			logrus.Tracef("image [%s] tags count: %d", iName, len(tags))
 
-				logrus.Debugf("query image [%s] tags...", iName)
-				tags, terr := getImageTags(iName, TagsOption{Timeout: DefaultCtxTimeout})
-				if err != nil {
-					logrus.Errorf("failed to get image [%s] tags, error: %s", iName, terr)
-					return
+			for _, tag := range tags {
+				img := &Image{Repo: defaultGcrRepo, User: namespace, Name: imageName, Tag: tag}
+				if gcr.kubeadm {
+					img = &Image{Repo: defaultK8sRepo, Name: imageName, Tag: tag}
 				}
-				logrus.Debugf("image [%s] tags count: %d", iName, len(tags))
-
-				for _, tag := range tags {
-					if gcr.kubeadm {
-						imgCh <- Image{
-							Repo: defaultK8sRepo,
-							Name: imageName,
-							Tag:  tag,
-						}
-					} else {
-						imgCh <- Image{
-							Repo: defaultGcrRepo,
-							User: gcr.namespace,
-							Name: imageName,
-							Tag:  tag,
-						}
-					}
+				select {
+				case out <- img:
+				case <-ctx.Done():
+					return ctx.Err()
 				}
 			}
+			return nil
 		})
-		if err != nil {
-			logrus.Fatalf("failed to submit task: %s", err)
-		}
 	}
-
-	imgGetWg.Wait()
-	pool.Release()
-	close(imgCh)
-	return images
+	if err := g.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Errorf("failed to get gcr image tags: %s", err)
+	}
 }
 
-func (gcr *Gcr) imageNames() []string {
+func (gcr *Gcr) imageNames(ctx context.Context) []gcrImageName {
 	logrus.Info("get gcr public images...")
 
-	var addr string
 	if gcr.kubeadm {
-		addr = gcrKubeadmImagesTpl
-	} else {
-		addr = fmt.Sprintf(gcrStandardImagesTpl, gcr.namespace)
+		names, err := gcr.namespaceImageNames(ctx, gcrKubeadmImagesTpl)
+		if err != nil {
+			logrus.Fatalf("failed to get gcr images, address: %s, error: %s", gcrKubeadmImagesTpl, err)
+		}
+		var imageNames []gcrImageName
+		for _, name := range names {
+			imageNames = append(imageNames, gcrImageName{name: name})
+		}
+		return imageNames
 	}
 
-	resp, body, errs := gorequest.New().
-		Timeout(DefaultHTTPTimeout).
-		Retry(DefaultGoRequestRetry, DefaultGoRequestRetryTime).
-		Get(addr).
-		EndBytes()
-	if errs != nil {
-		logrus.Fatalf("failed to get gcr images, address: %s, error: %s", addr, errs)
+	var imageNames []gcrImageName
+	for _, ns := range gcr.namespaces {
+		names := gcr.walkNamespace(ctx, ns)
+		logrus.Infof("gcr namespace [%s] images count: %d", ns, len(names))
+		imageNames = append(imageNames, names...)
 	}
-	defer func() { _ = resp.Body.Close() }()
+	return imageNames
+}
 
-	var imageNames []string
-	err := jsoniter.UnmarshalFromString(jsoniter.Get(body, "child").ToString(), &imageNames)
+// gcrNamespace is a gcr namespace with its children names.
+type gcrNamespace struct {
+	name     string
+	children []string
+}
+
+// walkNamespace returns the image names of the namespace, the nested sub
+// namespaces are walked level by level on the query pool when recursive
+// discovery is enabled. Failing to query the namespace is fatal, errors of
+// nested namespaces are logged.
+func (gcr *Gcr) walkNamespace(ctx context.Context, namespace string) []gcrImageName {
+	addr := fmt.Sprintf(gcrStandardImagesTpl, namespace)
+	children, err := gcr.namespaceImageNames(ctx, addr)
 	if err != nil {
 		logrus.Fatalf("failed to get gcr images, address: %s, error: %s", addr, err)
 	}
+
+	var imageNames []gcrImageName
+	level := []gcrNamespace{{name: namespace, children: children}}
+	for len(level) > 0 {
+		var next []gcrNamespace
+		var mu sync.Mutex
+		g, _ := newTaskGroup(ctx, gcr.queryLimit)
+		for _, ns := range level {
+			for _, name := range ns.children {
+				imageNames = append(imageNames, gcrImageName{namespace: ns.name, name: name})
+				if !gcr.recursive {
+					continue
+				}
+				sub := ns.name + "/" + name
+				g.Go(func(ctx context.Context) error {
+					addr := fmt.Sprintf(gcrStandardImagesTpl, sub)
+					children, err := gcr.namespaceImageNames(ctx, addr)
+					if err != nil {
+						if ctx.Err() != nil {
+							return ctx.Err()
+						}
+						logrus.Errorf("failed to get gcr images, address: %s, error: %s", addr, err)
+						return nil
+					}
+					if len(children) > 0 {
+						mu.Lock()
+						next = append(next, gcrNamespace{name: sub, children: children})
+						mu.Unlock()
+					}
+					return nil
+				})
+			}
+		}
+		if err = g.Wait(); err != nil {
+			if ctx.Err() == nil {
+				logrus.Errorf("failed to walk gcr namespace [%s]: %s", namespace, err)
+			}
+			break
+		}
+		sort.Slice(next, func(i, j int) bool { return next[i].name < next[j].name })
+		level = next
+	}
 	return imageNames
 }
 
-func (gcr *Gcr) Sync(ctx context.Context, opt *SyncOption) {
-	gcrImages := gcr.setDefault(opt).Images(ctx)
-	logrus.Infof("sync images count: %d", len(gcrImages))
-	imgs := SyncImages(ctx, gcrImages, opt)
+// namespaceImageNames returns the children of the gcr address.
+func (gcr *Gcr) namespaceImageNames(ctx context.Context, addr string) ([]string, error) {
+	_, body, err := httpGet(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	var imageNames []string
+	if err = jsoniter.UnmarshalFromString(jsoniter.Get(body, "child").ToString(), &imageNames); err != nil {
+		return nil, err
+	}
+	return imageNames, nil
+}
+
+func (gcr *Gcr) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, gcr.setDefault(opt), opt)
 	report(imgs, opt)
+	return CheckFailures(imgs, opt)
 }
 
 func (gcr *Gcr) setDefault(opt *SyncOption) *Gcr {
 	gcr.kubeadm = opt.Kubeadm
+	gcr.recursive = opt.Recursive
+	gcr.k8sVersion = opt.KubernetesVersion
 	if opt.QueryLimit == 0 {
 		gcr.queryLimit = 20
 	} else {
 		gcr.queryLimit = opt.QueryLimit
 	}
-	gcr.namespace = opt.NameSpace
+	gcr.namespaces = opt.NameSpaces
+	if len(gcr.namespaces) == 0 {
+		gcr.namespaces = []string{defaultGcrNamespace}
+	}
 	return gcr
 }
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var helm Helm
+
+// Helm syncs the images referenced by the manifests `helm template` renders
+// for the charts, e.g. ingress-nginx/ingress-nginx@4.9.0 or oci://registry/chart.
+type Helm struct {
+	charts []string
+	values []string
+	set    []string
+}
+
+func (h *Helm) Images(ctx context.Context) Images {
+	logrus.Info("render helm charts...")
+	refs := make(map[string]bool)
+	for _, chart := range h.charts {
+		args := []string{"template", "imgsync"}
+		if i := strings.LastIndex(chart, "@"); i > 0 {
+			args = append(args, chart[:i], "--version", chart[i+1:])
+		} else {
+			args = append(args, chart)
+		}
+		for _, f := range h.values {
+			args = append(args, "--values", f)
+		}
+		for _, s := range h.set {
+			args = append(args, "--set", s)
+		}
+		out, err := runCommand(ctx, nil, "helm", args...)
+		if err != nil {
+			logrus.Fatalf("failed to render helm chart %s: %s", chart, err)
+		}
+		n := len(refs)
+		if err = findManifestImageRefs(out, refs); err != nil {
+			logrus.Fatalf("failed to parse helm chart %s manifests: %s", chart, err)
+		}
+		logrus.Infof("helm chart [%s] images count: %d", chart, len(refs)-n)
+	}
+	return imagesFromRefs(refs)
+}
+
+// findManifestImageRefs adds the image references of the multi document
+// YAML (or JSON) manifests to refs.
+func findManifestImageRefs(manifests []byte, refs map[string]bool) error {
+	dec := yaml.NewDecoder(bytes.NewReader(manifests))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		findImageRefs(doc, refs)
+	}
+}
+
+// findImageRefs walks the decoded document and adds the string values
+// of all "image" keys to refs.
+func findImageRefs(v interface{}, refs map[string]bool) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		for k, sub := range val {
+			if s, ok := sub.(string); ok && k == "image" && s != "" {
+				refs[s] = true
+				continue
+			}
+			findImageRefs(sub, refs)
+		}
+	case map[string]interface{}:
+		for k, sub := range val {
+			if s, ok := sub.(string); ok && k == "image" && s != "" {
+				refs[s] = true
+				continue
+			}
+			findImageRefs(sub, refs)
+		}
+	case []interface{}:
+		for _, sub := range val {
+			findImageRefs(sub, refs)
+		}
+	}
+}
+
+// imagesFromRefs parses the image references, invalid references are
+// reported as failures.
+func imagesFromRefs(refs map[string]bool) Images {
+	names := make([]string, 0, len(refs))
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	sort.Strings(names)
+
+	var images Images
+	seen := make(map[string]bool)
+	for _, ref := range names {
+		img, err := parseImage(ref)
+		if err != nil {
+			logrus.Errorf("invalid image reference [%s]: %s", ref, err)
+			recordInvalidRef(ref, err)
+			continue
+		}
+		if !seen[img.String()] {
+			seen[img.String()] = true
+			images = append(images, img)
+		}
+	}
+	return images
+}
+
+func (h *Helm) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, h.setDefault(opt), opt)
+	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+func (h *Helm) setDefault(opt *SyncOption) *Helm {
+	h.charts = opt.HelmCharts
+	h.values = opt.HelmValues
+	h.set = opt.HelmSet
+	if len(h.charts) == 0 {
+		logrus.Fatal("no helm charts specified")
+	}
+	return h
+}
@@ -3,11 +3,6 @@ package core
 import (
 	"context"
 	"fmt"
-	"sync"
-
-	"github.com/panjf2000/ants/v2"
-
-	"github.com/parnurzeal/gorequest"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
@@ -52,87 +47,64 @@ type KNative struct {
 }
 
 func (kn *KNative) Images(ctx context.Context) Images {
-	publicImageNames := kn.imageNames()
-
-	logrus.Info("get knative public image tags...")
-	pool, err := ants.NewPool(kn.queryLimit, ants.WithPreAlloc(true), ants.WithPanicHandler(func(i interface{}) {
-		logrus.Error(i)
-	}))
-	if err != nil {
-		logrus.Fatalf("failed to create goroutines pool: %s", err)
-	}
+	return collectImages(ctx, kn)
+}
 
-	var images Images
-	imgCh := make(chan Image, kn.queryLimit)
-	err = pool.Submit(func() {
-		for image := range imgCh {
-			img := image
-			images = append(images, &img)
-		}
-	})
-	if err != nil {
-		logrus.Fatalf("failed to submit task: %s", err)
-	}
+// StreamImages sends the images to out as soon as their tags are listed.
+func (kn *KNative) StreamImages(ctx context.Context, out chan<- *Image) {
+	publicImageNames := kn.imageNames(ctx)
 
-	imgGetWg := new(sync.WaitGroup)
-	imgGetWg.Add(len(publicImageNames))
+	logrus.Info("get knative public image tags...")
+	g, _ := newTaskGroup(ctx, kn.queryLimit)
 	for tmpImageName, ns := range publicImageNames {
 		imageName := tmpImageName
 		namespace := ns
-		err = pool.Submit(func() {
-			defer imgGetWg.Done()
-			select {
-			case <-ctx.Done():
-			default:
-				iName := fmt.Sprintf("%s/%s/%s", kn.repo, namespace, imageName)
-				logrus.Debugf("query image [%s] tags...", iName)
-				tags, terr := getImageTags(iName, TagsOption{Timeout: DefaultCtxTimeout})
-				if err != nil {
-					logrus.Errorf("failed to get image [%s] tags, error: %s", iName, terr)
-					return
+		g.Go(func(ctx context.Context) error {
+			iName := fmt.Sprintf("%s/%s/%s", kn.repo, namespace, imageName)
+			logrus.Tracef("query image [%s] tags...", iName)
+			var tags []string
+			terr := limiter.do(ctx, func() error {
+				var lerr error
+				tags, lerr = getImageTags(ctx, iName, TagsOption{Timeout: DefaultCtxTimeout})
+				return lerr
+			})
+			if terr != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
 				}
-				logrus.Debugf("image [%s] tags count: %d", iName, len(tags))
+				logrus.Error(terr)
+				return nil
+			}
+			logrus.Tracef("image [%s] tags count: %d", iName, len(tags))
 
-				for _, tag := range tags {
-					imgCh <- Image{
-						Repo: kn.repo,
-						User: namespace,
-						Name: imageName,
-						Tag:  tag,
-					}
+			for _, tag := range tags {
+				select {
+				case out <- &Image{Repo: kn.repo, User: namespace, Name: imageName, Tag: tag}:
+				case <-ctx.Done():
+					return ctx.Err()
 				}
 			}
+			return nil
 		})
-		if err != nil {
-			logrus.Fatalf("failed to submit task: %s", err)
-		}
 	}
-
-	imgGetWg.Wait()
-	pool.Release()
-	close(imgCh)
-	return images
+	if err := g.Wait(); err != nil && ctx.Err() == nil {
+		logrus.Errorf("failed to get knative image tags: %s", err)
+	}
 }
 
-func (kn *KNative) imageNames() map[string]string {
+func (kn *KNative) imageNames(ctx context.Context) map[string]string {
 	logrus.Info("get knative public images...")
 
 	imageNames := make(map[string]string, 100)
 	for _, addr := range kNativeImageAddrs {
-		resp, body, errs := gorequest.New().
-			Timeout(DefaultHTTPTimeout).
-			Retry(DefaultGoRequestRetry, DefaultGoRequestRetryTime).
-			Get(fmt.Sprintf(gcrStandardImagesTpl, addr)).
-			EndBytes()
-		if errs != nil {
-			logrus.Errorf("failed to get knative images, address: %s, error: %s", addr, errs)
+		_, body, err := httpGet(ctx, fmt.Sprintf(gcrStandardImagesTpl, addr), nil)
+		if err != nil {
+			logrus.Errorf("failed to get knative images, address: %s, error: %s", addr, err)
 			continue
 		}
 
 		var names []string
-		err := jsoniter.UnmarshalFromString(jsoniter.Get(body, "child").ToString(), &names)
-		_ = resp.Body.Close()
-		if err != nil {
+		if err = jsoniter.UnmarshalFromString(jsoniter.Get(body, "child").ToString(), &names); err != nil {
 			logrus.Errorf("failed to get knative images, address: %s, error: %s", addr, err)
 			continue
 		}
@@ -143,11 +115,10 @@ func (kn *KNative) imageNames() map[string]string {
 	return imageNames
 }
 
-func (kn *KNative) Sync(ctx context.Context, opt *SyncOption) {
-	kNativeImages := kn.setDefault(opt).Images(ctx)
-	logrus.Infof("sync images count: %d", len(kNativeImages))
-	imgs := SyncImages(ctx, kNativeImages, opt)
+func (kn *KNative) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, kn.setDefault(opt), opt)
 	report(imgs, opt)
+	return CheckFailures(imgs, opt)
 }
 
 func (kn *KNative) setDefault(opt *SyncOption) *KNative {
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+var skopeo Skopeo
+
+// Skopeo syncs the images of a skopeo sync YAML source file, e.g.
+//
+//	registry.k8s.io:
+//	  images:
+//	    pause: ["3.9"]
+//	    coredns/coredns: []
+//	  images-by-tag-regex:
+//	    etcd: ^3\.5\.
+type Skopeo struct {
+	queryLimit int
+	file       string
+}
+
+func (sk *Skopeo) Images(ctx context.Context) Images {
+	list, err := loadSkopeoConfig(sk.file)
+	if err != nil {
+		logrus.Fatalf("failed to load skopeo sync file: %s", err)
+	}
+	logrus.Info("get skopeo image tags...")
+	return listStaticImages(ctx, list, sk.queryLimit)
+}
+
+func (sk *Skopeo) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, sk.setDefault(opt), opt)
+	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+func (sk *Skopeo) setDefault(opt *SyncOption) *Skopeo {
+	sk.file = opt.ImagesFile
+	if opt.QueryLimit == 0 {
+		sk.queryLimit = DefaultLimit
+	} else {
+		sk.queryLimit = opt.QueryLimit
+	}
+	return sk
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var static Static
+
+// Static syncs the images listed in a YAML file, e.g.
+//
+//	images:
+//	- name: registry.k8s.io/ingress-nginx/controller
+//	  tags: [v1.9.4, v1.9.5]
+//	- name: registry.k8s.io/metrics-server/metrics-server
+//	  include: '^v0\.7\.'
+//	  exclude: '-rc'
+//
+// Images without tags sync all repository tags matching the filters.
+type Static struct {
+	queryLimit int
+	file       string
+}
+
+type staticList struct {
+	Images []staticImage `yaml:"images"`
+}
+
+type staticImage struct {
+	Name    string   `yaml:"name"`
+	Tags    []string `yaml:"tags"`
+	Include string   `yaml:"include"`
+	Exclude string   `yaml:"exclude"`
+
+	include, exclude *regexp.Regexp
+}
+
+// match reports whether the tag passes the include and exclude filters.
+func (si *staticImage) match(tag string) bool {
+	if si.include != nil && !si.include.MatchString(tag) {
+		return false
+	}
+	return si.exclude == nil || !si.exclude.MatchString(tag)
+}
+
+func loadStaticList(path string) ([]staticImage, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list staticList
+	if err = yaml.UnmarshalStrict(bs, &list); err != nil {
+		return nil, fmt.Errorf("invalid images file %s: %s", path, err)
+	}
+	for i := range list.Images {
+		si := &list.Images[i]
+		if si.Name == "" {
+			return nil, fmt.Errorf("invalid images file %s: image %d has no name", path, i+1)
+		}
+		if si.Include != "" {
+			if si.include, err = regexp.Compile(si.Include); err != nil {
+				return nil, fmt.Errorf("invalid include filter of image %s: %s", si.Name, err)
+			}
+		}
+		if si.Exclude != "" {
+			if si.exclude, err = regexp.Compile(si.Exclude); err != nil {
+				return nil, fmt.Errorf("invalid exclude filter of image %s: %s", si.Name, err)
+			}
+		}
+	}
+	return list.Images, nil
+}
+
+func (st *Static) Images(ctx context.Context) Images {
+	list, err := loadStaticList(st.file)
+	if err != nil {
+		logrus.Fatalf("failed to load images file: %s", err)
+	}
+	logrus.Info("get static image tags...")
+	return listStaticImages(ctx, list, st.queryLimit)
+}
+
+// listStaticImages returns the tags of the listed images, the repository tags
+// matching the filters are queried for images without tags.
+func listStaticImages(ctx context.Context, list []staticImage, queryLimit int) Images {
+	var images Images
+	var mu sync.Mutex
+	g, _ := newTaskGroup(ctx, queryLimit)
+	for i := range list {
+		si := list[i]
+		base, perr := parseImage(si.Name)
+		if perr != nil {
+			logrus.Errorf("invalid image name [%s], error: %s", si.Name, perr)
+			continue
+		}
+		iName := base.Repo + "/" + base.Repository()
+
+		g.Go(func(ctx context.Context) error {
+			tags := si.Tags
+			if len(tags) == 0 {
+				logrus.Tracef("query image [%s] tags...", iName)
+				terr := limiter.do(ctx, func() error {
+					var lerr error
+					tags, lerr = getImageTags(ctx, iName, TagsOption{Timeout: DefaultCtxTimeout})
+					return lerr
+				})
+				if terr != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					logrus.Error(terr)
+					return nil
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, tag := range tags {
+				if si.match(tag) {
+					images = append(images, &Image{Repo: base.Repo, User: base.User, Name: base.Name, Tag: tag})
+				}
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return images
+}
+
+func (st *Static) Sync(ctx context.Context, opt *SyncOption) error {
+	imgs := syncListed(ctx, st.setDefault(opt), opt)
+	report(imgs, opt)
+	return CheckFailures(imgs, opt)
+}
+
+func (st *Static) setDefault(opt *SyncOption) *Static {
+	st.file = opt.ImagesFile
+	if opt.QueryLimit == 0 {
+		st.queryLimit = DefaultLimit
+	} else {
+		st.queryLimit = opt.QueryLimit
+	}
+	return st
+}
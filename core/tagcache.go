@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+)
+
+// tagCacheFile is the tags list cache of the repositories, e.g.
+//
+//	{"repositories": [{"name": "gcr.io/google-containers/pause", "etag": "\"abc\"", "tags": ["3.1", "3.2"], "last": "3.2"}]}
+type tagCacheFile struct {
+	Repositories []*tagCacheEntry `json:"repositories"`
+}
+
+type tagCacheEntry struct {
+	Name string   `json:"name"`
+	ETag string   `json:"etag,omitempty"`
+	Tags []string `json:"tags"`
+	// Last is the lexically last listed tag, incremental listings only
+	// request the tags after it
+	Last string `json:"last,omitempty"`
+	// Refreshed is the time of the last full listing
+	Refreshed time.Time `json:"refreshed"`
+}
+
+// tagCache sends conditional tags list requests with the cached ETags, the
+// cached tags of unchanged repositories are returned without downloading
+// the list again.
+type tagCache struct {
+	path        string
+	incremental bool
+	refresh     time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*tagCacheEntry
+	clients   map[string]*registryClient
+	unchanged int
+	listed    int
+}
+
+const (
+	DefaultTagsRefresh = 7 * 24 * time.Hour
+
+	// tagsPageSize is the page size of incremental tags listings
+	tagsPageSize = 1000
+)
+
+// tagsCache is the tags list cache of the run, nil if it is disabled.
+var tagsCache *tagCache
+
+// useTagCache loads the tags list cache of opt.TagsCacheFile before the
+// images are listed, a missing file is an empty cache.
+func useTagCache(opt *SyncOption) {
+	if opt.TagsCacheFile == "" {
+		tagsCache = nil
+		return
+	}
+	c := &tagCache{
+		path:        opt.TagsCacheFile,
+		incremental: opt.IncrementalTags,
+		refresh:     opt.TagsRefresh,
+		entries:     make(map[string]*tagCacheEntry),
+		clients:     make(map[string]*registryClient),
+	}
+	bs, err := ioutil.ReadFile(opt.TagsCacheFile)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Fatalf("failed to read tags cache: %s", err)
+	}
+	if len(bs) > 0 {
+		var f tagCacheFile
+		if err = jsoniter.Unmarshal(bs, &f); err != nil {
+			logrus.Fatalf("invalid tags cache file %s: %s", opt.TagsCacheFile, err)
+		}
+		for _, e := range f.Repositories {
+			c.entries[e.Name] = e
+		}
+	}
+	tagsCache = c
+}
+
+// saveTagCache writes the tags list cache of the run.
+func saveTagCache() {
+	c := tagsCache
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := tagCacheFile{Repositories: make([]*tagCacheEntry, 0, len(c.entries))}
+	for _, e := range c.entries {
+		f.Repositories = append(f.Repositories, e)
+	}
+	sort.Slice(f.Repositories, func(i, j int) bool { return f.Repositories[i].Name < f.Repositories[j].Name })
+	bs, err := jsoniter.Marshal(&f)
+	if err == nil {
+		err = ioutil.WriteFile(c.path, bs, 0644)
+	}
+	if err != nil {
+		logrus.Errorf("failed to write tags cache: %s", err)
+		return
+	}
+	logrus.Infof("tags cache: %d of %d listed repositories unchanged", c.unchanged, c.listed)
+}
+
+func (c *tagCache) client(host string) *registryClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[host]
+	if !ok {
+		client = newRegistryClient(host, "", "")
+		c.clients[host] = client
+	}
+	return client
+}
+
+// list returns the tags of the image, the cached tags are returned if the
+// registry responds 304 Not Modified to the cached ETag. Incremental
+// listings only request the tags after the last cached tag, until the
+// cached list is older than the refresh interval.
+func (c *tagCache) list(ctx context.Context, imageName string) ([]string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return nil, err
+	}
+	host, repo := reference.Domain(named), reference.Path(named)
+	client := c.client(host)
+
+	c.mu.Lock()
+	cached := c.entries[imageName]
+	c.listed++
+	c.mu.Unlock()
+
+	if c.incremental && cached != nil && cached.Last != "" && (c.refresh <= 0 || time.Since(cached.Refreshed) < c.refresh) {
+		query := url.Values{"n": []string{strconv.Itoa(tagsPageSize)}, "last": []string{cached.Last}}
+		added, _, _, err := listTagPages(ctx, client, repo, "tags/list?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		all := mergeTags(cached.Tags, added)
+		logrus.Tracef("image [%s] new tags count: %d", imageName, len(all)-len(cached.Tags))
+		c.mu.Lock()
+		if len(all) == len(cached.Tags) {
+			c.unchanged++
+		}
+		c.entries[imageName] = &tagCacheEntry{Name: imageName, Tags: all, Last: lastTag(all), Refreshed: cached.Refreshed}
+		c.mu.Unlock()
+		return all, nil
+	}
+
+	var header http.Header
+	if cached != nil && cached.ETag != "" {
+		header = http.Header{"If-None-Match": []string{cached.ETag}}
+	}
+	all, etag, notModified, err := listTagPages(ctx, client, repo, "tags/list", header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	if notModified {
+		c.mu.Lock()
+		c.unchanged++
+		c.mu.Unlock()
+		logrus.Tracef("image [%s] tags not modified", imageName)
+		return cached.Tags, nil
+	}
+	c.mu.Lock()
+	c.entries[imageName] = &tagCacheEntry{Name: imageName, ETag: etag, Tags: all, Last: lastTag(all), Refreshed: time.Now().UTC()}
+	c.mu.Unlock()
+	return all, nil
+}
+
+// listTagPages lists the tags of the repository from the path, following
+// the next page links. The returned ETag is empty if the list has more than
+// one page, since the ETag of the first page does not cover the others.
+func listTagPages(ctx context.Context, client *registryClient, repo, path string, header http.Header) ([]string, string, bool, error) {
+	var all []string
+	var etag string
+	for page := 0; path != ""; page++ {
+		resp, err := client.do(ctx, http.MethodGet, repo, path, header, nil)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			drainBody(resp)
+			return nil, "", true, nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		drainBody(resp)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", false, fmt.Errorf("status: %s", resp.Status)
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		if err = jsoniter.Unmarshal(body, &list); err != nil {
+			return nil, "", false, fmt.Errorf("invalid tags list: %s", err)
+		}
+		all = append(all, list.Tags...)
+		if page == 0 {
+			etag = resp.Header.Get("ETag")
+		}
+		header = nil
+		if path = nextTagsPath(resp.Header.Get("Link")); path != "" {
+			etag = ""
+		}
+	}
+	return all, etag, false, nil
+}
+
+// mergeTags appends the added tags which are not cached, registries which
+// ignore the last parameter return the full list again.
+func mergeTags(cached, added []string) []string {
+	seen := make(map[string]bool, len(cached))
+	for _, tag := range cached {
+		seen[tag] = true
+	}
+	all := append([]string(nil), cached...)
+	for _, tag := range added {
+		if !seen[tag] {
+			seen[tag] = true
+			all = append(all, tag)
+		}
+	}
+	return all
+}
+
+// lastTag returns the lexically last tag, which the registries paginate by.
+func lastTag(tags []string) string {
+	var last string
+	for _, tag := range tags {
+		if tag > last {
+			last = tag
+		}
+	}
+	return last
+}
+
+// nextTagsPath returns the tags list path of the next page link, e.g.
+// Link: </v2/library/nginx/tags/list?last=1.19&n=100>; rel="next"
+func nextTagsPath(link string) string {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return "tags/list?" + u.RawQuery
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/panjf2000/ants/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// taskGroup runs tasks on a bounded ants pool with errgroup semantics, the
+// first returned error cancels the context of the group and is returned by
+// Wait.
+type taskGroup struct {
+	pool   *ants.Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// newTaskGroup returns the group running at most size tasks at the same time.
+func newTaskGroup(ctx context.Context, size int) (*taskGroup, context.Context) {
+	pool, err := ants.NewPool(size, ants.WithPreAlloc(true), ants.WithPanicHandler(logPanic))
+	if err != nil {
+		logrus.Fatalf("failed to create goroutines pool: %s", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &taskGroup{pool: pool, ctx: ctx, cancel: cancel}, ctx
+}
+
+// Go submits the task, it blocks while all workers of the pool are busy.
+// Tasks submitted after the group has been cancelled are not run.
+func (g *taskGroup) Go(f func(ctx context.Context) error) {
+	g.wg.Add(1)
+	err := g.pool.Submit(func() {
+		defer g.wg.Done()
+		if g.ctx.Err() != nil {
+			return
+		}
+		if err := f(g.ctx); err != nil {
+			g.fail(err)
+		}
+	})
+	if err != nil {
+		g.wg.Done()
+		g.fail(fmt.Errorf("failed to submit task: %s", err))
+	}
+}
+
+func (g *taskGroup) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait waits for the submitted tasks and releases the pool, it returns the
+// first error of the tasks.
+func (g *taskGroup) Wait() error {
+	g.wg.Wait()
+	g.pool.Release()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/sirupsen/logrus"
+)
+
+// adaptiveTimeoutBase is the part of the adaptive image timeouts which does
+// not depend on the image size, e.g. the manifests and the auth requests
+const adaptiveTimeoutBase = 1 * time.Minute
+
+// imageTimeout returns the sync timeout of the image, blob is its source
+// manifest and l the parsed manifest list if it is a list. With a minimum
+// throughput the timeout is adaptiveTimeoutBase plus the time to copy the
+// layers at the minimum throughput, so small images fail fast and large
+// images are not killed at the fixed timeout. Images of unknown size use
+// the fixed timeout. The size is computed once per image and kept on Image
+// for the sync retries.
+func imageTimeout(ctx context.Context, image *Image, l manifest.List, blob []byte, opt *SyncOption) time.Duration {
+	if opt.MinThroughput == "" || len(blob) == 0 {
+		return opt.Timeout
+	}
+	throughput, err := parseByteSize(opt.MinThroughput)
+	if err != nil {
+		return opt.Timeout
+	}
+	if image.Size == 0 {
+		var size int64
+		var ok bool
+		if l != nil {
+			size, ok = listSize(ctx, image, l, opt)
+		} else {
+			size, ok = manifestSize(blob)
+		}
+		image.Size = -1
+		if ok {
+			image.Size = size
+		}
+	}
+	if image.Size < 0 {
+		return opt.Timeout
+	}
+	size := image.Size
+	timeout := adaptiveTimeoutBase + time.Duration(float64(size)/float64(throughput)*float64(time.Second))
+	logrus.Debugf("image [%s] size %d MiB, timeout %s", image.String(), size>>20, timeout.Round(time.Second))
+	return timeout
+}
+
+// listSize returns the sum of the platform manifest sizes of the list, only
+// the platforms kept by the platform filter are copied. The platform manifest
+// requests are bounded by the fixed image timeout.
+func listSize(ctx context.Context, image *Image, l manifest.List, opt *SyncOption) (int64, bool) {
+	ctx, cancel := context.WithTimeout(ctx, opt.Timeout)
+	defer cancel()
+	f := newPlatformFilter(opt)
+	var total int64
+	for _, p := range listPlatforms(l) {
+		if f != nil && !f.keep(p.platform) {
+			continue
+		}
+		mbs, err := getManifestBlob(ctx, fmt.Sprintf("%s/%s@%s", image.Repo, image.Repository(), p.digest), nil)
+		if err != nil {
+			logrus.Debugf("failed to get image [%s] platform manifest %s: %s", image.String(), p.digest, err)
+			return 0, false
+		}
+		size, ok := manifestSize(mbs)
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+	return total, total > 0
+}
+
+// manifestSize returns the config and layers size of the image manifest.
+// It is not known for manifest lists and manifests with sizes missing, e.g.
+// schema1 layers.
+func manifestSize(blob []byte) (int64, bool) {
+	mimeType := manifest.GuessMIMEType(blob)
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return 0, false
+	}
+	m, err := manifest.FromBlob(blob, mimeType)
+	if err != nil {
+		return 0, false
+	}
+	size := m.ConfigInfo().Size
+	for _, layer := range m.LayerInfos() {
+		if layer.Size <= 0 {
+			return 0, false
+		}
+		size += layer.Size
+	}
+	return size, size > 0
+}
+
+// parseByteSize parses sizes with binary(Ki, Mi, Gi) or decimal(K, M, G)
+// units, sizes without unit are bytes.
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"ki", 1 << 10}, {"mi", 1 << 20}, {"gi", 1 << 30},
+		{"k", 1e3}, {"m", 1e6}, {"g", 1e9}, {"b", 1},
+	}
+	v := strings.ToLower(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSuffix(v, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// maxParallelLayers is the upper limit of parallel layer copies
+// hard-coded in containers/image copy package.
+const maxParallelLayers = 6
+
+// limitedReference wraps an image reference and limits the number of layers
+// read in parallel from the image source it creates.
+type limitedReference struct {
+	types.ImageReference
+	layers int
+}
+
+func newLimitedReference(ref types.ImageReference, layers int) types.ImageReference {
+	if layers <= 0 {
+		return ref
+	}
+	if layers > maxParallelLayers {
+		logrus.Warnf("parallel layers %d exceeds the copy limit, use %d", layers, maxParallelLayers)
+		return ref
+	}
+	return &limitedReference{ImageReference: ref, layers: layers}
+}
+
+func (r *limitedReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedSource{ImageSource: src, sem: make(chan struct{}, r.layers)}, nil
+}
+
+type limitedSource struct {
+	types.ImageSource
+	sem chan struct{}
+}
+
+// HasThreadSafeGetBlob returns false to force sequential layer copies.
+func (s *limitedSource) HasThreadSafeGetBlob() bool {
+	return cap(s.sem) > 1 && s.ImageSource.HasThreadSafeGetBlob()
+}
+
+func (s *limitedSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	rc, size, err := s.ImageSource.GetBlob(ctx, info, cache)
+	if err != nil {
+		<-s.sem
+		return nil, 0, err
+	}
+	return &limitedReadCloser{ReadCloser: rc, sem: s.sem}, size, nil
+}
+
+// limitedReadCloser releases the parallel slot when the blob is closed.
+type limitedReadCloser struct {
+	io.ReadCloser
+	sem    chan struct{}
+	closed bool
+}
+
+func (rc *limitedReadCloser) Close() error {
+	if !rc.closed {
+		rc.closed = true
+		<-rc.sem
+	}
+	return rc.ReadCloser.Close()
+}
+
+// platformFilter selects the manifest list entries which are copied.
+type platformFilter struct {
+	skipOS    map[string]bool
+	platforms map[string]bool // os/arch[/variant], all platforms if empty
+}
+
+// newPlatformFilter returns the platform filter of the option, nil if all
+// platforms are copied.
+func newPlatformFilter(opt *SyncOption) *platformFilter {
+	if opt.PreserveDigests || (!opt.SkipWindows && len(opt.Platforms) == 0) {
+		return nil
+	}
+	f := &platformFilter{skipOS: make(map[string]bool), platforms: make(map[string]bool)}
+	if opt.SkipWindows {
+		f.skipOS["windows"] = true
+	}
+	for _, p := range opt.Platforms {
+		f.platforms[p] = true
+	}
+	return f
+}
+
+// filtersPlatforms reports whether platforms are dropped from manifest lists,
+// the digests of filtered manifest lists never match the source digests.
+func filtersPlatforms(opt *SyncOption) bool {
+	return newPlatformFilter(opt) != nil
+}
+
+// keep reports whether the manifest list entry of the platform is copied,
+// entries without platform are only copied without a platforms selection.
+func (f *platformFilter) keep(p *imgspecv1.Platform) bool {
+	if p == nil {
+		return len(f.platforms) == 0
+	}
+	if f.skipOS[p.OS] {
+		return false
+	}
+	if len(f.platforms) == 0 {
+		return true
+	}
+	return f.platforms[p.OS+"/"+p.Architecture] || (p.Variant != "" && f.platforms[p.OS+"/"+p.Architecture+"/"+p.Variant])
+}
+
+// platformFilterReference wraps an image reference, the manifest list of the
+// image source it creates only has the entries kept by the filter.
+type platformFilterReference struct {
+	types.ImageReference
+	image  *Image
+	filter *platformFilter
+}
+
+func newPlatformFilterReference(ref types.ImageReference, image *Image, filter *platformFilter) types.ImageReference {
+	if filter == nil {
+		return ref
+	}
+	return &platformFilterReference{ImageReference: ref, image: image, filter: filter}
+}
+
+func (r *platformFilterReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &platformFilterSource{ImageSource: src, ref: r}, nil
+}
+
+type platformFilterSource struct {
+	types.ImageSource
+	ref *platformFilterReference
+}
+
+func (s *platformFilterSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	mbs, mType, err := s.ImageSource.GetManifest(ctx, instanceDigest)
+	if err != nil || instanceDigest != nil {
+		return mbs, mType, err
+	}
+
+	if mType == "" {
+		mType = manifest.GuessMIMEType(mbs)
+	}
+	var filtered manifest.List
+	var dropped int
+	switch manifest.NormalizedMIMEType(mType) {
+	case manifest.DockerV2ListMediaType:
+		list, lerr := manifest.Schema2ListFromManifest(mbs)
+		if lerr != nil {
+			return nil, "", lerr
+		}
+		var components []manifest.Schema2ManifestDescriptor
+		for _, m := range list.Manifests {
+			if !s.ref.filter.keep(&imgspecv1.Platform{OS: m.Platform.OS, Architecture: m.Platform.Architecture, Variant: m.Platform.Variant}) {
+				dropped++
+				continue
+			}
+			components = append(components, m)
+		}
+		filtered = manifest.Schema2ListFromComponents(components)
+	case imgspecv1.MediaTypeImageIndex:
+		index, lerr := manifest.OCI1IndexFromManifest(mbs)
+		if lerr != nil {
+			return nil, "", lerr
+		}
+		var components []imgspecv1.Descriptor
+		for _, m := range index.Manifests {
+			if !s.ref.filter.keep(m.Platform) {
+				dropped++
+				continue
+			}
+			components = append(components, m)
+		}
+		filtered = manifest.OCI1IndexFromComponents(components, index.Annotations)
+	default:
+		return mbs, mType, nil
+	}
+	if dropped == 0 {
+		return mbs, mType, nil
+	}
+	if len(filtered.Instances()) == 0 {
+		return nil, "", fmt.Errorf("no platforms left in image [%s] manifest list", s.ref.image.String())
+	}
+
+	fbs, err := filtered.Serialize()
+	if err != nil {
+		return nil, "", err
+	}
+	logrus.Debugf("dropped %d platforms from image [%s] manifest list", dropped, s.ref.image.String())
+	s.ref.image.Filtered = true
+	return fbs, mType, nil
+}
@@ -3,6 +3,10 @@ package core
 import (
 	"fmt"
 	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
 )
 
 type Image struct {
@@ -14,6 +18,27 @@ type Image struct {
 	Success  bool
 	CacheHit bool
 	Err      error
+
+	Digest         digest.Digest // Source manifest digest
+	DestDigest     digest.Digest // Destination manifest digest after sync
+	DestPresent    bool          // Destination tag already has the source digest, the copy is skipped
+	DigestMismatch bool
+	Schema1        bool          // Source manifest is docker schema1
+	Filtered       bool          // Platforms have been dropped from the manifest list
+	Referrers      int           // Copied OCI referrers count
+	Findings       string        // Vulnerability scan findings
+	Unverified     bool          // Source signature verification failed
+	Overwritten    digest.Digest // Overwritten destination digest
+	DestTag        string        // Rewritten destination tag
+	DestName       string        // Disambiguated destination repository name
+	Pinned         digest.Digest // Source digest pinned by the lock file
+	Changes        string        // Manifest changes since the cached manifest
+	Recompressed   string        // Layer compression conversion, e.g. zstd => gzip
+	Attempts       int           // Sync attempts of the image
+	Size           int64         // Layers size of the copied platforms, -1 if unknown, 0 if not computed yet
+
+	Skipped    bool
+	SkipReason string
 }
 
 func (img *Image) String() string {
@@ -23,6 +48,26 @@ func (img *Image) String() string {
 	return fmt.Sprintf("%s/%s:%s", img.Repo, img.Name, img.Tag)
 }
 
+// Repository returns the image repository path without registry host and tag.
+func (img *Image) Repository() string {
+	if img.User != "" {
+		return img.User + "/" + img.Name
+	}
+	return img.Name
+}
+
+// Failed reports whether the image is neither synced nor skipped.
+func (img *Image) Failed() bool {
+	return !img.Success && !img.Skipped
+}
+
+// Skip marks the image as skipped, skipped images are not failures.
+func (img *Image) Skip(reason string) {
+	img.Skipped = true
+	img.SkipReason = reason
+	logrus.Warnf("skip image [%s]: %s", img.String(), reason)
+}
+
 func (img *Image) MergeName() string {
 	if img.User != "" {
 		return fmt.Sprintf("%s_%s_%s", img.Repo, strings.ReplaceAll(img.User, "/", "_"), img.Name)
@@ -35,3 +80,32 @@ type Images []*Image
 func (imgs Images) Len() int           { return len(imgs) }
 func (imgs Images) Less(i, j int) bool { return imgs[i].String() < imgs[j].String() }
 func (imgs Images) Swap(i, j int)      { imgs[i], imgs[j] = imgs[j], imgs[i] }
+
+// parseImage parses a full image reference, e.g. registry.k8s.io/ingress-nginx/controller:v1.9.4,
+// docker hub references are normalized and images without tag use latest.
+// Images referenced by digest are pinned to the digest, digest only
+// references use a tag derived from the digest, e.g. sha256-<hex>.
+func parseImage(s string) (*Image, error) {
+	named, err := reference.ParseNormalizedNamed(s)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Repo: reference.Domain(named), Tag: "latest"}
+	path := reference.Path(named)
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		img.User, img.Name = path[:i], path[i+1:]
+	} else {
+		img.Name = path
+	}
+	tagged, isTagged := named.(reference.Tagged)
+	if isTagged {
+		img.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		img.Digest, img.Pinned = digested.Digest(), digested.Digest()
+		if !isTagged {
+			img.Tag = strings.Replace(img.Digest.String(), ":", "-", 1)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultProgressInterval = 5 * time.Second
+
+// uploadProgress records the blobs of a single image which have been fully
+// transferred to the destination and the upload sessions of the blobs which
+// have not. It is shared by all retries of the same image, so an interrupted
+// push resumes: committed layers are found on the destination instead of
+// being transferred again, and interrupted blob uploads continue from the
+// offset the registry has received.
+type uploadProgress struct {
+	// last is the unix nano time of the last progress event, it is the
+	// first field for the 64-bit alignment of atomic operations
+	last int64
+
+	mu        sync.Mutex
+	committed map[digest.Digest]int64
+	sessions  map[digest.Digest]string // upload locations of the blobs
+}
+
+func newUploadProgress() *uploadProgress {
+	return &uploadProgress{committed: make(map[digest.Digest]int64), sessions: make(map[digest.Digest]string)}
+}
+
+// watch consumes the copy progress channel of the image until it is
+// closed, the layer progress is logged at the debug level.
+func (up *uploadProgress) watch(image *Image, ch <-chan types.ProgressProperties) {
+	for p := range ch {
+		up.touch()
+		switch p.Event {
+		case types.ProgressEventNewArtifact:
+			logrus.Debugf("image [%s] copying blob %s (%s)", image.String(), p.Artifact.Digest, humanSize(p.Artifact.Size))
+			continue
+		case types.ProgressEventRead:
+			logrus.Debugf("image [%s] blob %s: %s/%s", image.String(), p.Artifact.Digest, humanSize(int64(p.Offset)), humanSize(p.Artifact.Size))
+			continue
+		}
+		// progress done is also fired when the transfer fails,
+		// only a complete read of a known size blob is a commit
+		if p.Artifact.Size <= 0 || int64(p.Offset) < p.Artifact.Size {
+			continue
+		}
+		logrus.Debugf("image [%s] blob %s copied", image.String(), p.Artifact.Digest)
+		up.mu.Lock()
+		up.committed[p.Artifact.Digest] = p.Artifact.Size
+		up.mu.Unlock()
+	}
+}
+
+// committedSize returns the count and total size of committed blobs.
+func (up *uploadProgress) committedSize() (int, int64) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	var size int64
+	for _, s := range up.committed {
+		size += s
+	}
+	return len(up.committed), size
+}
+
+// resume logs the progress restored from previous attempts.
+func (up *uploadProgress) resume(image *Image) {
+	count, size := up.committedSize()
+	up.mu.Lock()
+	sessions := len(up.sessions)
+	up.mu.Unlock()
+	if count == 0 && sessions == 0 {
+		return
+	}
+	logrus.Infof("resuming image [%s] upload, %d blobs (%d bytes) already committed, %d interrupted blob uploads", image.String(), count, size, sessions)
+}
+
+func (up *uploadProgress) session(dgst digest.Digest) string {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.sessions[dgst]
+}
+
+// setSession keeps the upload location of the blob, an empty location ends
+// the session.
+func (up *uploadProgress) setSession(dgst digest.Digest, location string) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if location == "" {
+		delete(up.sessions, dgst)
+		return
+	}
+	up.sessions[dgst] = location
+}
+
+// resumableReference wraps a docker destination reference, the blobs of the
+// image destination it creates are uploaded in sessions kept by up across the
+// retries of the image.
+type resumableReference struct {
+	types.ImageReference
+	client *registryClient
+	repo   string
+	up     *uploadProgress
+}
+
+func newResumableReference(ref types.ImageReference, destImage *Image, opt *SyncOption, up *uploadProgress) types.ImageReference {
+	if up == nil {
+		return ref
+	}
+	return &resumableReference{
+		ImageReference: ref,
+		client:         newRegistryClient(destImage.Repo, opt.User, opt.Password),
+		repo:           destImage.Repository(),
+		up:             up,
+	}
+}
+
+func (r *resumableReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	dest, err := r.ImageReference.NewImageDestination(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	return &resumableDestination{ImageDestination: dest, ref: r}, nil
+}
+
+type resumableDestination struct {
+	types.ImageDestination
+	ref *resumableReference
+}
+
+// PutBlob uploads the blob in the upload session of a previous attempt if
+// the registry still has it, the bytes the registry has received are read
+// from the stream and not sent again. Blobs of unknown digest, e.g.
+// recompressed layers, are uploaded by the wrapped destination.
+func (d *resumableDestination) PutBlob(ctx context.Context, stream io.Reader, info types.BlobInfo, cache types.BlobInfoCache, isConfig bool) (types.BlobInfo, error) {
+	if info.Digest == "" || info.Digest.Validate() != nil {
+		return d.ImageDestination.PutBlob(ctx, stream, info, cache, isConfig)
+	}
+	r := d.ref
+	location, offset, err := r.startUpload(ctx, info.Digest)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	if offset > 0 {
+		logrus.Infof("resuming blob %s upload at %s", info.Digest, humanSize(offset))
+		if _, err = io.CopyN(ioutil.Discard, stream, offset); err != nil {
+			return types.BlobInfo{}, err
+		}
+	}
+
+	counter := &countingReader{r: stream}
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	resp, err := r.client.stream(ctx, http.MethodPatch, r.repo, location, header, counter)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+		return types.BlobInfo{}, statusError(resp, "failed to upload blob %s", info.Digest)
+	}
+	if next := r.client.uploadURL(resp.Header.Get("Location")); next != "" {
+		location = next
+		r.up.setSession(info.Digest, location)
+	}
+
+	sep := "?"
+	if strings.Contains(location, "?") {
+		sep = "&"
+	}
+	resp, err = r.client.doURL(ctx, http.MethodPut, r.repo, location+sep+"digest="+info.Digest.String(), nil, []byte{})
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusCreated {
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound {
+			// a digest mismatch or an expired session can not be resumed
+			r.up.setSession(info.Digest, "")
+		}
+		return types.BlobInfo{}, statusError(resp, "failed to commit blob %s", info.Digest)
+	}
+	r.up.setSession(info.Digest, "")
+
+	if named := r.DockerReference(); named != nil {
+		cache.RecordKnownLocation(r.Transport(), types.BICTransportScope{Opaque: reference.Domain(named)}, info.Digest, types.BICLocationReference{Opaque: named.Name()})
+	}
+	return types.BlobInfo{Digest: info.Digest, Size: offset + counter.n}, nil
+}
+
+// startUpload returns the upload location of the blob and the offset to
+// continue the upload from, a new upload is started if the session of the
+// previous attempt is not known by the registry anymore.
+func (r *resumableReference) startUpload(ctx context.Context, dgst digest.Digest) (string, int64, error) {
+	if location := r.up.session(dgst); location != "" {
+		offset, err := r.uploadOffset(ctx, location)
+		if err == nil {
+			return location, offset, nil
+		}
+		logrus.Debugf("failed to resume blob %s upload, start it again: %s", dgst, err)
+		r.up.setSession(dgst, "")
+	}
+
+	resp, err := r.client.do(ctx, http.MethodPost, r.repo, "blobs/uploads/", nil, []byte{})
+	if err != nil {
+		return "", 0, err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusAccepted {
+		return "", 0, statusError(resp, "failed to start blob %s upload", dgst)
+	}
+	location := r.client.uploadURL(resp.Header.Get("Location"))
+	if location == "" {
+		return "", 0, fmt.Errorf("failed to start blob %s upload: no upload location", dgst)
+	}
+	r.up.setSession(dgst, location)
+	return location, 0, nil
+}
+
+// uploadOffset returns the bytes count the registry has received in the
+// upload session, from the Range header of the upload status, e.g. 0-1023.
+// Registries report both an empty session and a single received byte as
+// 0-0, such sessions are not resumed but started again.
+func (r *resumableReference) uploadOffset(ctx context.Context, location string) (int64, error) {
+	resp, err := r.client.doURL(ctx, http.MethodGet, r.repo, location, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	drainBody(resp)
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, statusError(resp, "failed to get upload status")
+	}
+	rng := resp.Header.Get("Range")
+	if rng == "" {
+		return 0, nil
+	}
+	ss := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+	if len(ss) != 2 {
+		return 0, fmt.Errorf("invalid upload range: %s", rng)
+	}
+	end, err := strconv.ParseInt(ss[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid upload range: %s", rng)
+	}
+	if end == 0 {
+		return 0, fmt.Errorf("ambiguous upload range: %s", rng)
+	}
+	return end + 1, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
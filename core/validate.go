@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// configValidation collects the problems found by ValidateConfig.
+type configValidation struct {
+	problems int
+}
+
+func (v *configValidation) ok(format string, args ...interface{}) {
+	logrus.Infof("ok: "+format, args...)
+}
+
+// fail logs the problem with the hint to fix it.
+func (v *configValidation) fail(hint string, format string, args ...interface{}) {
+	v.problems++
+	msg := fmt.Sprintf(format, args...)
+	if hint != "" {
+		msg += " (" + hint + ")"
+	}
+	logrus.Error(msg)
+}
+
+// ValidateConfig checks the options and files of the synchronizer, the
+// external tools, the source registries connectivity and the destination
+// registry credentials without syncing anything.
+func ValidateConfig(ctx context.Context, name string, opt *SyncOption) error {
+	v := &configValidation{}
+	RegisterSecret(opt.Password)
+
+	if errs := checkSyncOption(opt); len(errs) > 0 {
+		for _, err := range errs {
+			v.fail("", "%s", err)
+		}
+	} else {
+		v.ok("options")
+	}
+	validateFiles(v, name, opt)
+	validateTools(v, name, opt)
+
+	registries, err := sourceRegistries(name, opt)
+	if err != nil {
+		v.fail("fix the images file", "%s", err)
+	}
+	for _, registry := range registries {
+		if err = pingRegistry(ctx, registry); err != nil {
+			v.fail("check the network and proxy settings", "source registry %s is unreachable: %s", registry, err)
+			continue
+		}
+		v.ok("source registry %s", registry)
+	}
+	if !opt.OnlyDownloadManifests && opt.ContainerdNamespace == "" {
+		validateDestination(ctx, v, opt)
+	}
+
+	if v.problems > 0 {
+		return fmt.Errorf("config validation failed: %d problems found", v.problems)
+	}
+	logrus.Info("config is valid")
+	return nil
+}
+
+// validateFiles checks that the files of the options exist and can be parsed.
+func validateFiles(v *configValidation, name string, opt *SyncOption) {
+	check := func(flag, path string, load func(path string) error) {
+		if path == "" {
+			return
+		}
+		if err := load(path); err != nil {
+			v.fail("check the --"+flag+" flag", "invalid %s file %s: %s", flag, path, err)
+			return
+		}
+		v.ok("%s file %s", flag, path)
+	}
+	exists := func(path string) error {
+		_, err := os.Stat(path)
+		return err
+	}
+
+	check("allowlist", opt.AllowlistFile, func(path string) error {
+		_, err := loadDigestList(path)
+		return err
+	})
+	check("locked", opt.LockFile, func(path string) error {
+		_, err := loadLockFile(path)
+		return err
+	})
+	check("history", opt.HistoryFile, func(path string) error {
+		_, err := loadHistory(path)
+		return err
+	})
+	check("policy", opt.PolicyFile, func(path string) error {
+		_, err := signature.NewPolicyFromFile(path)
+		return err
+	})
+	check("audit-key", opt.AuditKey, exists)
+	if opt.CosignKey != "" && opt.CosignKey != "keyless" {
+		check("cosign-key", opt.CosignKey, exists)
+	}
+	if opt.RetryFailed {
+		check("failed-file", opt.FailedFile, exists)
+	}
+	check("images-from", opt.ImagesFrom, exists)
+
+	switch name {
+	case "static":
+		check("images", opt.ImagesFile, func(path string) error {
+			_, err := loadStaticList(path)
+			return err
+		})
+	case "skopeo":
+		check("images", opt.ImagesFile, func(path string) error {
+			_, err := loadSkopeoConfig(path)
+			return err
+		})
+	case "helm":
+		if len(opt.HelmCharts) == 0 {
+			v.fail("set the --chart flag", "no helm charts to render")
+		}
+		for _, values := range opt.HelmValues {
+			check("values", values, exists)
+		}
+	case "cluster":
+		check("kubeconfig", opt.Kubeconfig, exists)
+	}
+}
+
+// validateTools checks that the external tools run by the options are installed.
+func validateTools(v *configValidation, name string, opt *SyncOption) {
+	var tools []string
+	switch {
+	case name == "helm":
+		tools = append(tools, "helm")
+	case name == "cluster":
+		tools = append(tools, "kubectl")
+	case strings.HasPrefix(name, execSynchronizerPrefix):
+		tools = append(tools, strings.TrimPrefix(name, execSynchronizerPrefix))
+	}
+	if opt.ContainerdNamespace != "" {
+		tools = append(tools, "ctr")
+	}
+	if opt.CopyEngine == EngineCrane {
+		tools = append(tools, "crane")
+	}
+	if opt.ScanSeverity != "" {
+		tools = append(tools, "trivy")
+	}
+	if opt.SBOMFormat != "" {
+		tools = append(tools, "syft")
+	}
+	if opt.CosignKey != "" || opt.VerifyKey != "" || opt.VerifyIdentity != "" {
+		tools = append(tools, "cosign")
+	}
+	if opt.NotationKey != "" {
+		tools = append(tools, "notation")
+	}
+	for _, tool := range tools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			v.fail("install it or add it to PATH", "%s is not found: %s", tool, err)
+			continue
+		}
+		v.ok("%s is installed at %s", tool, path)
+	}
+}
+
+// sourceRegistries returns the registries which the synchronizer lists the
+// images from, synchronizers which only know them after listing return nil.
+func sourceRegistries(name string, opt *SyncOption) ([]string, error) {
+	switch name {
+	case "gcr", "kNative":
+		if name == "gcr" && opt.Kubeadm {
+			return []string{defaultGcrRepo, defaultK8sRepo}, nil
+		}
+		return []string{defaultGcrRepo}, nil
+	case "flannel":
+		return []string{strings.SplitN(flannelImageName, "/", 2)[0]}, nil
+	case "static", "skopeo":
+		load := loadStaticList
+		if name == "skopeo" {
+			load = loadSkopeoConfig
+		}
+		list, err := load(opt.ImagesFile)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, si := range list {
+			img, err := parseImage(si.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid image name [%s]: %s", si.Name, err)
+			}
+			seen[img.Repo] = true
+		}
+		var registries []string
+		for registry := range seen {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+		return registries, nil
+	}
+	return nil, nil
+}
+
+// pingRegistry checks the registry serves the v2 api, unauthorized responses
+// mean the registry is reachable.
+func pingRegistry(ctx context.Context, registry string) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v2/", newRegistryClient(registry, "", "").host), nil)
+	if err != nil {
+		return err
+	}
+	logrus.Tracef("GET %s", req.URL)
+	resp, err := registryHTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// validateDestination checks the credentials of the destination registry.
+func validateDestination(ctx context.Context, v *configValidation, opt *SyncOption) {
+	registry := destinationRegistry(opt)
+	if destinationNamespace(opt) == "" && opt.Destination == "" {
+		v.fail("set the --user or --dest-namespace flag", "no destination namespace of registry %s", registry)
+	}
+	if registry == defaultDockerRepo && opt.User == "" {
+		v.fail("set the --user and --password flags", "no docker hub credentials")
+		return
+	}
+	err := docker.CheckAuth(ctx, &types.SystemContext{}, opt.User, opt.Password, registry)
+	if err != nil {
+		hint := "check the --dest-registry flag and the network"
+		if isAuthError(err) {
+			hint = "check the --user and --password flags"
+		}
+		v.fail(hint, "failed to log in to the destination registry %s: %s", registry, err)
+		return
+	}
+	v.ok("destination registry %s credentials", registry)
+}
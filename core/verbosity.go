@@ -0,0 +1,26 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const containersImagePackage = "github.com/containers/image/"
+
+// LibraryFormatter demotes the debug entries of the containers/image library,
+// which are its registry requests, to the trace level. It needs the logger
+// to report callers, the caller is not formatted.
+type LibraryFormatter struct {
+	logrus.Formatter
+}
+
+func (f *LibraryFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	caller := entry.Caller
+	entry.Caller = nil
+	if entry.Level == logrus.DebugLevel && caller != nil && strings.HasPrefix(caller.Function, containersImagePackage) &&
+		!entry.Logger.IsLevelEnabled(logrus.TraceLevel) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// verifyDigest compares the destination manifest digest with the source digest.
+func verifyDigest(ctx context.Context, image *Image, opt *SyncOption) error {
+	// converted or filtered manifests never match the source digest
+	if image.Digest == "" || image.Filtered || image.Recompressed != "" || (image.Schema1 && schema1MIMEType(opt) != "" && !opt.PreserveDigests) {
+		return nil
+	}
+	destImage := destinationImage(image, opt)
+	dgst, err := getManifestDigest(ctx, destImage.String(), destinationSystemContext(opt))
+	if err != nil {
+		return fmt.Errorf("failed to verify image [%s] digest: %s", destImage.String(), err)
+	}
+	image.DestDigest = dgst
+	image.DigestMismatch = dgst != image.Digest
+	if image.DigestMismatch {
+		return fmt.Errorf("image [%s] digest mismatch, source: %s, destination: %s", image.String(), image.Digest, dgst)
+	}
+	logrus.Debugf("image [%s] digest verified: %s", destImage.String(), dgst)
+	return nil
+}
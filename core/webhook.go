@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// webhookEventSynced is the event of an image which has been synced
+	webhookEventSynced = "image.synced"
+
+	// webhookSignatureHeader is the HMAC-SHA256 hex signature of the body with opt.WebhookSecret
+	webhookSignatureHeader = "X-Imgsync-Signature"
+
+	// webhookWorkers is the count of concurrent webhook deliveries
+	webhookWorkers = 4
+)
+
+// webhookEvent is the JSON body of the webhook requests.
+type webhookEvent struct {
+	Event       string        `json:"event"`
+	Image       string        `json:"image"`
+	Digest      digest.Digest `json:"digest,omitempty"`
+	Destination string        `json:"destination"`
+	Time        time.Time     `json:"time"`
+}
+
+// webhookNotifier delivers the synced image events to the webhook urls in
+// the background, so workers do not wait for the receivers.
+type webhookNotifier struct {
+	urls   []string
+	secret string
+	events chan *webhookEvent
+	wg     sync.WaitGroup
+}
+
+// newWebhookNotifier returns nil if no webhook url is specified.
+func newWebhookNotifier(ctx context.Context, opt *SyncOption) *webhookNotifier {
+	if len(opt.Webhooks) == 0 || opt.OnlyDownloadManifests {
+		return nil
+	}
+	n := &webhookNotifier{urls: opt.Webhooks, secret: opt.WebhookSecret, events: make(chan *webhookEvent, DefaultLimit)}
+	RegisterSecret(opt.WebhookSecret)
+	for i := 0; i < webhookWorkers; i++ {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			for e := range n.events {
+				n.deliver(ctx, e)
+			}
+		}()
+	}
+	return n
+}
+
+// synced queues the event of the synced image.
+func (n *webhookNotifier) synced(image, destImage *Image) {
+	if n == nil {
+		return
+	}
+	n.events <- &webhookEvent{
+		Event:       webhookEventSynced,
+		Image:       image.String(),
+		Digest:      image.Digest,
+		Destination: destImage.String(),
+		Time:        time.Now().UTC(),
+	}
+}
+
+// close waits for the queued events to be delivered.
+func (n *webhookNotifier) close() {
+	if n == nil {
+		return
+	}
+	close(n.events)
+	n.wg.Wait()
+}
+
+func (n *webhookNotifier) deliver(ctx context.Context, e *webhookEvent) {
+	body, err := jsoniter.Marshal(e)
+	if err != nil {
+		logrus.Errorf("failed to encode image [%s] webhook event: %s", e.Image, err)
+		return
+	}
+	for _, url := range n.urls {
+		err = retryWithContext(ctx, DefaultHTTPRetry, DefaultHTTPRetryTime, func() error {
+			return n.post(ctx, url, body)
+		})
+		if err != nil {
+			logrus.Errorf("failed to send image [%s] webhook: %s", e.Image, err)
+		}
+	}
+}
+
+func (n *webhookNotifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		_, _ = mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	logrus.Tracef("POST %s", url)
+	resp, err := registryHTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// RecompressGzip recompresses zstd and zstd:chunked layers to gzip for
+// destinations and clients which can not consume zstd.
+const RecompressGzip = "gzip"
+
+// recompressionFormat returns the layer compression of the destination,
+// nil keeps the source layer compression.
+func recompressionFormat(opt *SyncOption) *compression.Algorithm {
+	if opt.Recompress == RecompressGzip {
+		return &compression.Gzip
+	}
+	return nil
+}
+
+// zstdLayers reports whether the OCI image manifest has zstd compressed layers.
+func zstdLayers(blob []byte) bool {
+	if manifest.GuessMIMEType(blob) != imgspecv1.MediaTypeImageManifest {
+		return false
+	}
+	m, err := manifest.OCI1FromManifest(blob)
+	if err != nil {
+		return false
+	}
+	for _, l := range m.Layers {
+		if strings.Contains(l.MediaType, "zstd") {
+			return true
+		}
+	}
+	return false
+}
+
+// recompressedLayers records the layer conversion of the copied image, the
+// source manifest of lists does not show the layers, they are converted if
+// the copied list has been modified.
+func recompressedLayers(image *Image, blob, copied []byte, opt *SyncOption) {
+	if opt.Recompress == "" {
+		return
+	}
+	converted := zstdLayers(blob)
+	if !converted && image.Digest != "" && !image.Filtered && manifest.MIMETypeIsMultiImage(manifest.GuessMIMEType(blob)) {
+		dgst, err := manifest.Digest(copied)
+		converted = err == nil && dgst != image.Digest
+	}
+	if converted {
+		image.Recompressed = fmt.Sprintf("zstd => %s", opt.Recompress)
+	}
+}
@@ -4,15 +4,16 @@ go 1.14
 
 require (
 	github.com/containers/image/v5 v5.4.4-0.20200427135619-4bc5da0478cd
-	github.com/elazarl/goproxy v0.0.0-20200315184450-1f3cb6622dad // indirect
+	github.com/docker/distribution v2.7.1+incompatible
 	github.com/json-iterator/go v1.1.9
+	github.com/klauspost/compress v1.10.5
+	github.com/opencontainers/go-digest v1.0.0-rc1
 	github.com/opencontainers/image-spec v1.0.2-0.20190823105129-775207bd45b6
 	github.com/panjf2000/ants/v2 v2.3.1
-	github.com/parnurzeal/gorequest v0.2.16
 	github.com/sirupsen/logrus v1.5.0
-	github.com/smartystreets/goconvey v1.6.4 // indirect
 	github.com/spf13/cobra v1.0.0
-	moul.io/http2curl v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 // replace github.com/containers/image/v5 v5.4.3 => /Users/natural/gopath/src/github.com/containers/image